@@ -0,0 +1,349 @@
+package dbf
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Aggregate is aggregate function of a field computed by GroupBy.
+type Aggregate struct {
+	fn    string
+	field string
+}
+
+// SumOf totals N, F or Y field, binary Y currency is read as exact decimal.
+// The result is *big.Rat, zero when there are no values.
+func SumOf(field string) Aggregate {
+	return Aggregate{fn: "SUM", field: field}
+}
+
+// AvgOf averages N, F or Y field, the result is *big.Rat or nil when there are
+// no values.
+func AvgOf(field string) Aggregate {
+	return Aggregate{fn: "AVG", field: field}
+}
+
+// MinOf finds the smallest value of the field: *big.Rat for N, F and Y,
+// time.Time for D, string for C and bool for L, nil when there are no values.
+func MinOf(field string) Aggregate {
+	return Aggregate{fn: "MIN", field: field}
+}
+
+// MaxOf finds the largest value of the field as MinOf.
+func MaxOf(field string) Aggregate {
+	return Aggregate{fn: "MAX", field: field}
+}
+
+// CountOf counts rows with the field not blank, the result is int.
+func CountOf(field string) Aggregate {
+	return Aggregate{fn: "COUNT", field: field}
+}
+
+// CountRows counts rows, the result is int.
+func CountRows() Aggregate {
+	return Aggregate{fn: "COUNT"}
+}
+
+// accumulator computes aggregate over rows.
+type accumulator struct {
+	fn    string
+	field int // -1 for CountRows
+	count int
+	sum   *big.Rat
+	best  interface{} // MIN or MAX found so far
+}
+
+func (dt *DbfTable) accumulator(a Aggregate) (*accumulator, error) {
+	acc := &accumulator{fn: a.fn, field: -1, sum: new(big.Rat)}
+	if a.field == "" {
+		if a.fn != "COUNT" {
+			return nil, errors.New("dbf: " + a.fn + " needs field")
+		}
+		return acc, nil
+	}
+	i := dt.fieldIndex(a.field)
+	if i < 0 {
+		return nil, errors.New("dbf: aggregate field '" + a.field + "' does not exist")
+	}
+	acc.field = i
+	if t := dt.fields[i].Type; (a.fn == "SUM" || a.fn == "AVG") && t != "N" && t != "F" && t != "Y" {
+		return nil, errors.New("dbf: " + a.fn + " needs N, F or Y field, '" + a.field + "' is " + t)
+	}
+	return acc, nil
+}
+
+// add adds the row, blank cells are skipped.
+func (acc *accumulator) add(dt *DbfTable, row int) error {
+	if acc.field < 0 {
+		acc.count++
+		return nil
+	}
+	v, err := dt.aggValue(row, acc.field)
+	if err != nil || v == nil {
+		return err
+	}
+	acc.count++
+	switch acc.fn {
+	case "SUM", "AVG":
+		acc.sum.Add(acc.sum, v.(*big.Rat))
+	case "MIN":
+		if acc.best == nil || compareAggValues(v, acc.best) < 0 {
+			acc.best = v
+		}
+	case "MAX":
+		if acc.best == nil || compareAggValues(v, acc.best) > 0 {
+			acc.best = v
+		}
+	}
+	return nil
+}
+
+// result returns value of the aggregate.
+func (acc *accumulator) result() interface{} {
+	switch acc.fn {
+	case "COUNT":
+		return acc.count
+	case "SUM":
+		return acc.sum
+	case "AVG":
+		if acc.count == 0 {
+			return nil
+		}
+		return new(big.Rat).Quo(acc.sum, new(big.Rat).SetInt64(int64(acc.count)))
+	}
+	return acc.best
+}
+
+// aggValue returns value of the field for aggregates: numbers are exact
+// *big.Rat parsed from stored text, binary Y cells from their decimal text
+// given by FieldValue. Blank and null cells are nil.
+func (dt *DbfTable) aggValue(row, fieldIndex int) (interface{}, error) {
+	field := &dt.fields[fieldIndex]
+	value := dt.FieldValue(row, fieldIndex)
+	if value == "" || dt.IsNull(row, fieldIndex) {
+		return nil, nil
+	}
+	switch field.Type {
+	case "N", "F", "Y":
+		r, ok := new(big.Rat).SetString(value)
+		if !ok {
+			return nil, errors.New("dbf: field '" + field.Name + "' has invalid number '" + value + "'")
+		}
+		return r, nil
+	}
+	// blank and unknown dates and logicals are nil
+	return typedValue(field, value), nil
+}
+
+// compareAggValues compares values of aggValue, nil is the smallest.
+func compareAggValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	switch x := a.(type) {
+	case *big.Rat:
+		return x.Cmp(b.(*big.Rat))
+	case time.Time:
+		return x.Compare(b.(time.Time))
+	case bool:
+		y := b.(bool)
+		switch {
+		case x == y:
+			return 0
+		case y:
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a.(string), b.(string))
+}
+
+// aggregate computes aggregates over not deleted rows of the iterator.
+func (dt *DbfTable) aggregate(opts []IteratorOption, aggs ...Aggregate) ([]interface{}, error) {
+	accs := make([]*accumulator, len(aggs))
+	for j, a := range aggs {
+		acc, err := dt.accumulator(a)
+		if err != nil {
+			return nil, err
+		}
+		accs[j] = acc
+	}
+	it := dt.NewIterator(opts...)
+	for it.Next() {
+		for _, acc := range accs {
+			if err := acc.add(dt, it.Index()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	results := make([]interface{}, len(accs))
+	for j, acc := range accs {
+		results[j] = acc.result()
+	}
+	return results, nil
+}
+
+// Sum returns exact total of N, F or Y field over not deleted rows, blank cells
+// are skipped. Options, such as Where or WhereExpr, select rows.
+func (dt *DbfTable) Sum(field string, opts ...IteratorOption) (*big.Rat, error) {
+	results, err := dt.aggregate(opts, SumOf(field))
+	if err != nil {
+		return nil, err
+	}
+	return results[0].(*big.Rat), nil
+}
+
+// Avg returns exact average of N, F or Y field, nil when all cells are blank.
+func (dt *DbfTable) Avg(field string, opts ...IteratorOption) (*big.Rat, error) {
+	results, err := dt.aggregate(opts, AvgOf(field))
+	if err != nil || results[0] == nil {
+		return nil, err
+	}
+	return results[0].(*big.Rat), nil
+}
+
+// Min returns the smallest value of the field as MinOf, nil when all cells
+// are blank.
+func (dt *DbfTable) Min(field string, opts ...IteratorOption) (interface{}, error) {
+	results, err := dt.aggregate(opts, MinOf(field))
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// Max returns the largest value of the field as MaxOf.
+func (dt *DbfTable) Max(field string, opts ...IteratorOption) (interface{}, error) {
+	results, err := dt.aggregate(opts, MaxOf(field))
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// Count returns number of not deleted rows selected by options, for example
+// dt.Count(WhereExpr("AMOUNT > 100")).
+func (dt *DbfTable) Count(opts ...IteratorOption) (int, error) {
+	results, err := dt.aggregate(opts, CountRows())
+	if err != nil {
+		return 0, err
+	}
+	return results[0].(int), nil
+}
+
+// Grouping groups rows by values of key fields, see GroupBy.
+type Grouping struct {
+	dt   *DbfTable
+	keys []string
+	opts []IteratorOption
+}
+
+// Group is result of Grouping.Agg: values of key fields, typed as by MinOf,
+// and results of aggregates in order they were given.
+type Group struct {
+	Keys   []interface{}
+	Values []interface{}
+}
+
+// GroupBy groups not deleted rows by values of key fields, aggregates are
+// computed by Agg:
+//
+//	groups, err := dt.GroupBy("STATE").Agg(dbf.CountRows(), dbf.SumOf("AMOUNT"))
+func (dt *DbfTable) GroupBy(keys ...string) *Grouping {
+	return &Grouping{dt: dt, keys: keys}
+}
+
+// With selects rows by iterator options, such as Where or WhereExpr.
+func (g *Grouping) With(opts ...IteratorOption) *Grouping {
+	g.opts = append(g.opts, opts...)
+	return g
+}
+
+// Agg computes aggregates for every group. Groups are ordered by keys, blank
+// keys first.
+func (g *Grouping) Agg(aggs ...Aggregate) ([]Group, error) {
+	dt := g.dt
+	keyFields := make([]int, len(g.keys))
+	for j, key := range g.keys {
+		i := dt.fieldIndex(key)
+		if i < 0 {
+			return nil, errors.New("dbf: group field '" + key + "' does not exist")
+		}
+		keyFields[j] = i
+	}
+	for _, a := range aggs {
+		if _, err := dt.accumulator(a); err != nil {
+			return nil, err
+		}
+	}
+
+	type group struct {
+		Group
+		accs []*accumulator
+	}
+	groups := []*group{}
+	byKey := map[string]*group{}
+	var b strings.Builder
+	it := dt.NewIterator(g.opts...)
+	for it.Next() {
+		row := it.Index()
+		b.Reset()
+		for _, i := range keyFields {
+			b.WriteString(dt.FieldValue(row, i))
+			b.WriteByte(0)
+		}
+		grp := byKey[b.String()]
+		if grp == nil {
+			grp = &group{}
+			for _, i := range keyFields {
+				v, err := dt.aggValue(row, i)
+				if err != nil {
+					return nil, err
+				}
+				grp.Keys = append(grp.Keys, v)
+			}
+			for _, a := range aggs {
+				acc, _ := dt.accumulator(a)
+				grp.accs = append(grp.accs, acc)
+			}
+			groups = append(groups, grp)
+			byKey[b.String()] = grp
+		}
+		for _, acc := range grp.accs {
+			if err := acc.add(dt, row); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(groups, func(a, b int) bool {
+		for j := range keyFields {
+			if c := compareAggValues(groups[a].Keys[j], groups[b].Keys[j]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	result := make([]Group, len(groups))
+	for k, grp := range groups {
+		for _, acc := range grp.accs {
+			grp.Values = append(grp.Values, acc.result())
+		}
+		result[k] = grp.Group
+	}
+	return result, nil
+}
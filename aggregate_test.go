@@ -0,0 +1,86 @@
+package dbf
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestAggregates(t *testing.T) {
+	db := New()
+	db.AddTextField("state", 2)
+	db.AddNumberField("amount", 14, 2)
+	db.AddDateField("day")
+	for _, m := range []map[string]interface{}{
+		{"state": "NY", "amount": 0.1, "day": "2020-03-01"},
+		{"state": "NY", "amount": 0.2, "day": "2020-01-15"},
+		{"state": "CA", "amount": 1234567890.05, "day": nil},
+		{"state": "CA", "amount": nil, "day": "2021-06-30"},
+		{"state": "", "amount": 5, "day": "2019-12-31"},
+		{"state": "TX", "amount": 1000, "day": "2022-01-01"},
+	} {
+		if _, err := db.AppendMap(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Delete(5)
+
+	sum, err := db.Sum("amount")
+	if err != nil || sum.FloatString(2) != "1234567895.35" {
+		t.Fatal("unexpected sum:", sum, err)
+	}
+	sum, err = db.Sum("amount", Where(func(dt *DbfTable, row int) bool { return dt.FieldValue(row, 0) == "NY" }))
+	if err != nil || sum.Cmp(big.NewRat(3, 10)) != 0 {
+		t.Fatal("expected exact 0.3 found:", sum, err)
+	}
+	avg, err := db.Avg("amount")
+	if err != nil || avg.FloatString(4) != "308641973.8375" {
+		t.Fatal("unexpected average, blank amount must be skipped:", avg, err)
+	}
+	if avg, err := db.Avg("amount", Bounds(3, 4)); err != nil || avg != nil {
+		t.Fatal("expected nil average of blank cells found:", avg, err)
+	}
+	min, err := db.Min("day")
+	if err != nil || min != time.Date(2019, 12, 31, 0, 0, 0, 0, time.UTC) {
+		t.Fatal("unexpected min day:", min, err)
+	}
+	max, err := db.Max("amount")
+	if err != nil || max.(*big.Rat).FloatString(2) != "1234567890.05" {
+		t.Fatal("unexpected max amount:", max, err)
+	}
+	if n, err := db.Count(); err != nil || n != 5 {
+		t.Fatal("expected 5 rows found:", n, err)
+	}
+	if _, err := db.Sum("day"); err == nil {
+		t.Fatal("expected error for sum of dates")
+	}
+	if _, err := db.Max("missing"); err == nil {
+		t.Fatal("expected error for missing field")
+	}
+
+	groups, err := db.GroupBy("State").Agg(CountRows(), CountOf("amount"), SumOf("Amount"), MaxOf("day"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 3 {
+		t.Fatal("expected 3 groups found:", len(groups))
+	}
+	// blank key is first
+	if groups[0].Keys[0] != nil || groups[1].Keys[0] != "CA" || groups[2].Keys[0] != "NY" {
+		t.Fatal("unexpected group keys:", groups)
+	}
+	ca := groups[1].Values
+	if ca[0] != 2 || ca[1] != 1 || ca[2].(*big.Rat).FloatString(2) != "1234567890.05" || ca[3] != time.Date(2021, 6, 30, 0, 0, 0, 0, time.UTC) {
+		t.Fatal("unexpected CA group:", ca)
+	}
+	groups, err = db.GroupBy("state").With(Bounds(0, 2)).Agg(AvgOf("amount"))
+	if err != nil || len(groups) != 1 || groups[0].Values[0].(*big.Rat).FloatString(2) != "0.15" {
+		t.Fatal("unexpected NY average:", groups, err)
+	}
+	if _, err := db.GroupBy("nope").Agg(CountRows()); err == nil {
+		t.Fatal("expected error for missing group field")
+	}
+	if _, err := db.GroupBy("state").Agg(AvgOf("day")); err == nil {
+		t.Fatal("expected error for average of dates")
+	}
+}
@@ -0,0 +1,659 @@
+package dbf
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FoxPro compact compound .CDX index file layout.
+const (
+	cdxBlockSize  = 512
+	cdxHeaderSize = 1024
+	cdxMaxDepth   = 64 // protects against loops in broken files
+	cdxTagNameLen = 10
+	cdxNone       = 0xFFFFFFFF
+
+	cdxUnique   = 0x01
+	cdxFor      = 0x08
+	cdxCompact  = 0x20
+	cdxCompound = 0x40
+
+	cdxIndexNode = 0
+	cdxRootNode  = 1
+	cdxLeafNode  = 2
+
+	cdxLeafHeader     = 24
+	cdxInteriorHeader = 12
+)
+
+// Cdx is FoxPro compound .CDX index with one or more tags. Tags are kept in
+// memory and follow SetFieldValue, AddRecord, InsertRecord and Delete, call
+// Save to write them back to the file.
+type Cdx struct {
+	dt       *DbfTable
+	fileName string
+	tags     []*CdxTag
+}
+
+// CdxTag is one index order of Cdx file.
+type CdxTag struct {
+	cdx     *Cdx
+	order   *order
+	name    string
+	expr    string
+	forExpr string
+	keyLen  int
+	unique  bool
+	descend bool
+	binary  bool // numeric and date keys are padded with zeros instead of spaces
+}
+
+// CdxNumberKey encodes number the way FoxPro stores numeric keys, use it to Seek numeric tags.
+func CdxNumberKey(f float64) string {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, math.Float64bits(f))
+	if f >= 0 {
+		b[0] ^= 0x80
+	} else {
+		for i := range b {
+			b[i] ^= 0xFF
+		}
+	}
+	return string(b)
+}
+
+// CdxDateKey encodes date the way FoxPro stores date keys, use it to Seek date tags.
+func CdxDateKey(t time.Time) string {
+	if t.IsZero() {
+		return CdxNumberKey(0)
+	}
+	t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return CdxNumberKey(float64(t.Unix()/86400 + 2440588)) // julian day number
+}
+
+// cdxKey returns key function for key expression made of field names joined
+// with plus sign. Single numeric or date field gives FoxPro binary keys,
+// other expressions use fields as they are stored in the table.
+func (dt *DbfTable) cdxKey(expr string) (fn KeyFunc, keyLen int, bin bool, err error) {
+	name := strings.ToUpper(strings.TrimSpace(expr))
+	if i, ok := dt.fieldMap[name]; ok {
+		switch dt.fields[i].Type {
+		case "N":
+			fn = func(dt *DbfTable, row int) (string, bool) {
+				f, _ := strconv.ParseFloat(dt.FieldValue(row, i), 64)
+				return CdxNumberKey(f), true
+			}
+			return fn, 8, true, nil
+		case "D":
+			fn = func(dt *DbfTable, row int) (string, bool) {
+				t, _ := time.Parse("20060102", dt.FieldValue(row, i))
+				return CdxDateKey(t), true
+			}
+			return fn, 8, true, nil
+		}
+	}
+	fn, keyLen, err = dt.keyFunc(expr)
+	return fn, keyLen, false, err
+}
+
+// OpenCdx reads .CDX compound index file for the table. Tags with key
+// expressions made of field names joined with plus sign and without FOR
+// condition are maintained when the table changes, importing dbf/expr adds
+// other expressions and FOR conditions. Remaining tags can be used for seeks
+// and ordered iteration only.
+func (dt *DbfTable) OpenCdx(fileName string) (*Cdx, error) {
+	s, err := readFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if len(s) < cdxHeaderSize {
+		return nil, errors.New("dbf: cdx file is too short")
+	}
+
+	c := &Cdx{dt: dt, fileName: fileName}
+	dir, _, err := cdxReadTree(s, 0, dt.NumRecords()+1, false, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range dir {
+		// directory keys point to tag headers, see encode
+		t, err := c.readTag(s, strings.TrimRight(e.key, " \x00"), uint32(e.row+1))
+		if err != nil {
+			return nil, err
+		}
+		c.tags = append(c.tags, t)
+	}
+	for _, t := range c.tags {
+		dt.attach(t.order)
+	}
+	return c, nil
+}
+
+// CreateCdx creates compound index file without tags, use AddTag to add them.
+func (dt *DbfTable) CreateCdx(fileName string) (*Cdx, error) {
+	c := &Cdx{dt: dt, fileName: fileName}
+	if err := c.Save(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// readTag reads tag header and all keys of the tag.
+func (c *Cdx) readTag(s []byte, name string, offset uint32) (*CdxTag, error) {
+	if int(offset)+cdxHeaderSize > len(s) {
+		return nil, errors.New("dbf: cdx file is corrupted")
+	}
+	h := s[offset : offset+cdxHeaderSize]
+	t := &CdxTag{cdx: c, name: name}
+	t.keyLen = int(binary.LittleEndian.Uint16(h[12:]))
+	t.unique = h[14]&cdxUnique != 0
+	t.descend = binary.LittleEndian.Uint16(h[502:]) != 0
+
+	pool := h[512:]
+	forPos, forLen := int(binary.LittleEndian.Uint16(h[504:])), int(binary.LittleEndian.Uint16(h[506:]))
+	keyPos, keyLen := int(binary.LittleEndian.Uint16(h[508:])), int(binary.LittleEndian.Uint16(h[510:]))
+	if keyPos+keyLen > len(pool) || forPos+forLen > len(pool) {
+		return nil, errors.New("dbf: cdx file is corrupted")
+	}
+	t.expr = cString(pool[keyPos : keyPos+keyLen])
+	if h[14]&cdxFor != 0 {
+		t.forExpr = cString(pool[forPos : forPos+forLen])
+	}
+
+	keyFn, _, bin, err := c.dt.cdxKey(t.expr)
+	if err == nil {
+		keyFn, err = c.dt.forFunc(keyFn, t.forExpr)
+	}
+	if err != nil {
+		keyFn = nil // tag can be read but not maintained
+	}
+	t.binary = bin
+
+	entries, _, err := cdxReadTree(s, offset, c.dt.NumRecords(), t.binary, false)
+	if err != nil {
+		return nil, err
+	}
+	t.order = newOrder(c.dt, t.fixKey(keyFn))
+	t.order.unique = t.unique
+	t.order.load(entries)
+	if t.forExpr == "" {
+		t.order.lookupField(t.expr, true, t.unique)
+	}
+	return t, nil
+}
+
+// Tags returns all tags of the index.
+func (c *Cdx) Tags() []*CdxTag {
+	return c.tags
+}
+
+// Tag finds tag by case insensitive name, returns nil if not found.
+func (c *Cdx) Tag(name string) *CdxTag {
+	for _, t := range c.tags {
+		if strings.EqualFold(t.name, name) {
+			return t
+		}
+	}
+	return nil
+}
+
+// AddTag builds new tag for key expression made of field names joined with
+// plus sign, single numeric and date fields are indexed as FoxPro binary keys.
+func (c *Cdx) AddTag(name, expr string) (*CdxTag, error) {
+	keyFn, keyLen, bin, err := c.dt.cdxKey(expr)
+	if err != nil {
+		return nil, err
+	}
+	t, err := c.AddTagFunc(name, expr, "", keyLen, keyFn)
+	if err != nil {
+		return nil, err
+	}
+	t.binary = bin
+	t.order.lookupField(expr, true, t.unique)
+	return t, nil
+}
+
+// AddTagFunc builds new tag with custom key function. Expressions are stored in
+// the file for other programs, keyFn must implement both of them: rows for which
+// it returns false are left out of the tag.
+func (c *Cdx) AddTagFunc(name, expr, forExpr string, keyLen int, keyFn KeyFunc) (*CdxTag, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if name == "" || len(name) > cdxTagNameLen {
+		return nil, errors.New("dbf: cdx tag name must be 1 to 10 characters long")
+	}
+	if c.Tag(name) != nil {
+		return nil, errors.New("dbf: cdx tag '" + name + "' already exist")
+	}
+	if keyLen < 1 || keyLen > 240 {
+		return nil, errors.New("dbf: cdx key length must be between 1 and 240")
+	}
+	if len(expr)+len(forExpr)+2 > cdxBlockSize {
+		return nil, errors.New("dbf: cdx key expression is too long")
+	}
+
+	t := &CdxTag{cdx: c, name: name, expr: expr, forExpr: forExpr, keyLen: keyLen}
+	t.order = newOrder(c.dt, t.fixKey(keyFn))
+	t.order.build()
+	c.tags = append(c.tags, t)
+	c.dt.attach(t.order)
+	return t, nil
+}
+
+// DeleteTag removes tag from the index.
+func (c *Cdx) DeleteTag(name string) error {
+	for i, t := range c.tags {
+		if strings.EqualFold(t.name, name) {
+			c.dt.detach(t.order)
+			c.tags = append(c.tags[:i], c.tags[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("dbf: cdx tag '" + name + "' does not exist")
+}
+
+// Close detaches all tags from the table, they no longer follow table changes.
+func (c *Cdx) Close() {
+	for _, t := range c.tags {
+		c.dt.detach(t.order)
+	}
+}
+
+// Save writes index with all tags to its file.
+func (c *Cdx) Save() error {
+	for _, t := range c.tags {
+		if err := t.order.check(); err != nil {
+			return errors.New("dbf: cdx tag " + t.name + ": " + err.Error())
+		}
+	}
+	f, err := os.Create(c.fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(c.encode())
+	return err
+}
+
+// encode whole file. Tags are written first, tag directory goes last because
+// its keys point to tag headers.
+func (c *Cdx) encode() []byte {
+	s := make([]byte, cdxHeaderSize)
+
+	tags := append([]*CdxTag(nil), c.tags...)
+	sort.Slice(tags, func(i, j int) bool { return tags[i].name < tags[j].name })
+
+	dir := []orderEntry{}
+	for _, t := range tags {
+		offset := len(s)
+		s = append(s, make([]byte, cdxHeaderSize)...)
+		root := cdxWriteTree(&s, t.order.sorted(), t.keyLen, t.binary)
+
+		opts := byte(cdxCompact)
+		if t.unique {
+			opts |= cdxUnique
+		}
+		if t.forExpr != "" {
+			opts |= cdxFor
+		}
+		cdxHeader(s[offset:offset+cdxHeaderSize], root, t.keyLen, opts, t.descend, t.expr, t.forExpr)
+		// keys store row+1 as record number, so row is set to header offset-1
+		dir = append(dir, orderEntry{key: padKey(t.name, cdxTagNameLen), row: offset - 1})
+	}
+
+	root := cdxWriteTree(&s, dir, cdxTagNameLen, false)
+	cdxHeader(s[:cdxHeaderSize], root, cdxTagNameLen, cdxCompact|cdxCompound, false, "", "")
+	return s
+}
+
+// cdxHeader fills index header block.
+func cdxHeader(h []byte, root uint32, keyLen int, opts byte, descend bool, expr, forExpr string) {
+	binary.LittleEndian.PutUint32(h[0:], root)
+	binary.LittleEndian.PutUint32(h[4:], cdxNone)
+	binary.LittleEndian.PutUint16(h[12:], uint16(keyLen))
+	h[14] = opts
+	h[15] = 1 // signature
+	if descend {
+		binary.LittleEndian.PutUint16(h[502:], 1)
+	}
+	// expression pool holds zero terminated key and FOR expressions
+	binary.LittleEndian.PutUint16(h[504:], uint16(len(expr)+1))
+	binary.LittleEndian.PutUint16(h[506:], uint16(len(forExpr)+1))
+	binary.LittleEndian.PutUint16(h[508:], 0)
+	binary.LittleEndian.PutUint16(h[510:], uint16(len(expr)+1))
+	copy(h[512:], expr)
+	copy(h[512+len(expr)+1:], forExpr)
+}
+
+// fixKey makes sure keys are exactly key length long.
+func (t *CdxTag) fixKey(keyFn KeyFunc) KeyFunc {
+	if keyFn == nil {
+		return nil
+	}
+	return func(dt *DbfTable, row int) (string, bool) {
+		key, ok := keyFn(dt, row)
+		return padKey(key, t.keyLen), ok
+	}
+}
+
+// Name of the tag.
+func (t *CdxTag) Name() string {
+	return t.name
+}
+
+// Expr returns tag key expression.
+func (t *CdxTag) Expr() string {
+	return t.expr
+}
+
+// For returns tag FOR condition, empty if tag has none.
+func (t *CdxTag) For() string {
+	return t.forExpr
+}
+
+// Descending reports whether tag is iterated from the highest key.
+func (t *CdxTag) Descending() bool {
+	return t.descend
+}
+
+// Seek finds first row with key starting with key, deleted rows are skipped.
+// Numeric and date tags need keys encoded with CdxNumberKey and CdxDateKey.
+func (t *CdxTag) Seek(key string) (row int, ok bool) {
+	return t.order.seekRow(key)
+}
+
+// Iterator walks not deleted rows in tag order, see UseIndex for more options.
+func (t *CdxTag) Iterator(opts ...IteratorOption) *Iterator {
+	return t.cdx.dt.NewIterator(append([]IteratorOption{UseIndex(t)}, opts...)...)
+}
+
+// indexOrder returns order of the tag, descending tags are walked in reverse.
+func (t *CdxTag) indexOrder() (*order, bool) {
+	return t.order, t.descend
+}
+
+// Reindex rebuilds tag from the table.
+func (t *CdxTag) Reindex() error {
+	if t.order.keyFn == nil {
+		return errors.New("dbf: can not reindex, tag '" + t.name + "' expression is not supported")
+	}
+	t.order.build()
+	return nil
+}
+
+// cdxReadTree reads B-tree starting with header at offset and returns keys in
+// order. Keys of the tag directory point to headers, not rows.
+func cdxReadTree(s []byte, offset uint32, maxRow int, bin bool, directory bool) ([]orderEntry, int, error) {
+	if int(offset)+cdxHeaderSize > len(s) {
+		return nil, 0, errors.New("dbf: cdx file is corrupted")
+	}
+	h := s[offset:]
+	root := leUint32(h[0:])
+	keyLen := int(leUint16(h[12:]))
+	if keyLen < 1 || keyLen > cdxBlockSize-cdxInteriorHeader-8 {
+		return nil, 0, errors.New("dbf: cdx file has invalid key size")
+	}
+
+	entries := []orderEntry{}
+	if err := cdxReadNode(s, root, keyLen, bin, 0, &entries); err != nil {
+		return nil, 0, err
+	}
+	if !directory {
+		// skip keys pointing outside of the table
+		valid := entries[:0]
+		for _, e := range entries {
+			if e.row >= 0 && e.row < maxRow {
+				valid = append(valid, e)
+			}
+		}
+		entries = valid
+	}
+	return entries, keyLen, nil
+}
+
+// cdxReadNode appends keys of the node and its children in order.
+func cdxReadNode(s []byte, offset uint32, keyLen int, bin bool, depth int, entries *[]orderEntry) error {
+	if depth > cdxMaxDepth || offset == cdxNone || int(offset)+cdxBlockSize > len(s) {
+		return errors.New("dbf: cdx file is corrupted")
+	}
+	node := s[offset : offset+cdxBlockSize]
+	attr := leUint16(node[0:])
+	count := int(leUint16(node[2:]))
+
+	if attr&cdxLeafNode == 0 {
+		if cdxInteriorHeader+count*(keyLen+8) > cdxBlockSize {
+			return errors.New("dbf: cdx file is corrupted")
+		}
+		for i := 0; i < count; i++ {
+			item := node[cdxInteriorHeader+i*(keyLen+8):]
+			child := beUint32(item[keyLen+4:])
+			if err := cdxReadNode(s, child, keyLen, bin, depth+1, entries); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	recMask := leUint32(node[14:])
+	dupMask, trailMask := uint32(node[18]), uint32(node[19])
+	recBits, dupBits := uint(node[20]), uint(node[21])
+	infoLen := int(node[23])
+	if infoLen < 1 || infoLen > 8 || cdxLeafHeader+count*infoLen > cdxBlockSize {
+		return errors.New("dbf: cdx file is corrupted")
+	}
+
+	pad := byte(' ')
+	if bin {
+		pad = 0
+	}
+	prev := make([]byte, keyLen)
+	end := cdxBlockSize
+	for i := 0; i < count; i++ {
+		var info uint64
+		for j := infoLen - 1; j >= 0; j-- {
+			info = info<<8 | uint64(node[cdxLeafHeader+i*infoLen+j])
+		}
+		recno := uint32(info) & recMask
+		dup := int(uint32(info>>recBits) & dupMask)
+		trail := int(uint32(info>>(recBits+dupBits)) & trailMask)
+		n := keyLen - dup - trail
+		if n < 0 || end-n < cdxLeafHeader+count*infoLen {
+			return errors.New("dbf: cdx file is corrupted")
+		}
+		end -= n
+
+		key := make([]byte, keyLen)
+		copy(key, prev[:dup])
+		copy(key[dup:], node[end:end+n])
+		for j := keyLen - trail; j < keyLen; j++ {
+			key[j] = pad
+		}
+		prev = key
+		*entries = append(*entries, orderEntry{key: string(key), row: int(recno) - 1})
+	}
+	return nil
+}
+
+// cdxLeaf is compressed leaf node being built.
+type cdxLeaf struct {
+	entries []orderEntry
+	info    []uint64
+	data    []byte // key bytes, in key order; stored backwards from node end
+}
+
+// cdxWriteTree appends nodes of B-tree holding entries to s and returns offset
+// of the root node. Leaves are filled as much as compression allows.
+func cdxWriteTree(s *[]byte, entries []orderEntry, keyLen int, bin bool) uint32 {
+	pad := byte(' ')
+	if bin {
+		pad = 0
+	}
+	maxRec := 0
+	for _, e := range entries {
+		if e.row+1 > maxRec {
+			maxRec = e.row + 1
+		}
+	}
+	recBits := bitsFor(uint64(maxRec))
+	dupBits := bitsFor(uint64(keyLen))
+	infoLen := (recBits + 2*dupBits + 7) / 8
+	if infoLen < 3 {
+		infoLen = 3
+	}
+	recBits = infoLen*8 - 2*dupBits
+
+	// pack leaves
+	leaves := []*cdxLeaf{{}}
+	free := cdxBlockSize - cdxLeafHeader
+	var prev string
+	for _, e := range entries {
+		key := e.key
+		trail := 0
+		for trail < keyLen && key[keyLen-1-trail] == pad {
+			trail++
+		}
+		leaf := leaves[len(leaves)-1]
+		dup := 0
+		if len(leaf.entries) > 0 {
+			for dup < keyLen-trail && key[dup] == prev[dup] {
+				dup++
+			}
+		}
+		if n := keyLen - dup - trail; n+infoLen > free {
+			// start new leaf, first key of a leaf is not compressed against previous one
+			leaf = &cdxLeaf{}
+			leaves = append(leaves, leaf)
+			free = cdxBlockSize - cdxLeafHeader
+			dup = 0
+		}
+		n := keyLen - dup - trail
+		leaf.entries = append(leaf.entries, e)
+		leaf.info = append(leaf.info, uint64(e.row+1)|uint64(dup)<<uint(recBits)|uint64(trail)<<uint(recBits+dupBits))
+		leaf.data = append(leaf.data, key[dup:dup+n]...)
+		free -= n + infoLen
+		prev = key
+	}
+
+	// write leaves, they are linked left to right
+	base := uint32(len(*s))
+	level := []uint32{}
+	for i, leaf := range leaves {
+		node := make([]byte, cdxBlockSize)
+		attr := uint16(cdxLeafNode)
+		if len(leaves) == 1 {
+			attr |= cdxRootNode
+		}
+		cdxLinks(node, attr, len(leaf.entries), base, i, len(leaves))
+		used := cdxLeafHeader + len(leaf.info)*infoLen + len(leaf.data)
+		putLeUint16(node[12:], uint16(cdxBlockSize-used))
+		putLeUint32(node[14:], uint32(1)<<uint(recBits)-1)
+		node[18] = byte(1<<uint(dupBits) - 1)
+		node[19] = byte(1<<uint(dupBits) - 1)
+		node[20] = byte(recBits)
+		node[21] = byte(dupBits)
+		node[22] = byte(dupBits)
+		node[23] = byte(infoLen)
+		for j, info := range leaf.info {
+			for k := 0; k < infoLen; k++ {
+				node[cdxLeafHeader+j*infoLen+k] = byte(info >> uint(8*k))
+			}
+		}
+		// first key is stored at the very end of the node
+		end := cdxBlockSize
+		at := 0
+		for j := range leaf.entries {
+			info := leaf.info[j]
+			dup := int(info>>uint(recBits)) & (1<<uint(dupBits) - 1)
+			trail := int(info>>uint(recBits+dupBits)) & (1<<uint(dupBits) - 1)
+			n := keyLen - dup - trail
+			end -= n
+			copy(node[end:], leaf.data[at:at+n])
+			at += n
+		}
+		*s = append(*s, node...)
+		level = append(level, base+uint32(i*cdxBlockSize))
+	}
+
+	// last key of every child is used as its key in the parent node
+	lastKeys := []orderEntry{}
+	for _, leaf := range leaves {
+		if len(leaf.entries) > 0 {
+			lastKeys = append(lastKeys, leaf.entries[len(leaf.entries)-1])
+		} else {
+			lastKeys = append(lastKeys, orderEntry{key: strings.Repeat(string(pad), keyLen)})
+		}
+	}
+
+	perNode := (cdxBlockSize - cdxInteriorHeader) / (keyLen + 8)
+	for len(level) > 1 {
+		base = uint32(len(*s))
+		n := (len(level) + perNode - 1) / perNode
+		nextLevel, nextKeys := []uint32{}, []orderEntry{}
+		for i := 0; i < n; i++ {
+			from, to := i*perNode, (i+1)*perNode
+			if to > len(level) {
+				to = len(level)
+			}
+			node := make([]byte, cdxBlockSize)
+			attr := uint16(cdxIndexNode)
+			if n == 1 {
+				attr |= cdxRootNode
+			}
+			cdxLinks(node, attr, to-from, base, i, n)
+			for j := from; j < to; j++ {
+				item := node[cdxInteriorHeader+(j-from)*(keyLen+8):]
+				copy(item, lastKeys[j].key)
+				putBeUint32(item[keyLen:], uint32(lastKeys[j].row+1))
+				putBeUint32(item[keyLen+4:], level[j])
+			}
+			*s = append(*s, node...)
+			nextLevel = append(nextLevel, base+uint32(i*cdxBlockSize))
+			nextKeys = append(nextKeys, lastKeys[to-1])
+		}
+		level, lastKeys = nextLevel, nextKeys
+	}
+	return level[0]
+}
+
+// cdxLinks writes node attributes, key count and pointers to siblings of node i
+// of n nodes written one after another from base.
+func cdxLinks(node []byte, attr uint16, count int, base uint32, i, n int) {
+	putLeUint16(node[0:], attr)
+	putLeUint16(node[2:], uint16(count))
+	left, right := uint32(cdxNone), uint32(cdxNone)
+	if i > 0 {
+		left = base + uint32((i-1)*cdxBlockSize)
+	}
+	if i < n-1 {
+		right = base + uint32((i+1)*cdxBlockSize)
+	}
+	putLeUint32(node[4:], left)
+	putLeUint32(node[8:], right)
+}
+
+// bitsFor returns number of bits needed to store x.
+func bitsFor(x uint64) int {
+	n := 0
+	for ; x > 0; x >>= 1 {
+		n++
+	}
+	return n
+}
+
+func leUint16(b []byte) uint16 { return binary.LittleEndian.Uint16(b) }
+
+func leUint32(b []byte) uint32 { return binary.LittleEndian.Uint32(b) }
+
+func beUint32(b []byte) uint32 { return binary.BigEndian.Uint32(b) }
+
+func putLeUint16(b []byte, v uint16) { binary.LittleEndian.PutUint16(b, v) }
+
+func putLeUint32(b []byte, v uint32) { binary.LittleEndian.PutUint32(b, v) }
+
+func putBeUint32(b []byte, v uint32) { binary.BigEndian.PutUint32(b, v) }
@@ -0,0 +1,85 @@
+package dbf
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+const tempcdx = "temp.cdx"
+
+func TestCdx(t *testing.T) {
+	db := New()
+	db.AddTextField("last", 12)
+	db.AddNumberField("num", 8, 2)
+	db.AddDateField("born")
+	n := 2000
+	for i := 0; i < n; i++ {
+		row := db.AddRecord()
+		db.SetFieldValue(row, 0, fmt.Sprintf("NAME%05d", (i*7919)%n))
+		db.SetFieldValue(row, 1, fmt.Sprintf("%.2f", float64(i%500-250)/4))
+		db.SetFieldValue(row, 2, fmt.Sprintf("2016%02d%02d", i%12+1, i%28+1))
+	}
+	defer os.Remove(tempcdx)
+
+	c, err := db.CreateCdx(tempcdx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range [][2]string{{"last", "LAST"}, {"num", "NUM"}, {"born", "BORN"}, {"lastnum", "LAST+NUM"}} {
+		if _, err := c.AddTag(tag[0], tag[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	c, err = db.OpenCdx(tempcdx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Tags()) != 4 {
+		t.Fatal("expected 4 tags found:", len(c.Tags()))
+	}
+	for _, tag := range c.Tags() {
+		keyFn, _, _, err := db.cdxKey(tag.Expr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkOrder(t, db, tag.Iterator(), keyFn, n)
+	}
+
+	num := c.Tag("NUM")
+	row, ok := num.Seek(CdxNumberKey(-62.5))
+	if !ok || db.FieldValue(row, 1) != "-62.50" {
+		t.Fatal("seek of numeric key failed:", ok, row)
+	}
+	iter := num.Iterator()
+	iter.Next()
+	if v := db.FieldValue(iter.Index(), 1); v != "-62.50" {
+		t.Fatal("smallest number expected to be -62.50 found:", v)
+	}
+
+	// tags follow table changes and survive save
+	db.SetFieldValue(row, 1, "999.99")
+	db.SetFieldValue(row, 0, "AAAA")
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	c, err = db.OpenCdx(tempcdx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, ok := c.Tag("last").Seek("AAAA"); !ok || r != row {
+		t.Fatal("seek of updated key failed")
+	}
+	if r, ok := c.Tag("num").Seek(CdxNumberKey(999.99)); !ok || r != row {
+		t.Fatal("seek of updated numeric key failed")
+	}
+	checkOrder(t, db, c.Tag("lastnum").Iterator(), func(dt *DbfTable, row int) (string, bool) {
+		return dt.FieldValue(row, 0) + fmt.Sprintf("%8s", dt.FieldValue(row, 1)), true
+	}, n)
+}
@@ -2,23 +2,50 @@ package main
 
 import (
 	"encoding/csv"
+	"flag"
+	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/tadvi/dbf"
 )
 
+// deletedColumn is the name of the marker column added with -deleted.
+const deletedColumn = "_DELETED"
+
+var (
+	cols    = flag.String("cols", "", "comma separated list of columns to dump, in output order")
+	where   = flag.String("where", "", "row filter, for example \"AMOUNT>100 && CITY=='Paris'\"")
+	limit   = flag.Int("limit", -1, "maximum number of rows to dump, -1 for all")
+	offset  = flag.Int("offset", 0, "number of matching rows to skip")
+	deleted = flag.Bool("deleted", false, "include deleted rows and add "+deletedColumn+" marker column")
+	datefmt = flag.String("datefmt", "", "Go time layout for date fields, for example 2006-01-02")
+	numfmt  = flag.String("numfmt", "", "fmt verb for numeric fields, for example %.2f")
+)
+
+func usage() {
+	log.Println("Usage:")
+	log.Println("    dbfdump [options] input.dbf [output.csv]")
+	log.Println()
+	log.Println("Options:")
+	flag.PrintDefaults()
+}
+
 func main() {
-	if len(os.Args) < 2 {
-		log.Fatal("Missing dbf file name as first parameter")
+	flag.Usage = usage
+	flag.Parse()
 
-		log.Println("\nUsage:")
-		log.Println("    dbfdump input.dbf [output.csv]\n")
+	if flag.NArg() < 1 {
+		usage()
+		log.Fatal("Missing dbf file name as first parameter")
 	}
-	dbffile := os.Args[1]
+	dbffile := flag.Arg(0)
 	csvfile := "output.csv"
-	if len(os.Args) > 2 {
-		csvfile = os.Args[2]
+	if flag.NArg() > 1 {
+		csvfile = flag.Arg(1)
 	}
 
 	save(dbffile, csvfile)
@@ -30,6 +57,19 @@ func save(dbffile, csvfile string) {
 		log.Fatal(err)
 	}
 
+	columns, err := selectColumns(db, *cols)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var filter cond
+	if *where != "" {
+		filter, err = parseWhere(db, *where)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	fl, err := os.Create(csvfile)
 	if err != nil {
 		log.Fatal(err)
@@ -39,18 +79,46 @@ func save(dbffile, csvfile string) {
 	defer w.Flush()
 
 	header := []string{}
-	for _, field := range db.Fields() {
-		header = append(header, field.Name)
+	if *deleted {
+		header = append(header, deletedColumn)
+	}
+	fields := db.Fields()
+	for _, col := range columns {
+		header = append(header, fields[col].Name)
 	}
 	if err := w.Write(header); err != nil {
 		log.Fatal(err)
 	}
 
-	// once we have both CSV and DBF open, write CSV while iterating rows
-	var count int
-	iter := db.NewIterator()
-	for iter.Next() {
-		arr := iter.Row()
+	// once we have both CSV and DBF open, write CSV while walking rows
+	var count, skipped int
+	for row := 0; row < db.NumRecords(); row++ {
+		if *limit >= 0 && count >= *limit {
+			break
+		}
+		isDeleted := db.IsDeleted(row)
+		if isDeleted && !*deleted {
+			continue
+		}
+		if filter != nil && !filter.match(row) {
+			continue
+		}
+		if skipped < *offset {
+			skipped++
+			continue
+		}
+
+		arr := []string{}
+		if *deleted {
+			marker := ""
+			if isDeleted {
+				marker = "*"
+			}
+			arr = append(arr, marker)
+		}
+		for _, col := range columns {
+			arr = append(arr, format(fields[col], db.FieldValue(row, col)))
+		}
 		if err := w.Write(arr); err != nil {
 			log.Fatal(err)
 		}
@@ -58,3 +126,57 @@ func save(dbffile, csvfile string) {
 	}
 	log.Println("Total records in CSV:", count)
 }
+
+// selectColumns translates -cols into field indexes, all fields when list is empty.
+func selectColumns(db *dbf.DbfTable, list string) ([]int, error) {
+	fields := db.Fields()
+	columns := []int{}
+	if strings.TrimSpace(list) == "" {
+		for i := range fields {
+			columns = append(columns, i)
+		}
+		return columns, nil
+	}
+
+	for _, name := range strings.Split(list, ",") {
+		col := fieldIndex(db, name)
+		if col < 0 {
+			return nil, fmt.Errorf("column '%s' does not exist", strings.TrimSpace(name))
+		}
+		columns = append(columns, col)
+	}
+	return columns, nil
+}
+
+// fieldIndex finds field by case insensitive name, returns -1 if not found.
+func fieldIndex(db *dbf.DbfTable, name string) int {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	for i, field := range db.Fields() {
+		if field.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// format value according to -datefmt and -numfmt options.
+func format(field dbf.DbfField, value string) string {
+	if value == "" {
+		return value
+	}
+	switch field.Type {
+	case "D":
+		if *datefmt != "" {
+			if t, err := time.Parse("20060102", value); err == nil {
+				return t.Format(*datefmt)
+			}
+		}
+	case "N":
+		if *numfmt != "" {
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				return fmt.Sprintf(*numfmt, f)
+			}
+		}
+	}
+	return value
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/tadvi/dbf"
+)
+
+// cond is compiled -where expression.
+type cond interface {
+	match(row int) bool
+}
+
+type andCond struct{ left, right cond }
+
+func (c andCond) match(row int) bool { return c.left.match(row) && c.right.match(row) }
+
+type orCond struct{ left, right cond }
+
+func (c orCond) match(row int) bool { return c.left.match(row) || c.right.match(row) }
+
+type notCond struct{ c cond }
+
+func (c notCond) match(row int) bool { return !c.c.match(row) }
+
+// operand is either a field reference or a literal.
+type operand struct {
+	field int // -1 for literals
+	typ   string
+	value string
+}
+
+type cmpCond struct {
+	db          *dbf.DbfTable
+	op          string
+	left, right operand
+}
+
+func (o operand) get(db *dbf.DbfTable, row int) string {
+	if o.field < 0 {
+		return o.value
+	}
+	return db.FieldValue(row, o.field)
+}
+
+func (c cmpCond) match(row int) bool {
+	a, b := c.left.get(c.db, row), c.right.get(c.db, row)
+
+	var r int
+	switch {
+	case c.left.typ == "N" || c.right.typ == "N":
+		x, errx := strconv.ParseFloat(a, 64)
+		y, erry := strconv.ParseFloat(b, 64)
+		if errx != nil || erry != nil {
+			// blank or broken numbers never match
+			return c.op == "!="
+		}
+		switch {
+		case x < y:
+			r = -1
+		case x > y:
+			r = 1
+		}
+	case c.left.typ == "L" || c.right.typ == "L":
+		r = strings.Compare(logical(a), logical(b))
+	default:
+		r = strings.Compare(a, b)
+	}
+
+	switch c.op {
+	case "=":
+		return r == 0
+	case "!=":
+		return r != 0
+	case "<":
+		return r < 0
+	case "<=":
+		return r <= 0
+	case ">":
+		return r > 0
+	case ">=":
+		return r >= 0
+	}
+	return false
+}
+
+// logical normalizes L field values so that 't', 'Y' and 'true' compare equal.
+func logical(s string) string {
+	switch strings.ToLower(s) {
+	case "t", "y", "true", ".t.":
+		return "T"
+	}
+	return "F"
+}
+
+// dateLayouts accepted for literals compared against D fields.
+var dateLayouts = []string{"20060102", "2006-01-02", "01/02/2006"}
+
+type token struct {
+	kind  byte // 'i' ident, 's' string, 'n' number, 'o' operator, '(' and ')'
+	value string
+}
+
+func tokenize(s string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(s); {
+		ch := s[i]
+		switch {
+		case ch == ' ' || ch == '\t':
+			i++
+		case ch == '(' || ch == ')':
+			tokens = append(tokens, token{kind: ch})
+			i++
+		case ch == '\'' || ch == '"':
+			end := strings.IndexByte(s[i+1:], ch)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			tokens = append(tokens, token{kind: 's', value: s[i+1 : i+1+end]})
+			i += end + 2
+		case strings.ContainsRune("=!<>&|", rune(ch)):
+			op := string(ch)
+			if i+1 < len(s) && strings.ContainsRune("=&|>", rune(s[i+1])) {
+				op = s[i : i+2]
+			}
+			i += len(op)
+			switch op {
+			case "==":
+				op = "="
+			case "<>":
+				op = "!="
+			case "=", "!=", "<", "<=", ">", ">=", "&&", "||", "!":
+			default:
+				return nil, fmt.Errorf("unknown operator '%s' at %d", op, i-len(op))
+			}
+			tokens = append(tokens, token{kind: 'o', value: op})
+		case ch == '-' || ch == '.' || unicode.IsDigit(rune(ch)):
+			j := i + 1
+			for j < len(s) && (s[j] == '.' || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			tokens = append(tokens, token{kind: 'n', value: s[i:j]})
+			i = j
+		case ch == '_' || unicode.IsLetter(rune(ch)):
+			j := i + 1
+			for j < len(s) && (s[j] == '_' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			word := s[i:j]
+			switch strings.ToLower(word) {
+			case "and":
+				tokens = append(tokens, token{kind: 'o', value: "&&"})
+			case "or":
+				tokens = append(tokens, token{kind: 'o', value: "||"})
+			case "not":
+				tokens = append(tokens, token{kind: 'o', value: "!"})
+			default:
+				tokens = append(tokens, token{kind: 'i', value: word})
+			}
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected character '%c' at %d", ch, i)
+		}
+	}
+	return tokens, nil
+}
+
+// parser for -where expressions. Grammar:
+//
+//	or      = and { "||" and }
+//	and     = unary { "&&" unary }
+//	unary   = "!" unary | "(" or ")" | operand op operand
+//	operand = FIELD | 'string' | number
+type parser struct {
+	db     *dbf.DbfTable
+	tokens []token
+	pos    int
+}
+
+// parseWhere compiles filter expression against table fields.
+func parseWhere(db *dbf.DbfTable, s string) (cond, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{db: db, tokens: tokens}
+	c, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s' in filter", p.tokens[p.pos].value)
+	}
+	return c, nil
+}
+
+func (p *parser) peek() token {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return token{}
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) parseOr() (cond, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == 'o' && p.peek().value == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orCond{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (cond, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == 'o' && p.peek().value == "&&" {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andCond{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (cond, error) {
+	t := p.peek()
+	switch {
+	case t.kind == 'o' && t.value == "!":
+		p.next()
+		c, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notCond{c}, nil
+	case t.kind == '(':
+		p.next()
+		c, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != ')' {
+			return nil, fmt.Errorf("missing ')' in filter")
+		}
+		return c, nil
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	op := p.next()
+	if op.kind != 'o' || op.value == "&&" || op.value == "||" || op.value == "!" {
+		return nil, fmt.Errorf("expected comparison operator after '%s'", left.value)
+	}
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if left.field < 0 && right.field < 0 {
+		return nil, fmt.Errorf("comparison '%s %s %s' does not reference a field", left.value, op.value, right.value)
+	}
+
+	// literals compared against date fields can be written in common layouts
+	for _, pair := range [][2]*operand{{&left, &right}, {&right, &left}} {
+		if pair[0].typ == "D" && pair[1].field < 0 {
+			for _, layout := range dateLayouts {
+				if t, err := time.Parse(layout, pair[1].value); err == nil {
+					pair[1].value = t.Format("20060102")
+					break
+				}
+			}
+		}
+	}
+	return cmpCond{db: p.db, op: op.value, left: left, right: right}, nil
+}
+
+func (p *parser) parseOperand() (operand, error) {
+	t := p.next()
+	switch t.kind {
+	case 's', 'n':
+		return operand{field: -1, value: t.value}, nil
+	case 'i':
+		col := fieldIndex(p.db, t.value)
+		if col < 0 {
+			return operand{}, fmt.Errorf("column '%s' does not exist", t.value)
+		}
+		return operand{field: col, typ: p.db.Fields()[col].Type, value: t.value}, nil
+	}
+	return operand{}, fmt.Errorf("expected field name or value in filter")
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/tadvi/dbf"
+)
+
+// whereTable returns table with rows:
+//
+//	0 Alice  10.5 T 20200115
+//	1 Bob    -2   F 20210630
+//	2 O'Hara        20191231
+func whereTable() *dbf.DbfTable {
+	db := dbf.New()
+	db.AddTextField("name", 10)
+	db.AddNumberField("amount", 8, 2)
+	db.AddBoolField("paid")
+	db.AddDateField("day")
+	for _, r := range [][]string{
+		{"Alice", "10.5", "T", "20200115"},
+		{"Bob", "-2", "F", "20210630"},
+		{"O'Hara", "", "", "20191231"},
+	} {
+		row := db.AddRecord()
+		for i, v := range r {
+			db.SetFieldValue(row, i, v)
+		}
+	}
+	return db
+}
+
+func TestTokenize(t *testing.T) {
+	for _, c := range []struct {
+		src      string
+		expected string
+	}{
+		{`a == 1`, `[{i a} {o =} {n 1}]`},
+		{`a<>'x y'`, `[{i a} {o !=} {s x y}]`},
+		{`a <= -1.5 and b >= "it's"`, `[{i a} {o <=} {n -1.5} {o &&} {i b} {o >=} {s it's}]`},
+		{`NOT (a < b OR a > b)`, `[{o !} {( } {i a} {o <} {i b} {o ||} {i a} {o >} {i b} {) }]`},
+		{`!a_1 = '' && b != ""`, `[{o !} {i a_1} {o =} {s } {o &&} {i b} {o !=} {s }]`},
+	} {
+		tokens, err := tokenize(c.src)
+		if err != nil {
+			t.Fatal(c.src, err)
+		}
+		s := "["
+		for i, tok := range tokens {
+			if i > 0 {
+				s += " "
+			}
+			s += fmt.Sprintf("{%c %s}", tok.kind, tok.value)
+		}
+		if s += "]"; s != c.expected {
+			t.Fatalf("%s: expected %s found %s", c.src, c.expected, s)
+		}
+	}
+
+	for _, src := range []string{`a = 'x`, `a => 1`, `a # 1`, `a = "x'`} {
+		if _, err := tokenize(src); err == nil {
+			t.Fatalf("%s: expected error", src)
+		}
+	}
+}
+
+func TestParseWhere(t *testing.T) {
+	db := whereTable()
+	for _, c := range []struct {
+		where    string
+		expected string
+	}{
+		{`name = 'Bob'`, "[1]"},
+		{`NAME == "Alice"`, "[0]"},
+		{`name != 'Bob'`, "[0 2]"},
+		{`name <> 'Bob'`, "[0 2]"},
+		{`name = "O'Hara"`, "[2]"},
+		{`name < 'B'`, "[0]"},
+		{`name >= 'Bob'`, "[1 2]"},
+		{`amount > 0`, "[0]"},
+		{`amount <= 10.5`, "[0 1]"},
+		{`amount != 0`, "[0 1 2]"}, // blank numbers only match !=
+		{`0 < amount`, "[0]"},
+		{`paid = 'true'`, "[0]"},
+		{`paid = 'F'`, "[1 2]"},
+		{`day >= '2020-01-01'`, "[0 1]"},
+		{`day < '12/31/2020'`, "[0 2]"},
+		{`day = 20191231`, "[2]"},
+		{`amount > 0 or name = 'Bob'`, "[0 1]"},
+		{`amount > 0 && name = 'Bob'`, "[]"},
+		{`not name = 'Bob'`, "[0 2]"},
+		{`!(name = 'Bob' || name = 'Alice')`, "[2]"},
+		{`name = 'Bob' or name = 'Alice' and amount > 0`, "[0 1]"}, // and binds tighter
+		{`(name = 'Bob' or name = 'Alice') and amount > 0`, "[0]"},
+	} {
+		cond, err := parseWhere(db, c.where)
+		if err != nil {
+			t.Fatal(c.where, err)
+		}
+		rows := []int{}
+		for row := 0; row < db.NumRecords(); row++ {
+			if cond.match(row) {
+				rows = append(rows, row)
+			}
+		}
+		if s := fmt.Sprint(rows); s != c.expected {
+			t.Fatalf("%s: expected rows %s found %s", c.where, c.expected, s)
+		}
+	}
+
+	for _, where := range []string{
+		``,
+		`name`,
+		`name =`,
+		`nope = 1`,
+		`1 = 2`,
+		`name = 'Bob' and`,
+		`(name = 'Bob'`,
+		`name = 'Bob')`,
+		`name && 'Bob'`,
+		`name = 'Bob` + "'" + `'`,
+	} {
+		if _, err := parseWhere(db, where); err == nil {
+			t.Fatalf("%q: expected error", where)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// predicate is one -filter condition applied to a CSV record.
+type predicate struct {
+	column int // CSV column index
+	op     string
+	value  string
+	num    float64 // value as number, valid when isNum
+	isNum  bool
+	re     *regexp.Regexp
+}
+
+// filterList collects repeated -filter flags.
+type filterList []string
+
+func (f *filterList) String() string { return strings.Join(*f, "; ") }
+
+func (f *filterList) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+// wordOps are operators written as words, they must be surrounded by spaces.
+var wordOps = []string{"contains", "regex"}
+
+// symbolOps are ordered so that two character operators are found first.
+var symbolOps = []string{"!=", "<=", ">=", "=", "<", ">"}
+
+// parsePredicate parses "COLUMN op VALUE" where op is one of =, !=, <, <=, >, >=,
+// contains or regex. Column names are matched to the CSV header case-insensitively.
+func parsePredicate(s string, header []string) (*predicate, error) {
+	name, op, value := "", "", ""
+	lower := strings.ToLower(s)
+	for _, w := range wordOps {
+		if i := strings.Index(lower, " "+w+" "); i >= 0 {
+			name, op, value = s[:i], w, s[i+len(w)+2:]
+			break
+		}
+	}
+	if op == "" {
+		best := -1
+		for _, o := range symbolOps {
+			if i := strings.Index(s, o); i >= 0 && (best == -1 || i < best) {
+				best, op = i, o
+			}
+		}
+		if best == -1 {
+			return nil, fmt.Errorf("filter '%s' has no operator", s)
+		}
+		name, value = s[:best], s[best+len(op):]
+	}
+	name = strings.TrimSpace(name)
+
+	p := &predicate{column: -1, op: op, value: strings.TrimSpace(value)}
+	for j, h := range header {
+		if strings.EqualFold(strings.TrimSpace(h), name) {
+			p.column = j
+			break
+		}
+	}
+	if p.column == -1 {
+		return nil, fmt.Errorf("filter '%s' refers to unknown CSV column '%s'", s, name)
+	}
+	return p, p.compile()
+}
+
+// compile prepares value for comparisons.
+func (p *predicate) compile() error {
+	if p.op == "regex" {
+		re, err := regexp.Compile(p.value)
+		if err != nil {
+			return err
+		}
+		p.re = re
+	}
+	if f, err := strconv.ParseFloat(p.value, 64); err == nil {
+		p.num, p.isNum = f, true
+	}
+	return nil
+}
+
+// match checks one CSV record. Numbers are compared numerically when both sides are numbers.
+func (p *predicate) match(rec []string) bool {
+	if p.column >= len(rec) {
+		return false
+	}
+	v := rec[p.column]
+	switch p.op {
+	case "contains":
+		return strings.Contains(v, p.value)
+	case "regex":
+		return p.re.MatchString(v)
+	}
+
+	r := strings.Compare(v, p.value)
+	if p.isNum {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			switch {
+			case f < p.num:
+				r = -1
+			case f > p.num:
+				r = 1
+			default:
+				r = 0
+			}
+		}
+	}
+
+	switch p.op {
+	case "=":
+		return r == 0
+	case "!=":
+		return r != 0
+	case "<":
+		return r < 0
+	case "<=":
+		return r <= 0
+	case ">":
+		return r > 0
+	case ">=":
+		return r >= 0
+	}
+	return false
+}
+
+// matchAll combines predicates with AND, or with OR when any is true. The
+// -or flag sets any for all predicates, the legacy positional filter too.
+func matchAll(preds []*predicate, any bool, rec []string) bool {
+	if len(preds) == 0 {
+		return true
+	}
+	for _, p := range preds {
+		if p.match(rec) == any {
+			return any
+		}
+	}
+	return !any
+}
+
+// parseFilters builds predicates from -filter flags and the legacy
+// positional field#=equals_value argument.
+func parseFilters(filters []string, equals string, header []string) ([]*predicate, error) {
+	preds := []*predicate{}
+	for _, s := range filters {
+		p, err := parsePredicate(s, header)
+		if err != nil {
+			return nil, err
+		}
+		preds = append(preds, p)
+	}
+
+	if equals != "" {
+		arr := strings.SplitN(equals, "=", 2)
+		n, err := strconv.Atoi(arr[0])
+		if err != nil || len(arr) < 2 {
+			return nil, fmt.Errorf("filter should be a field number, instead it is %s", arr[0])
+		}
+		if n < 0 || n >= len(header) {
+			return nil, fmt.Errorf("filter field number outside of record length bounds: %d", n)
+		}
+		p := &predicate{column: n, op: "=", value: arr[1]}
+		if err := p.compile(); err != nil {
+			return nil, err
+		}
+		// legacy filter compares text exactly
+		p.isNum = false
+		preds = append(preds, p)
+	}
+	return preds, nil
+}
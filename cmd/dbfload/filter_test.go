@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+var filterHeader = []string{"Name", " Amount ", "Code"}
+
+var filterRecords = [][]string{
+	{"Alice", "10.5", "A-1"},
+	{"Bob", "9", "b-22"},
+	{"carl", "", "C-333"},
+	{"Dora", "100", "007"},
+}
+
+// matching returns indexes of filterRecords matched by predicates.
+func matching(preds []*predicate, any bool) string {
+	rows := []int{}
+	for i, rec := range filterRecords {
+		if matchAll(preds, any, rec) {
+			rows = append(rows, i)
+		}
+	}
+	return fmt.Sprint(rows)
+}
+
+func TestParsePredicate(t *testing.T) {
+	for _, c := range []struct {
+		filter   string
+		expected string
+	}{
+		{"name=Bob", "[1]"},
+		{"NAME = Bob", "[1]"},
+		{"name != Bob", "[0 2 3]"},
+		{"amount = 9.0", "[1]"},       // numbers compare by value
+		{"amount < 10", "[1 2]"},      // blank compares as text
+		{"amount <= 10.5", "[0 1 2]"}, // two character operator is found first
+		{"amount > 9", "[0 3]"},
+		{"amount >= 100", "[3]"},
+		{"name < C", "[0 1]"},
+		{"code = 007", "[3]"},
+		{"code contains -", "[0 1 2]"},
+		{"code CONTAINS b", "[1]"},
+		{"code regex ^[A-Z]-\\d$", "[0]"},
+		{"name regex (?i)^[a-c]", "[0 1 2]"},
+		{"code contains a = b", "[]"}, // word operator is found before symbols
+	} {
+		p, err := parsePredicate(c.filter, filterHeader)
+		if err != nil {
+			t.Fatal(c.filter, err)
+		}
+		if s := matching([]*predicate{p}, false); s != c.expected {
+			t.Fatalf("%s: expected rows %s found %s", c.filter, c.expected, s)
+		}
+	}
+
+	for _, filter := range []string{"name", "nope = 1", "code regex (", "name ~ x"} {
+		if _, err := parsePredicate(filter, filterHeader); err == nil {
+			t.Fatalf("%s: expected error", filter)
+		}
+	}
+}
+
+func TestParseFilters(t *testing.T) {
+	preds, err := parseFilters([]string{"amount > 9", "code contains -"}, "", filterHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := matching(preds, false); s != "[0]" {
+		t.Fatal("expected all filters to match rows [0] found", s)
+	}
+	if s := matching(preds, true); s != "[0 1 2 3]" {
+		t.Fatal("expected any filter to match rows [0 1 2 3] found", s)
+	}
+	if s := matching(nil, false); s != "[0 1 2 3]" {
+		t.Fatal("expected no filters to match all rows found", s)
+	}
+
+	// legacy positional filter compares text exactly, -or applies to it too
+	preds, err = parseFilters(nil, "1=9.0", filterHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := matching(preds, false); s != "[]" {
+		t.Fatal("expected legacy filter to compare text found", s)
+	}
+	preds, err = parseFilters([]string{"name = carl"}, "0=Bob", filterHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := matching(preds, false); s != "[]" {
+		t.Fatal("expected no rows matching both filters found", s)
+	}
+	if s := matching(preds, true); s != "[1 2]" {
+		t.Fatal("expected rows [1 2] matching either filter found", s)
+	}
+
+	for _, equals := range []string{"x=1", "1", "-1=a", "3=a"} {
+		if _, err := parseFilters(nil, equals, filterHeader); err == nil {
+			t.Fatalf("%s: expected error", equals)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+// maxNumLength is the widest numeric field dbase readers commonly accept.
+const maxNumLength = 20
+
+// dateLayouts recognized by inference, dates are stored as YYYYMMDD.
+var dateLayouts = []string{"2006-01-02", "01/02/2006", "20060102"}
+
+var isBool = map[string]bool{"T": true, "t": true, "F": true, "f": true, "y": true, "Y": true, "N": true, "n": true}
+
+// FieldName collects statistics of one CSV column. Every type starts as possible
+// and non-blank values rule types out, so the order of rows does not matter.
+type FieldName struct {
+	name     string
+	seen     bool // at least one non-blank value
+	notNum   bool
+	notBool  bool
+	notDate  bool
+	digits   int // integer digits including sign
+	decimals int
+	length   int
+	truncate bool // truncated fields longer than 254
+}
+
+// add updates column statistics with one value.
+func (f *FieldName) add(value string) {
+	if len(value) > 254 && !f.truncate {
+		log.Println("Field is longer than 254 characters, and will be truncated '", f.name, "'")
+		f.truncate = true
+	}
+	if f.length < len(value) {
+		f.length = len(value)
+		if f.length > 254 {
+			f.length = 254
+		}
+	}
+
+	if value == "" {
+		return // blank cells do not tell anything about the type
+	}
+	f.seen = true
+
+	if !f.notNum {
+		digits, decimals, ok := numberWidth(value)
+		if ok {
+			if f.digits < digits {
+				f.digits = digits
+			}
+			if f.decimals < decimals {
+				f.decimals = decimals
+			}
+		} else {
+			f.notNum = true
+		}
+	}
+	if !f.notBool && !isBool[value] {
+		f.notBool = true
+	}
+	if !f.notDate {
+		if _, ok := parseDate(value); !ok {
+			f.notDate = true
+		}
+	}
+}
+
+// column returns the best field type for collected statistics.
+func (f *FieldName) column() Column {
+	switch {
+	case !f.seen:
+		return Column{Name: f.name, Type: "C", Length: f.length, Truncate: f.truncate}
+	case !f.notDate:
+		return Column{Name: f.name, Type: "D"}
+	case !f.notBool:
+		return Column{Name: f.name, Type: "L"}
+	case !f.notNum:
+		length := f.digits
+		if f.decimals > 0 {
+			length += f.decimals + 1
+		}
+		if length <= maxNumLength {
+			return Column{Name: f.name, Type: "N", Length: length, Decimals: f.decimals}
+		}
+	}
+	return Column{Name: f.name, Type: "C", Length: f.length, Truncate: f.truncate}
+}
+
+// numberWidth checks that value is plain decimal number and returns number of
+// integer digits (including sign) and decimals. Numbers with leading zeros such
+// as zip codes are not numbers, they would lose the zeros.
+func numberWidth(value string) (digits, decimals int, ok bool) {
+	s := value
+	if s[0] == '-' || s[0] == '+' {
+		s = s[1:]
+	}
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	if intPart == "" && fracPart == "" {
+		return 0, 0, false
+	}
+	if !allDigits(intPart) || !allDigits(fracPart) {
+		return 0, 0, false
+	}
+	if len(intPart) > 1 && intPart[0] == '0' {
+		return 0, 0, false
+	}
+
+	digits = len(intPart)
+	if digits == 0 {
+		digits = 1 // .5 is stored as 0.5
+	}
+	if value[0] == '-' {
+		digits++
+	}
+	return digits, len(fracPart), true
+}
+
+func allDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseDate tries all known date layouts.
+func parseDate(value string) (time.Time, bool) {
+	for _, layout := range dateLayouts {
+		if len(value) != len(layout) {
+			continue
+		}
+		if t, err := time.Parse(layout, value); err == nil && t.Year() >= 1000 {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// infer reads whole CSV file once and guesses field types, it keeps only
+// per column statistics in memory.
+func infer(csvfile string) []Column {
+	fl, r, header := openCSV(csvfile)
+	defer fl.Close()
+
+	uniq := map[string]bool{}
+	names := []FieldName{}
+	truncCount := 0
+
+	for _, field := range header {
+		if err := checkName(uniq, field); err != nil {
+			log.Fatal(err)
+		}
+		names = append(names, FieldName{name: field, length: 1})
+	}
+
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for j, field := range rec {
+			if len(field) > 254 {
+				truncCount++
+			}
+			names[j].add(field)
+		}
+	}
+	if truncCount > 0 {
+		log.Println("Number of truncated fields:", truncCount)
+	}
+
+	columns := []Column{}
+	for i := range names {
+		columns = append(columns, names[i].column())
+	}
+	return columns
+}
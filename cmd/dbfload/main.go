@@ -2,6 +2,10 @@ package main
 
 import (
 	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"strconv"
@@ -10,179 +14,295 @@ import (
 	"github.com/tadvi/dbf"
 )
 
-type FieldType int
-
-const (
-	None FieldType = iota
-	Alpha
-	Bool
-	Int
-	Float
+var (
+	schemaFile = flag.String("schema", "", "JSON schema file with field names, types, lengths and decimals; skips type inference")
+	dryRun     = flag.Bool("dry-run", false, "print schema as JSON, in -schema file format, and exit without loading")
+	appendMode = flag.Bool("append", false, "append to existing dbf file, CSV columns are matched to fields by name")
+	mapFile    = flag.String("map", "", "JSON object mapping CSV column names to dbf field names for -append, \"-\" skips column")
+	errorsFile = flag.String("errors", "", "CSV file receiving rows that failed conversion")
+	anyFilter  = flag.Bool("or", false, "load rows matching any filter instead of all of them, applies to every -filter and the positional field#=equals_value filter")
+	rejectFile = flag.String("reject", "", "CSV file receiving rows excluded by filters")
+	filters    filterList
 )
 
+func init() {
+	flag.Var(&filters, "filter", "load rows where \"COLUMN op VALUE\", op is =, !=, <, <=, >, >=, contains or regex; repeatable")
+}
+
+// maxLoggedErrors limits conversion errors printed to the log.
+const maxLoggedErrors = 10
+
+func usage() {
+	log.Println("Usage:")
+	log.Println("    dbfload [options] input.csv [output.dbf [field#=equals_value]]")
+	log.Println()
+	log.Println("Options:")
+	flag.PrintDefaults()
+}
+
 func main() {
-	if len(os.Args) < 2 {
-		log.Fatal("Missing csv file name as first parameter")
+	flag.Usage = usage
+	flag.Parse()
 
-		log.Println("\nUsage:")
-		log.Println("    dbfload input.csv [output.dbf [field#=equals_value]]\n")
+	if flag.NArg() < 1 {
+		usage()
+		log.Fatal("Missing csv file name as first parameter")
 	}
 
-	csvfile := os.Args[1]
+	csvfile := flag.Arg(0)
 	dbffile := "output.dbf"
-	if len(os.Args) > 2 {
-		dbffile = os.Args[2]
+	if flag.NArg() > 1 {
+		dbffile = flag.Arg(1)
 	}
 
 	equals := ""
-	if len(os.Args) > 3 {
-		equals = os.Args[3]
+	if flag.NArg() > 2 {
+		equals = flag.Arg(2)
 	}
 
 	save(csvfile, dbffile, equals)
 }
 
-type FieldName struct {
-	name     string
-	typ      FieldType
-	length   int
-	truncate bool // truncated fields longer than 254
-}
-
-func save(csvfile, dbffile, equals string) {
+// openCSV opens csv file and reads header row with field names.
+func openCSV(csvfile string) (*os.File, *csv.Reader, []string) {
 	fl, err := os.Open(csvfile)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer fl.Close()
 	r := csv.NewReader(fl)
+	r.ReuseRecord = true
 
 	// we assume that first row contains field names
-	records, err := r.ReadAll()
+	header, err := r.Read()
 	if err != nil {
 		log.Fatal(err)
 	}
-	// analyze data types
-	uniq := map[string]bool{}
-	isBool := map[string]bool{"T": true, "t": true, "F": true, "f": true, "y": true, "Y": true, "N": true, "n": true}
-	names := []FieldName{}
-	truncCount := 0
-
-	// inference
-	for row, rec := range records {
-		for j, field := range rec {
-			if row == 0 {
-				if len(field) > 10 {
-					log.Fatal("Field name can not be over 10 characters long ", field)
-				}
-				if uniq[field] {
-					log.Fatal("Field names must be unique ", field)
-				}
-				uniq[field] = true
-				names = append(names, FieldName{name: field, typ: None, length: 1})
-				continue
-			}
+	return fl, r, append([]string(nil), header...)
+}
 
-			if names[j].typ != Alpha {
-				// analyze types
-				if names[j].typ != Float {
-					if _, err := strconv.ParseInt(field, 0, 64); err == nil {
-						names[j].typ = Int
-						continue
-					}
-				}
-				if _, err := strconv.ParseFloat(field, 64); err == nil {
-					names[j].typ = Float
-					continue
-				}
-				if isBool[field] {
-					names[j].typ = Bool
-					continue
-				}
+// target is the dbf file being loaded.
+type target struct {
+	out     *os.File
+	w       *dbf.Writer
+	columns []Column
+	// CSV column index for every table column, -1 when column is not in CSV
+	source []int
+}
 
-				// at this point - must be Alpha
-				names[j].typ = Alpha
-			}
+// create new dbf file with schema from -schema file or inferred from the CSV.
+func create(csvfile, dbffile string, header []string) *target {
+	var columns []Column
+	var err error
+	if *schemaFile != "" {
+		columns, err = loadSchema(*schemaFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		// first pass over CSV file
+		columns = infer(csvfile)
+	}
+	if len(header) != len(columns) {
+		log.Fatal("CSV file has ", len(header), " columns, schema has ", len(columns))
+	}
 
-			if len(field) > 254 {
-				truncCount++
-			}
+	if *dryRun {
+		b, err := json.MarshalIndent(columns, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(b))
+		os.Exit(0)
+	}
 
-			if len(field) > 254 && !names[j].truncate {
-				log.Println("Field is longer than 254 characters, and will be truncated '", names[j].name, "'")
-				names[j].truncate = true
-				records[row][j] = records[row][j][:250] + "..."
-			}
-			if names[j].length < len(field) {
-				names[j].length = len(field)
-				if len(field) > 254 {
-					names[j].length = 254
+	db, err := createTable(columns)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	out, err := os.Create(dbffile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	w, err := dbf.NewWriter(out, db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	source := []int{}
+	for j := range columns {
+		source = append(source, j)
+	}
+	return &target{out: out, w: w, columns: columns, source: source}
+}
+
+// open existing dbf file for -append and match CSV columns to its fields.
+func open(dbffile string, header []string) *target {
+	mapping := map[string]string{}
+	if *mapFile != "" {
+		b, err := os.ReadFile(*mapFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := json.Unmarshal(b, &mapping); err != nil {
+			log.Fatal("mapping file ", *mapFile, ": ", err)
+		}
+	}
+
+	out, err := os.OpenFile(dbffile, os.O_RDWR, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	w, err := dbf.AppendWriter(out)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	columns, err := appendColumns(w.Fields())
+	if err != nil {
+		log.Fatal(err)
+	}
+	t := &target{out: out, w: w, columns: columns}
+	for range columns {
+		t.source = append(t.source, -1)
+	}
+
+	for j, name := range header {
+		if mapped, ok := mapping[name]; ok {
+			name = mapped
+		}
+		if name == "-" || name == "" {
+			continue
+		}
+
+		found := false
+		for i, col := range t.columns {
+			if strings.EqualFold(col.Name, strings.TrimSpace(name)) {
+				if t.source[i] != -1 {
+					log.Fatal("CSV columns '", header[t.source[i]], "' and '", header[j], "' map to the same field ", col.Name)
 				}
+				t.source[i] = j
+				found = true
+				break
 			}
 		}
+		if !found {
+			log.Println("CSV column ignored, no matching field:", header[j])
+		}
+	}
+	for i, col := range t.columns {
+		if t.source[i] == -1 {
+			log.Println("Field left blank, no matching CSV column:", col.Name)
+		}
 	}
-	if truncCount > 0 {
-		log.Println("Number of truncated fields:", truncCount, "\n")
+	return t
+}
+
+func save(csvfile, dbffile, equals string) {
+	fl, r, header := openCSV(csvfile)
+	defer fl.Close()
+
+	preds, err := parseFilters(filters, equals, header)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	db := dbf.New()
-	log.Println("Creating table:")
-	log.Println("------------------------")
+	var t *target
+	if *appendMode {
+		t = open(dbffile, header)
+	} else {
+		t = create(csvfile, dbffile, header)
+	}
+	defer t.out.Close()
 
-	for _, f := range names {
-		switch f.typ {
-		case None, Alpha:
-			db.AddTextField(f.name, uint8(f.length))
-			log.Println("Text field:", f.name, "size:", f.length)
-		case Bool:
-			db.AddBoolField(f.name)
-			log.Println("Bool field:", f.name)
-		case Int:
-			db.AddIntField(f.name)
-			log.Println("Int field:", f.name)
-		case Float:
-			db.AddFloatField(f.name)
-			log.Println("Float field:", f.name)
+	var rejects *csv.Writer
+	if *errorsFile != "" {
+		fe, err := os.Create(*errorsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer fe.Close()
+		rejects = csv.NewWriter(fe)
+		defer rejects.Flush()
+		if err := rejects.Write(append([]string{"LINE", "ERROR"}, header...)); err != nil {
+			log.Fatal(err)
 		}
 	}
-	log.Println("------------------------")
 
-	equalsFNum, equalsVal, filterCount := -1, "", 0
-	if equals != "" {
-		arr := strings.Split(equals, "=")
-		equalsFNum, err = strconv.Atoi(arr[0])
+	var filtered *csv.Writer
+	if *rejectFile != "" {
+		fr, err := os.Create(*rejectFile)
 		if err != nil {
-			log.Fatal("filter should be a field number, instead it is ", arr[0])
+			log.Fatal(err)
+		}
+		defer fr.Close()
+		filtered = csv.NewWriter(fr)
+		defer filtered.Flush()
+		if err := filtered.Write(header); err != nil {
+			log.Fatal(err)
 		}
-		equalsVal = arr[1]
 	}
 
-	count := 0
-	for row, rec := range records {
-		if row == 0 {
-			continue
+	// second pass over CSV file writes records as they are read
+	count, errorCount, filterCount := 0, 0, 0
+	record := make([]string, len(t.columns))
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
 		}
-		if equalsFNum != -1 {
-			if equalsFNum > len(rec)-1 {
-				log.Fatal("filter field number outside of record length bounds: ", equalsFNum)
+		if err != nil {
+			log.Fatal(err)
+		}
+		line, _ := r.FieldPos(0)
+
+		if !matchAll(preds, *anyFilter, rec) {
+			filterCount++
+			if filtered != nil {
+				if err := filtered.Write(rec); err != nil {
+					log.Fatal(err)
+				}
 			}
-			if rec[equalsFNum] != equalsVal {
-				filterCount++
+			continue
+		}
+
+		var convErr error
+		for i, col := range t.columns {
+			record[i] = ""
+			if t.source[i] == -1 {
 				continue
 			}
+			record[i], convErr = convert(col, rec[t.source[i]])
+			if convErr != nil {
+				break
+			}
 		}
 
-		n := db.AddRecord()
-		count++
+		if convErr != nil {
+			errorCount++
+			if errorCount <= maxLoggedErrors {
+				log.Println("Line", line, "rejected:", convErr)
+			}
+			if rejects != nil {
+				if err := rejects.Write(append([]string{strconv.Itoa(line), convErr.Error()}, rec...)); err != nil {
+					log.Fatal(err)
+				}
+			}
+			continue
+		}
 
-		for j, field := range rec {
-			db.SetFieldValue(n, j, field)
+		if err := t.w.Write(record); err != nil {
+			log.Fatal(err)
 		}
+		count++
+	}
+	if err := t.w.Close(); err != nil {
+		log.Fatal(err)
 	}
 	log.Println("Filtered records:", filterCount)
+	log.Println("Rejected records:", errorCount)
 	log.Println("Total records loaded:", count)
-
-	if err := db.SaveFile(dbffile); err != nil {
-		log.Fatal(err)
+	if *appendMode {
+		log.Println("Total records in table:", t.w.Count())
 	}
 }
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/tadvi/dbf"
+)
+
+// Column describes one field of the output table. Schema file is JSON array of columns:
+//
+//	[{"name": "CITY", "type": "C", "length": 40},
+//	 {"name": "AMOUNT", "type": "N", "length": 12, "decimals": 2}]
+type Column struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"` // C, N, L or D, appended tables may have F and Y fields
+	Length   int    `json:"length,omitempty"`
+	Decimals int    `json:"decimals,omitempty"`
+	Truncate bool   `json:"truncate,omitempty"` // cut text longer than length instead of rejecting row
+}
+
+// loadSchema reads and validates schema file.
+func loadSchema(filename string) ([]Column, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	columns := []Column{}
+	if err := json.Unmarshal(b, &columns); err != nil {
+		return nil, fmt.Errorf("schema file %s: %v", filename, err)
+	}
+
+	uniq := map[string]bool{}
+	for i, col := range columns {
+		col.Type = strings.ToUpper(col.Type)
+		switch col.Type {
+		case "C":
+			if col.Length < 1 || col.Length > 254 {
+				return nil, fmt.Errorf("field '%s' text length must be between 1 and 254", col.Name)
+			}
+		case "N":
+			if col.Length < 1 || col.Length > 20 || col.Decimals < 0 || col.Decimals >= col.Length {
+				return nil, fmt.Errorf("field '%s' has invalid numeric length %d or decimals %d", col.Name, col.Length, col.Decimals)
+			}
+		case "L", "D":
+		default:
+			return nil, fmt.Errorf("field '%s' has unknown type '%s'", col.Name, col.Type)
+		}
+		if err := checkName(uniq, col.Name); err != nil {
+			return nil, err
+		}
+		columns[i] = col
+	}
+	return columns, nil
+}
+
+// checkName validates field name and makes sure it is unique.
+func checkName(uniq map[string]bool, name string) error {
+	if name == "" || len(name) > 10 {
+		return fmt.Errorf("field name must be 1 to 10 characters long '%s'", name)
+	}
+	if uniq[strings.ToUpper(name)] {
+		return fmt.Errorf("field names must be unique '%s'", name)
+	}
+	uniq[strings.ToUpper(name)] = true
+	return nil
+}
+
+// createTable creates empty table with columns.
+func createTable(columns []Column) (*dbf.DbfTable, error) {
+	db := dbf.New()
+	log.Println("Creating table:")
+	log.Println("------------------------")
+
+	for _, col := range columns {
+		var err error
+		switch col.Type {
+		case "C":
+			err = db.AddTextField(col.Name, uint8(col.Length))
+			log.Println("Text field:", col.Name, "size:", col.Length)
+		case "L":
+			err = db.AddBoolField(col.Name)
+			log.Println("Bool field:", col.Name)
+		case "D":
+			err = db.AddDateField(col.Name)
+			log.Println("Date field:", col.Name)
+		case "N":
+			err = db.AddNumberField(col.Name, uint8(col.Length), uint8(col.Decimals))
+			log.Println("Number field:", col.Name, "size:", col.Length, "decimals:", col.Decimals)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	log.Println("------------------------")
+	return db, nil
+}
+
+// appendColumns returns columns of existing table fields for -append. Binary
+// and memo fields can not be written from CSV values and are reported as errors.
+func appendColumns(fields []dbf.DbfField) ([]Column, error) {
+	columns := []Column{}
+	for _, field := range fields {
+		switch field.Type {
+		case "C", "N", "F", "L", "D", "Y":
+		case "0":
+			// _NullFlags is cleared by the writer
+		default:
+			return nil, fmt.Errorf("field '%s' has type '%s' that can not be appended from CSV", field.Name, field.Type)
+		}
+		columns = append(columns, Column{Name: field.Name, Type: field.Type,
+			Length: int(field.Length), Decimals: int(field.Decimals)})
+	}
+	return columns, nil
+}
+
+var (
+	minCurrency = dbf.NewDecimal(math.MinInt64, 4)
+	maxCurrency = dbf.NewDecimal(math.MaxInt64, 4)
+)
+
+// convert CSV value into the form stored in the column, values that do not
+// fit the column type or size are reported as errors.
+func convert(col Column, value string) (string, error) {
+	if value == "" {
+		return value, nil
+	}
+	switch col.Type {
+	case "N", "F":
+		if _, _, ok := numberWidth(value); !ok {
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return "", fmt.Errorf("field %s: '%s' is not a number", col.Name, value)
+			}
+		}
+		s := formatNumber(value, col.Decimals)
+		if len(s) > col.Length {
+			return "", fmt.Errorf("field %s: number '%s' does not fit %d.%d", col.Name, value, col.Length, col.Decimals)
+		}
+		return s, nil
+	case "Y":
+		d, err := dbf.ParseDecimal(value)
+		if err != nil {
+			return "", fmt.Errorf("field %s: '%s' is not a number", col.Name, value)
+		}
+		d = d.Round(4)
+		if d.Cmp(minCurrency) < 0 || d.Cmp(maxCurrency) > 0 {
+			return "", fmt.Errorf("field %s: '%s' is out of currency range", col.Name, value)
+		}
+		return d.String(), nil
+	case "D":
+		if t, ok := parseDate(value); ok {
+			return t.Format("20060102"), nil
+		}
+		return "", fmt.Errorf("field %s: '%s' is not a date", col.Name, value)
+	case "L":
+		switch strings.ToLower(value) {
+		case "t", "y", "true", "1":
+			return "T", nil
+		case "f", "n", "false", "0":
+			return "F", nil
+		case "?":
+			return "?", nil
+		}
+		return "", fmt.Errorf("field %s: '%s' is not a logical value", col.Name, value)
+	case "C":
+		if len(value) > col.Length {
+			if !col.Truncate {
+				return "", fmt.Errorf("field %s: text is longer than %d characters", col.Name, col.Length)
+			}
+			if col.Length <= 3 {
+				return value[:col.Length], nil
+			}
+			return value[:col.Length-3] + "...", nil
+		}
+	}
+	return value, nil
+}
+
+// formatNumber pads or rounds number to declared decimals so it fits the field.
+// Plain decimal numbers are padded as text so that no precision is lost.
+func formatNumber(value string, decimals int) string {
+	if _, dec, ok := numberWidth(value); ok && dec <= decimals {
+		value = strings.TrimPrefix(value, "+")
+		if strings.HasPrefix(value, ".") || strings.HasPrefix(value, "-.") {
+			value = strings.Replace(value, ".", "0.", 1)
+		}
+		if decimals == 0 {
+			return strings.TrimSuffix(value, ".")
+		}
+		if dec == 0 && !strings.Contains(value, ".") {
+			value += "."
+		}
+		return value + strings.Repeat("0", decimals-dec)
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return strconv.FormatFloat(f, 'f', decimals, 64)
+	}
+	return value
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/tadvi/dbf"
+)
+
+func TestAppendColumns(t *testing.T) {
+	db := dbf.New()
+	db.AddTextField("name", 10)
+	db.AddCurrencyField("price")
+	columns, err := appendColumns(db.Fields())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(columns) != 2 || columns[1].Type != "Y" || columns[1].Decimals != 4 {
+		t.Fatal("unexpected columns:", columns)
+	}
+
+	for _, c := range []struct {
+		value    string
+		expected string
+	}{
+		{"12.5", "12.5000"},
+		{"+1.23456", "1.2346"},
+		{"-922337203685477.5808", "-922337203685477.5808"},
+	} {
+		if s, err := convert(columns[1], c.value); err != nil || s != c.expected {
+			t.Fatal(c.value, "expected", c.expected, "found:", s, err)
+		}
+	}
+	for _, value := range []string{"abc", "922337203685477.5808"} {
+		if _, err := convert(columns[1], value); err == nil {
+			t.Fatal(value, "expected error")
+		}
+	}
+
+	for _, typ := range []string{"I", "B", "T", "M"} {
+		fields := append(db.Fields(), dbf.DbfField{Name: "X", Type: typ, Length: 8})
+		if _, err := appendColumns(fields); err == nil {
+			t.Fatal("expected error for field of type", typ)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package dbf
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// writeByName is Write before struct codecs, kept to compare performance.
+func writeByName(dt *DbfTable, row int, spec interface{}) int {
+	s := reflect.ValueOf(spec)
+	if s.Kind() == reflect.Ptr {
+		s = s.Elem()
+	}
+	if s.Kind() != reflect.Struct {
+		panic("dbf: spec parameter must be a struct")
+	}
+
+	typeOfSpec := s.Type()
+	for i := 0; i < s.NumField(); i++ {
+		f := s.Field(i)
+		if typeOfSpec.Field(i).PkgPath != "" || typeOfSpec.Field(i).Anonymous {
+			continue // ignore unexported or embedded fields
+		}
+
+		alt := typeOfSpec.Field(i).Tag.Get("dbf")
+		// ignore '-' tags
+		if alt == "-" {
+			continue
+		}
+
+		val := ""
+		switch f.Kind() {
+		default:
+			panic("dbf: unsupported type for database table schema, use dash to omit")
+		case reflect.String:
+			val = f.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			val = fmt.Sprintf("%d", f.Int())
+		case reflect.Bool:
+			val = "f"
+			if f.Bool() {
+				val = "t"
+			}
+		case reflect.Float32, reflect.Float64:
+			val = fmt.Sprintf("%f", f.Float())
+		}
+
+		dt.SetFieldValueByName(row, typeOfSpec.Field(i).Name, val)
+	}
+	return row
+}
+
+// readByName is Read before struct codecs, kept to compare performance.
+func readByName(dt *DbfTable, row int, spec interface{}) error {
+	v := reflect.ValueOf(spec)
+	if v.Kind() != reflect.Ptr {
+		panic("dbf: must be a pointer")
+	}
+	s := v.Elem()
+	if s.Kind() != reflect.Struct {
+		panic("dbf: spec parameter must be a struct")
+	}
+
+	typeOfSpec := s.Type()
+	for i := 0; i < s.NumField(); i++ {
+		f := s.Field(i)
+		if f.CanSet() {
+			var fieldName string
+			alt := typeOfSpec.Field(i).Tag.Get("dbf")
+
+			// ignore '-' tags
+			if alt == "-" {
+				continue
+			}
+			fieldName = typeOfSpec.Field(i).Name
+			value := dt.FieldValueByName(row, fieldName)
+
+			switch f.Kind() {
+			default:
+				panic("dbf: unsupported type for database table schema, use dash to omit")
+
+			case reflect.String:
+				f.SetString(value)
+
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				intValue, err := strconv.ParseInt(value, 0, f.Type().Bits())
+				if err != nil {
+					return fmt.Errorf("fail to parse field '%s' type: %s value: %s",
+						fieldName, f.Type().String(), value)
+				}
+				f.SetInt(intValue)
+
+			case reflect.Bool:
+				if value == "T" || value == "t" || value == "Y" || value == "y" {
+					f.SetBool(true)
+				} else {
+					f.SetBool(false)
+				}
+
+			case reflect.Float32, reflect.Float64:
+				floatValue, err := strconv.ParseFloat(value, f.Type().Bits())
+				if err != nil {
+					return fmt.Errorf("fail to parse field '%s' type: %s value: %s",
+						fieldName, f.Type().String(), value)
+				}
+				f.SetFloat(floatValue)
+			}
+		}
+	}
+	return nil
+}
+
+// benchTable returns table with n records written from TTable.
+func benchTable(b *testing.B, n int) *DbfTable {
+	db := New()
+	if err := db.Create(TTable{}); err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		db.Append(TTable{Boolean: true, Text: "text", Int: i, Float: 1.5})
+	}
+	return db
+}
+
+func BenchmarkReadByName(b *testing.B) {
+	db := benchTable(b, 1000)
+	var v TTable
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := readByName(db, i%1000, &v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRead(b *testing.B) {
+	db := benchTable(b, 1000)
+	var v TTable
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := db.Read(i%1000, &v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWriteByName(b *testing.B) {
+	db := benchTable(b, 1000)
+	v := TTable{Boolean: true, Text: "text", Int: 42, Float: 1.5}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		writeByName(db, i%1000, v)
+	}
+}
+
+func BenchmarkWrite(b *testing.B) {
+	db := benchTable(b, 1000)
+	v := TTable{Boolean: true, Text: "text", Int: 42, Float: 1.5}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db.Write(i%1000, v)
+	}
+}
+
+func TestCodecCache(t *testing.T) {
+	db := New()
+	db.AddTextField("text", 10)
+	type first struct{ Text string }
+	c := db.codec(reflect.TypeOf(first{}))
+	if db.codec(reflect.TypeOf(first{})) != c {
+		t.Fatal("codec was not cached")
+	}
+	db.AddIntField("int")
+	if db.codec(reflect.TypeOf(first{})) == c {
+		t.Fatal("codec was not dropped after schema change")
+	}
+
+	type second struct {
+		Text string
+		Int  uint16
+	}
+	db.Append(second{Text: "abc", Int: 65535})
+	var v second
+	if err := db.Read(0, &v); err != nil || v.Int != 65535 || v.Text != "abc" {
+		t.Fatal("expected abc and 65535 found:", v, err)
+	}
+}
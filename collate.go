@@ -0,0 +1,337 @@
+package dbf
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Collation orders text. Keys compare byte by byte in the order of the
+// collation, text equal by the collation has equal keys. SortKey sorts by Key,
+// collated in-memory indexes and queries use both methods.
+type Collation interface {
+	// Key appends sort key of the text to dst.
+	Key(dst []byte, s string) []byte
+	// Prefix appends key that keys of all text starting with s start with,
+	// Seek and Range of collated indexes match text by it. It is Key when
+	// keys of text start with keys of its prefixes, as in Binary.
+	Prefix(dst []byte, s string) []byte
+}
+
+// Binary collation orders text byte by byte, as stored.
+var Binary Collation = binaryCollation{}
+
+// CaseInsensitive collation orders text ignoring letter case. UTF-8 text is
+// folded by Unicode rules, other text by ASCII letters.
+var CaseInsensitive Collation = caseCollation{}
+
+type binaryCollation struct{}
+
+func (binaryCollation) Key(dst []byte, s string) []byte {
+	return append(dst, s...)
+}
+
+func (binaryCollation) Prefix(dst []byte, s string) []byte {
+	return append(dst, s...)
+}
+
+type caseCollation struct{}
+
+func (caseCollation) Key(dst []byte, s string) []byte {
+	if utf8.ValidString(s) {
+		return append(dst, strings.ToUpper(s)...)
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		dst = append(dst, c)
+	}
+	return dst
+}
+
+func (c caseCollation) Prefix(dst []byte, s string) []byte {
+	return c.Key(dst, s)
+}
+
+// sameCollation reports whether a and b are the same collation, nil is Binary.
+// Values that can not be compared, as structs holding slices, are never the
+// same collation, pointers to them are compared instead.
+func sameCollation(a, b Collation) (same bool) {
+	if a == nil {
+		a = Binary
+	}
+	if b == nil {
+		b = Binary
+	}
+	if x, ok := a.(codePageCollation); ok {
+		y, ok := b.(codePageCollation)
+		return ok && x.table == y.table && sameCollation(x.c, y.c)
+	}
+	if reflect.TypeOf(a) != reflect.TypeOf(b) || !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+	// comparable struct may still hold values that can not be compared
+	defer func() {
+		if recover() != nil {
+			same = false
+		}
+	}()
+	return a == b
+}
+
+// appendCollated appends collation key of text ended with two zero bytes.
+// Zero bytes of the key are escaped as 00 FF, so shorter text sorts before
+// longer text starting with it and keys of following fields do not change
+// that. Partial key is not ended, it is prefix of keys of text starting with
+// value.
+func appendCollated(dst []byte, c Collation, value string, partial bool) []byte {
+	var key []byte
+	if partial {
+		key = c.Prefix(nil, value)
+	} else {
+		key = c.Key(nil, value)
+	}
+	for _, b := range key {
+		dst = append(dst, b)
+		if b == 0 {
+			dst = append(dst, 0xFF)
+		}
+	}
+	if partial {
+		return dst
+	}
+	return append(dst, 0, 0)
+}
+
+// Unicode collation orders UTF-8 text the way people expect, close to the
+// Unicode Collation Algorithm: letters first by base letter, then by accents
+// and then lower case before upper case, so "muller" < "Muller" < "müller" <
+// "Mutter". Spaces and punctuation come before digits and digits before
+// letters. Accents of Latin-1 and Latin Extended-A letters are folded, ß
+// and æ compare as ss and ae. UnicodeCollation gives language orders.
+var Unicode Collation = rootCollation
+
+// unicodeCollation is Unicode collation with letters of a language tailored.
+type unicodeCollation struct {
+	tailored map[rune][]collElem // by lower case letter
+}
+
+// collElem is collation element: primary weight of base letter, secondary
+// of accent and tertiary of case.
+type collElem struct {
+	p    uint32
+	s, t uint8
+}
+
+var (
+	rootCollation = &unicodeCollation{}
+
+	// German dictionary order of DIN 5007-1 is the root order, phonebook
+	// order of DIN 5007-2 sorts ä, ö and ü as ae, oe and ue.
+	germanPhonebook = &unicodeCollation{tailored: map[rune][]collElem{
+		'ä': {{primaryWeight('a'), 0x0a, 0}, {primaryWeight('e'), 1, 0}},
+		'ö': {{primaryWeight('o'), 0x0a, 0}, {primaryWeight('e'), 1, 0}},
+		'ü': {{primaryWeight('u'), 0x0a, 0}, {primaryWeight('e'), 1, 0}},
+	}}
+
+	// Lithuanian alphabet has Č, Š and Ž as letters after C, S and Z, and Y
+	// sorts with I.
+	lithuanian = &unicodeCollation{tailored: map[rune][]collElem{
+		'č': {{primaryWeight('c') + 1, 1, 0}},
+		'š': {{primaryWeight('s') + 1, 1, 0}},
+		'ž': {{primaryWeight('z') + 1, 1, 0}},
+		'y': {{primaryWeight('i'), 0xa0, 0}},
+	}}
+)
+
+// UnicodeCollation returns Unicode collation tailored for language given by
+// BCP 47 tag: "de" orders German as dictionaries do and "de-u-co-phonebk" as
+// phone books do, "lt" orders Lithuanian alphabet. Other languages get the
+// Unicode collation.
+func UnicodeCollation(lang string) Collation {
+	lang = strings.ToLower(strings.ReplaceAll(lang, "_", "-"))
+	base, _, _ := strings.Cut(lang, "-")
+	switch base {
+	case "de":
+		if strings.Contains(lang, "-u-co-phonebk") {
+			return germanPhonebook
+		}
+	case "lt":
+		return lithuanian
+	}
+	return rootCollation
+}
+
+// elems appends collation elements of the text.
+func (u *unicodeCollation) elems(elems []collElem, s string) []collElem {
+	for _, r := range s {
+		lower := unicode.ToLower(r)
+		t := uint8(1)
+		if lower != r {
+			t = 2
+		}
+		if tailored, ok := u.tailored[lower]; ok {
+			for _, e := range tailored {
+				e.t = t
+				elems = append(elems, e)
+			}
+			continue
+		}
+		base, mark := foldLatin(lower)
+		for i, b := range base {
+			e := collElem{p: primaryWeight(b), s: 1, t: t}
+			if i == 0 && mark != 0 {
+				e.s = mark
+			}
+			elems = append(elems, e)
+		}
+	}
+	return elems
+}
+
+func (u *unicodeCollation) Key(dst []byte, s string) []byte {
+	elems := u.elems(nil, s)
+	for _, e := range elems {
+		dst = append(dst, byte(e.p>>16), byte(e.p>>8), byte(e.p))
+	}
+	dst = append(dst, 0, 0, 0)
+	for _, e := range elems {
+		dst = append(dst, e.s)
+	}
+	dst = append(dst, 0)
+	for _, e := range elems {
+		dst = append(dst, e.t)
+	}
+	return dst
+}
+
+// Prefix gives primary weights only, text matches ignoring accents and case.
+func (u *unicodeCollation) Prefix(dst []byte, s string) []byte {
+	for _, e := range u.elems(nil, s) {
+		dst = append(dst, byte(e.p>>16), byte(e.p>>8), byte(e.p))
+	}
+	return dst
+}
+
+// primaryWeight returns weight of base letter, weights are never zero and fit
+// in three bytes.
+func primaryWeight(r rune) uint32 {
+	switch {
+	case 'a' <= r && r <= 'z':
+		// room for letters tailored after each letter
+		return 0x300000 + uint32(r-'a')<<4
+	case unicode.IsLetter(r):
+		return 0x400000 + uint32(r)
+	case unicode.IsDigit(r):
+		return 0x200000 + uint32(r)
+	}
+	return 1 + uint32(r)
+}
+
+// foldLatin returns base letters of lower case letter and weight of its
+// accent, zero when it has none.
+func foldLatin(r rune) (string, uint8) {
+	switch r {
+	case 'ß':
+		return "ss", 0x80
+	case 'æ':
+		return "ae", 0x80
+	case 'œ':
+		return "oe", 0x80
+	case 'ĳ':
+		return "ij", 0x80
+	}
+	if 0xC0 <= r && r < 0x180 && latinBase[r-0xC0] != '.' {
+		return latinBase[r-0xC0 : r-0xC0+1], latinMark[r-0xC0]
+	}
+	return string(r), 0
+}
+
+// latinBase and latinMark give base letter and accent weight of letters from
+// U+00C0 to U+017F, from their Unicode decompositions. Letters with stroke
+// have accent weights from 0x80. Letters without base are dots.
+const latinBase = "AAAAAA.CEEEEIIIIDNOOOOO.OUUUUY..aaaaaa.ceeeeiiiidnooooo.ouuuuy.yAaAaAaCcCcCcCcDdDdEeEeEeEeEeGgGgGgGgHhHhIiIiIiIiIi..JjKk.LlLlLlLlLlNnNnNn...OoOoOo..RrRrRrSsSsSsSsTtTtTtUuUuUuUuUuUuWwYyYZzZzZzs"
+
+var latinMark = [...]uint8{
+	0x02, 0x03, 0x04, 0x05, 0x0a, 0x0c, 0x00, 0x29, 0x02, 0x03, 0x04, 0x0a, 0x02, 0x03, 0x04, 0x0a,
+	0x81, 0x05, 0x02, 0x03, 0x04, 0x05, 0x0a, 0x00, 0x80, 0x02, 0x03, 0x04, 0x0a, 0x03, 0x00, 0x00,
+	0x02, 0x03, 0x04, 0x05, 0x0a, 0x0c, 0x00, 0x29, 0x02, 0x03, 0x04, 0x0a, 0x02, 0x03, 0x04, 0x0a,
+	0x81, 0x05, 0x02, 0x03, 0x04, 0x05, 0x0a, 0x00, 0x80, 0x02, 0x03, 0x04, 0x0a, 0x03, 0x00, 0x0a,
+	0x06, 0x06, 0x08, 0x08, 0x2a, 0x2a, 0x03, 0x03, 0x04, 0x04, 0x09, 0x09, 0x0e, 0x0e, 0x0e, 0x0e,
+	0x80, 0x80, 0x06, 0x06, 0x08, 0x08, 0x09, 0x09, 0x2a, 0x2a, 0x0e, 0x0e, 0x04, 0x04, 0x08, 0x08,
+	0x09, 0x09, 0x29, 0x29, 0x04, 0x04, 0x80, 0x80, 0x05, 0x05, 0x06, 0x06, 0x08, 0x08, 0x2a, 0x2a,
+	0x09, 0x80, 0x00, 0x00, 0x04, 0x04, 0x29, 0x29, 0x00, 0x03, 0x03, 0x29, 0x29, 0x0e, 0x0e, 0x81,
+	0x81, 0x80, 0x80, 0x03, 0x03, 0x29, 0x29, 0x0e, 0x0e, 0x00, 0x00, 0x00, 0x06, 0x06, 0x08, 0x08,
+	0x0d, 0x0d, 0x00, 0x00, 0x03, 0x03, 0x29, 0x29, 0x0e, 0x0e, 0x03, 0x03, 0x04, 0x04, 0x29, 0x29,
+	0x0e, 0x0e, 0x29, 0x29, 0x0e, 0x0e, 0x80, 0x80, 0x05, 0x05, 0x06, 0x06, 0x08, 0x08, 0x0c, 0x0c,
+	0x0d, 0x0d, 0x2a, 0x2a, 0x04, 0x04, 0x04, 0x04, 0x0a, 0x03, 0x03, 0x09, 0x09, 0x0e, 0x0e, 0x80,
+}
+
+// CodePage returns collation of text stored in DOS or Windows code page, as
+// Clipper and FoxPro programs stored it. Code pages 437, 775, 850, 852, 1250,
+// 1252 and 1257 are known. Text is decoded and ordered by c, Unicode when c is
+// nil, so that national letters sort next to their base letters as national
+// sort orders of those programs do, not by their byte values.
+//
+//	c, err := dbf.CodePage(775, dbf.UnicodeCollation("lt"))
+func CodePage(codePage int, c Collation) (Collation, error) {
+	table, ok := codePageTables[codePage]
+	if !ok {
+		return nil, errors.New("dbf: unknown code page " + strconv.Itoa(codePage))
+	}
+	if c == nil {
+		c = Unicode
+	}
+	return codePageCollation{table: table, c: c}, nil
+}
+
+type codePageCollation struct {
+	table *[128]rune // characters of bytes from 0x80
+	c     Collation
+}
+
+// decode returns UTF-8 text of code page text.
+func (cp codePageCollation) decode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x80 {
+			b.WriteByte(c)
+		} else {
+			b.WriteRune(cp.table[c-0x80])
+		}
+	}
+	return b.String()
+}
+
+func (cp codePageCollation) Key(dst []byte, s string) []byte {
+	return cp.c.Key(dst, cp.decode(s))
+}
+
+func (cp codePageCollation) Prefix(dst []byte, s string) []byte {
+	return cp.c.Prefix(dst, cp.decode(s))
+}
+
+// codePageTables are characters of bytes from 0x80 by code page, bytes not
+// used by Windows code pages stand for C1 controls.
+var codePageTables = map[int]*[128]rune{}
+
+func init() {
+	for cp, s := range map[int]string{
+		437:  "ÇüéâäàåçêëèïîìÄÅÉæÆôöòûùÿÖÜ¢£¥₧ƒáíóúñÑªº¿⌐¬½¼¡«»░▒▓│┤╡╢╖╕╣║╗╝╜╛┐└┴┬├─┼╞╟╚╔╩╦╠═╬╧╨╤╥╙╘╒╓╫╪┘┌█▄▌▐▀αßΓπΣσµτΦΘΩδ∞φε∩≡±≥≤⌠⌡÷≈°∙·√ⁿ²■\u00a0",
+		775:  "ĆüéāäģåćłēŖŗīŹÄÅÉæÆōöĢ¢ŚśÖÜø£Ø×¤ĀĪóŻżź”¦©®¬½¼Ł«»░▒▓│┤ĄČĘĖ╣║╗╝ĮŠ┐└┴┬├─┼ŲŪ╚╔╩╦╠═╬Žąčęėįšųūž┘┌█▄▌▐▀ÓßŌŃõÕµńĶķĻļņĒŅ’\u00ad±“¾¶§÷„°∙·¹³²■\u00a0",
+		850:  "ÇüéâäàåçêëèïîìÄÅÉæÆôöòûùÿÖÜø£Ø×ƒáíóúñÑªº¿®¬½¼¡«»░▒▓│┤ÁÂÀ©╣║╗╝¢¥┐└┴┬├─┼ãÃ╚╔╩╦╠═╬¤ðÐÊËÈıÍÎÏ┘┌█▄¦Ì▀ÓßÔÒõÕµþÞÚÛÙýÝ¯´\u00ad±‗¾¶§÷¸°¨·¹³²■\u00a0",
+		852:  "ÇüéâäůćçłëŐőîŹÄĆÉĹĺôöĽľŚśÖÜŤťŁ×čáíóúĄąŽžĘę¬źČş«»░▒▓│┤ÁÂĚŞ╣║╗╝Żż┐└┴┬├─┼Ăă╚╔╩╦╠═╬¤đĐĎËďŇÍÎě┘┌█▄ŢŮ▀ÓßÔŃńňŠšŔÚŕŰýÝţ´\u00ad˝˛ˇ˘§÷¸°¨˙űŘř■\u00a0",
+		1250: "€\u0081‚\u0083„…†‡\u0088‰Š‹ŚŤŽŹ\u0090‘’“”•–—\u0098™š›śťžź\u00a0ˇ˘Ł¤Ą¦§¨©Ş«¬\u00ad®Ż°±˛ł´µ¶·¸ąş»Ľ˝ľżŔÁÂĂÄĹĆÇČÉĘËĚÍÎĎĐŃŇÓÔŐÖ×ŘŮÚŰÜÝŢßŕáâăäĺćçčéęëěíîďđńňóôőö÷řůúűüýţ˙",
+		1252: "€\u0081‚ƒ„…†‡ˆ‰Š‹Œ\u008dŽ\u008f\u0090‘’“”•–—˜™š›œ\u009džŸ\u00a0¡¢£¤¥¦§¨©ª«¬\u00ad®¯°±²³´µ¶·¸¹º»¼½¾¿ÀÁÂÃÄÅÆÇÈÉÊËÌÍÎÏÐÑÒÓÔÕÖ×ØÙÚÛÜÝÞßàáâãäåæçèéêëìíîïðñòóôõö÷øùúûüýþÿ",
+		1257: "€\u0081‚\u0083„…†‡\u0088‰\u008a‹\u008c¨ˇ¸\u0090‘’“”•–—\u0098™\u009a›\u009c¯˛\u009f\u00a0¡¢£¤¥¦§Ø©Ŗ«¬\u00ad®Æ°±²³´µ¶·ø¹ŗ»¼½¾æĄĮĀĆÄÅĘĒČÉŹĖĢĶĪĻŠŃŅÓŌÕÖ×ŲŁŚŪÜŻŽßąįāćäåęēčéźėģķīļšńņóōõö÷ųłśūüżž˙",
+	} {
+		table := &[128]rune{}
+		copy(table[:], []rune(s))
+		codePageTables[cp] = table
+	}
+}
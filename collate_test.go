@@ -0,0 +1,145 @@
+package dbf
+
+import (
+	"bytes"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// collated returns words sorted by collation.
+func collated(c Collation, words ...string) string {
+	words = append([]string(nil), words...)
+	sort.SliceStable(words, func(a, b int) bool {
+		return bytes.Compare(c.Key(nil, words[a]), c.Key(nil, words[b])) < 0
+	})
+	return strings.Join(words, " ")
+}
+
+// sliceCollation is user collation that can not be compared with ==.
+type sliceCollation struct {
+	order []byte
+}
+
+func (c sliceCollation) Key(dst []byte, s string) []byte    { return append(dst, s...) }
+func (c sliceCollation) Prefix(dst []byte, s string) []byte { return append(dst, s...) }
+
+func TestCollations(t *testing.T) {
+	for _, c := range []struct {
+		c        Collation
+		words    []string
+		expected string
+	}{
+		{Binary, []string{"b", "B", "a", "ä"}, "B a b ä"},
+		{CaseInsensitive, []string{"b", "B", "a", "ä"}, "a b B ä"},
+		{Unicode, []string{"Mutter", "müller", "Muller", "muller", "Mahler", "Möbel", "Maße", "Masse"},
+			"Mahler Masse Maße Möbel muller Muller müller Mutter"},
+		{Unicode, []string{"b-2", "b 2", "b2", "B1", "bø", "bo", "bz"}, "b 2 b-2 B1 b2 bo bø bz"},
+		{UnicodeCollation("de"), []string{"Müller", "Muller", "Mueller"}, "Mueller Muller Müller"},
+		{UnicodeCollation("de-DE-u-co-phonebk"), []string{"Müller", "Muller", "Mueller"}, "Mueller Müller Muller"},
+		{Unicode, []string{"Cukras", "Čepas", "Ilgas", "Ygis"}, "Čepas Cukras Ilgas Ygis"},
+		{UnicodeCollation("lt_LT"), []string{"Žemaitis", "Šarūnas", "Zuikis", "Saulius", "Cukras", "Čepas", "Ilgas", "Ygis", "Jonas", "Ąžuolas", "Antanas"},
+			"Antanas Ąžuolas Cukras Čepas Ygis Ilgas Jonas Saulius Šarūnas Zuikis Žemaitis"},
+	} {
+		if s := collated(c.c, c.words...); s != c.expected {
+			t.Fatalf("expected %q found %q", c.expected, s)
+		}
+	}
+
+	lt := UnicodeCollation("lt")
+	if lt != UnicodeCollation("LT") || !sameCollation(nil, Binary) || sameCollation(lt, Unicode) {
+		t.Fatal("unexpected collation identity")
+	}
+	if !bytes.HasPrefix(lt.Key(nil, "Šarūnas"), lt.Prefix(nil, "šaru")) {
+		t.Fatal("expected prefix ignoring accents and case")
+	}
+
+	// legacy text decoded by code page
+	for _, c := range []struct {
+		codePage int
+		text     string
+	}{{775, "\xbear\xd7nas"}, {1257, "\xd0ar\xfbnas"}} {
+		cp, err := CodePage(c.codePage, lt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(cp.Key(nil, c.text), lt.Key(nil, "Šarūnas")) {
+			t.Fatalf("unexpected key of code page %d text", c.codePage)
+		}
+	}
+	cp850, _ := CodePage(850, nil)
+	if s := collated(cp850, "Mutter", "M\x81ller", "Mzz"); s != "M\x81ller Mutter Mzz" {
+		t.Fatalf("unexpected code page 850 order %q", s)
+	}
+	if again, _ := CodePage(850, nil); !sameCollation(cp850, again) {
+		t.Fatal("expected the same code page collation")
+	}
+	user := sliceCollation{}
+	a, _ := CodePage(850, user)
+	b, _ := CodePage(850, user)
+	if sameCollation(a, b) || sameCollation(user, user) || !sameCollation(&user, &user) {
+		t.Fatal("unexpected identity of collation that can not be compared")
+	}
+	if _, err := CodePage(999, nil); err == nil {
+		t.Fatal("expected error for unknown code page")
+	}
+}
+
+func TestCollatedIndex(t *testing.T) {
+	db := New()
+	db.AddTextField("name", 10)
+	db.AddIntField("n")
+	for i, name := range []string{"Mutter", "müller", "Muller", "muller", "Mahler", "Maße"} {
+		if _, err := db.AppendMap(map[string]interface{}{"name": name, "n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.CreateCollatedIndex("name", Unicode, "name", "n"); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for it := db.NewIterator(OrderBy("name")); it.Next(); {
+		names = append(names, db.FieldValue(it.Index(), 0))
+	}
+	if s := strings.Join(names, " "); s != "Mahler Maße muller Muller müller Mutter" {
+		t.Fatal("unexpected index order:", s)
+	}
+	if row, ok := db.Seek("name", "MUL"); !ok || row != 3 {
+		t.Fatal("expected seek of muller found:", row, ok)
+	}
+	if row, ok := db.Seek("name", "Muller", "2"); !ok || row != 2 {
+		t.Fatal("expected seek of Muller found:", row, ok)
+	}
+	db.SetFieldValue(0, 0, "Mäuse")
+	if row, ok := db.Seek("name", "MAU"); !ok || row != 0 {
+		t.Fatal("expected seek of changed row found:", row, ok)
+	}
+
+	// lookups use index of the same collation only
+	if _, ok := db.Lookup("name", "Muller"); ok {
+		t.Fatal("expected no binary index")
+	}
+	if rows, ok := db.LookupCollated("name", "Muller", Unicode); !ok || len(rows) != 1 || rows[0] != 2 {
+		t.Fatal("unexpected lookup:", rows, ok)
+	}
+	if err := db.CreateCollatedIndex("nocase", CaseInsensitive, "name"); err != nil {
+		t.Fatal(err)
+	}
+	if rows, ok := db.LookupCollated("name", "MULLER", CaseInsensitive); !ok || len(rows) != 2 || rows[0] != 2 || rows[1] != 3 {
+		t.Fatal("unexpected case insensitive lookup:", rows, ok)
+	}
+
+	dst := filepath.Join(t.TempDir(), "sorted.dbf")
+	if err := db.SortTo(dst, SortKey{Field: "name", Collation: Unicode, Desc: true}); err != nil {
+		t.Fatal(err)
+	}
+	names = names[:0]
+	for _, row := range sortedRows(t, dst) {
+		name, _, _ := strings.Cut(row, "|")
+		names = append(names, name)
+	}
+	if s := strings.Join(names, " "); s != "müller Muller muller Mäuse Maße Mahler" {
+		t.Fatal("unexpected sort order:", s)
+	}
+}
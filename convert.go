@@ -0,0 +1,95 @@
+package dbf
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// converter stores values of one Go type in text or other table fields.
+type converter struct {
+	encode func(v interface{}) (string, error)
+	decode func(s string) (interface{}, error)
+}
+
+var (
+	convMu     sync.RWMutex
+	converters = map[reflect.Type]*converter{}
+
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// RegisterConverter sets how struct fields of type t are stored in the table.
+// Encode returns table value of the field and decode returns value of type t
+// read from the table. Such fields are C fields unless struct tag sets another
+// type. Registered converters take precedence over encoding.TextMarshaler.
+// Register converters before tables use the type, tables keep their mapping.
+func RegisterConverter(t reflect.Type, encode func(v interface{}) (string, error), decode func(s string) (interface{}, error)) {
+	convMu.Lock()
+	defer convMu.Unlock()
+	if encode == nil || decode == nil {
+		delete(converters, t)
+		return
+	}
+	converters[t] = &converter{encode: encode, decode: decode}
+}
+
+// converterFor returns converter of the type: registered one or one using
+// TextMarshaler and TextUnmarshaler of the type or its pointer. Returns nil for
+// time.Time, Decimal and other types without such methods.
+func converterFor(t reflect.Type) *converter {
+	convMu.RLock()
+	c := converters[t]
+	convMu.RUnlock()
+	if c != nil || t == timeType || t == decimalType {
+		return c
+	}
+	pt := reflect.PointerTo(t)
+	if !pt.Implements(textMarshalerType) || !pt.Implements(textUnmarshalerType) {
+		return nil
+	}
+	return &converter{
+		encode: func(v interface{}) (string, error) {
+			p := reflect.New(t)
+			p.Elem().Set(reflect.ValueOf(v))
+			b, err := p.Interface().(encoding.TextMarshaler).MarshalText()
+			return string(b), err
+		},
+		decode: func(s string) (interface{}, error) {
+			p := reflect.New(t)
+			err := p.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+			return p.Elem().Interface(), err
+		},
+	}
+}
+
+// encodeConv returns table value of field stored with converter.
+func (sf structField) encodeConv(f reflect.Value) (string, error) {
+	s, err := sf.conv.encode(f.Interface())
+	if err != nil {
+		return "", fmt.Errorf("fail to encode field '%s': %v", sf.name, err)
+	}
+	return s, nil
+}
+
+// decodeConv sets field stored with converter from table value.
+func (sf structField) decodeConv(f reflect.Value, value string) error {
+	v, err := sf.conv.decode(value)
+	if err != nil {
+		return fmt.Errorf("fail to parse field '%s' type: %s value: %s: %v",
+			sf.name, f.Type().String(), value, err)
+	}
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		f.SetZero()
+		return nil
+	}
+	if !rv.Type().AssignableTo(f.Type()) {
+		return fmt.Errorf("fail to parse field '%s': converter returned %s for %s",
+			sf.name, rv.Type().String(), f.Type().String())
+	}
+	f.Set(rv)
+	return nil
+}
@@ -0,0 +1,111 @@
+package dbf
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Money is amount in cents, stored as number with converter.
+type Money int64
+
+// level is stored as text through TextMarshaler.
+type level int
+
+func (l level) MarshalText() ([]byte, error) {
+	switch l {
+	case 0:
+		return []byte("low"), nil
+	case 1:
+		return []byte("high"), nil
+	}
+	return nil, errors.New("unknown level")
+}
+
+func (l *level) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "", "low":
+		*l = 0
+	case "high":
+		*l = 1
+	default:
+		return fmt.Errorf("unknown level %q", b)
+	}
+	return nil
+}
+
+type account struct {
+	Name    string
+	Balance Money `dbf:"BALANCE,type=N,len=12,dec=2"`
+	Level   level `dbf:",len=5"`
+	Prev    *level
+}
+
+func init() {
+	RegisterConverter(reflect.TypeOf(Money(0)),
+		func(v interface{}) (string, error) {
+			return strconv.FormatFloat(float64(v.(Money))/100, 'f', 2, 64), nil
+		},
+		func(s string) (interface{}, error) {
+			if s == "" {
+				return Money(0), nil
+			}
+			f, err := strconv.ParseFloat(s, 64)
+			return Money(math.Round(f * 100)), err
+		})
+}
+
+func TestConverters(t *testing.T) {
+	db := New()
+	if err := db.Create(account{}); err != nil {
+		t.Fatal(err)
+	}
+	if f := db.Fields()[1]; f.Type != "N" || f.Length != 12 || f.Decimals != 2 {
+		t.Fatal("unexpected BALANCE field:", f)
+	}
+	if f := db.Fields()[2]; f.Type != "C" || f.Length != 5 {
+		t.Fatal("unexpected LEVEL field:", f)
+	}
+
+	high := level(1)
+	row := db.Append(account{Name: "acme", Balance: 12345, Level: 1, Prev: &high})
+	if v := db.FieldValue(row, 1); strings.TrimSpace(v) != "123.45" {
+		t.Fatal("expected 123.45 found:", v)
+	}
+	if v := db.FieldValue(row, 2); v != "high" {
+		t.Fatal("expected high found:", v)
+	}
+
+	var a account
+	if err := db.Read(row, &a); err != nil {
+		t.Fatal(err)
+	}
+	if a.Balance != 12345 || a.Level != 1 || a.Prev == nil || *a.Prev != 1 {
+		t.Fatal("unexpected account read:", a)
+	}
+
+	row = db.Append(account{Name: "empty"})
+	if err := db.Read(row, &a); err != nil {
+		t.Fatal(err)
+	}
+	if a.Level != 0 || a.Prev != nil {
+		t.Fatal("expected low level and nil prev found:", a)
+	}
+
+	db.SetFieldValue(row, 2, "bad")
+	if err := db.Read(row, &a); err == nil {
+		t.Fatal("expected unmarshal error")
+	}
+
+	tbl, err := NewTable[account](db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tbl.Append(account{Level: 5}); err == nil {
+		t.Fatal("expected marshal error")
+	}
+}
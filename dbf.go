@@ -3,7 +3,9 @@ package dbf
 import (
 	"errors"
 	"os"
+	"reflect"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -29,6 +31,22 @@ type DbfTable struct {
 	fieldMap map[string]int
 	// list of deleted rows, helps with InsertRecord
 	delRows []int
+	// ordered indexes following changes in the table
+	orders []*order
+	// in-memory indexes by upper case name
+	indexes map[string]*memIndex
+	// _NullFlags bit of every field and index of _NullFlags field, see layoutNulls
+	nullBits  []int
+	nullField int
+	// struct codecs of Read and Write, dropped when fields are added
+	codecs  map[reflect.Type]*codec
+	codecMu sync.RWMutex
+	// how struct fields are matched with table fields, see SetMapping
+	mapping Mapping
+	// one row table computing index keys for Lookup
+	scratch *DbfTable
+	// production .MDX index, opened and saved with the table
+	mdx *Mdx
 	// table structure can not be changed since it has records
 	frozenStruct bool
 	//
@@ -41,6 +59,7 @@ type DbfField struct {
 	Name       string
 	Type       string
 	Length     uint8
+	Decimals   uint8
 	fieldStore [32]byte
 }
 
@@ -75,7 +94,7 @@ func New() *DbfTable {
 
 	// no MDX file (index upon demand)
 	dt.dataStore[28] = 0x00
-	dt.dataStore[28] = 0xf0 // default to UTF-8 encoding, use 0x57 for ANSI.
+	dt.dataStore[29] = 0xf0 // default to UTF-8 encoding, use 0x57 for ANSI.
 	return dt
 }
 
@@ -89,6 +108,35 @@ func LoadFile(fileName string) (table *DbfTable, err error) {
 	if err != nil {
 		return nil, err
 	}
+	dt, err := parseHeader(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(s) < dt.getRowOffset(int(dt.numberOfRecords)) {
+		return nil, errors.New("dbf: file is shorter than number of records in the header")
+	}
+
+	// memorize deleted rows
+	sz := int(dt.numberOfRecords)
+	for i := 0; i < sz; i++ {
+		if dt.IsDeleted(i) {
+			dt.delRows = append(dt.delRows, i)
+		}
+	}
+
+	dt.frozenStruct = true
+	if err := dt.openProductionMdx(fileName); err != nil {
+		return nil, err
+	}
+	return dt, nil
+}
+
+// parseHeader creates DbfTable from dbase file header, s must contain at least
+// the complete header and becomes table dataStore.
+func parseHeader(s []byte) (*DbfTable, error) {
+	if len(s) < 32 {
+		return nil, errors.New("dbf: file is too short for dbase header")
+	}
 	// Create and pupulate DbaseTable struct
 	dt := new(DbfTable)
 	dt.loading = true
@@ -103,6 +151,9 @@ func LoadFile(fileName string) (table *DbfTable, err error) {
 	dt.numberOfRecords = uint32(s[4]) | (uint32(s[5]) << 8) | (uint32(s[6]) << 16) | (uint32(s[7]) << 24)
 	dt.headerSize = uint16(s[8]) | (uint16(s[9]) << 8)
 	dt.recordLength = uint16(s[10]) | (uint16(s[11]) << 8)
+	if len(s) < int(dt.headerSize) || dt.headerSize < 33 {
+		return nil, errors.New("dbf: invalid dbase header size")
+	}
 
 	// create fieldMap to taranslate field name to index
 	dt.fieldMap = make(map[string]int)
@@ -113,6 +164,11 @@ func LoadFile(fileName string) (table *DbfTable, err error) {
 	// populate dbf fields
 	for i := 0; i < int(dt.numberOfFields); i++ {
 		offset := (i * 32) + 32
+		if s[offset] == 0x0D {
+			// header terminator, some writers keep extra bytes after it
+			dt.numberOfFields = i
+			break
+		}
 
 		fieldName := strings.Trim(string(s[offset:offset+10]), string([]byte{0}))
 		dt.fieldMap[fieldName] = i
@@ -127,27 +183,30 @@ func LoadFile(fileName string) (table *DbfTable, err error) {
 			err = dt.AddBoolField(fieldName)
 		case 'D':
 			err = dt.AddDateField(fieldName)
+		default:
+			// keep other types, such as Visual FoxPro _NullFlags, so that
+			// offsets of the following fields are right
+			err = dt.addField(fieldName, s[offset+11], s[offset+16], s[offset+17])
 		}
 
 		if err != nil {
 			return nil, err
 		}
+		// field flags, Visual FoxPro marks nullable fields there
+		dt.fields[len(dt.fields)-1].fieldStore[18] = s[offset+18]
 	}
-
-	// memorize deleted rows
-	sz := int(dt.numberOfRecords)
-	for i := 0; i < sz; i++ {
-		if dt.IsDeleted(i) {
-			dt.delRows = append(dt.delRows, i)
-		}
-	}
-
-	dt.frozenStruct = true
+	dt.layoutNulls()
 	return dt, nil
 }
 
-// SaveFile dbf file.
+// SaveFile dbf file. Production .MDX index is saved next to it. When index
+// can not be saved, as its tag is out of date, production index flag is
+// cleared and table is saved without it, index error is returned.
 func (dt *DbfTable) SaveFile(filename string) error {
+	mdxErr := dt.saveProductionMdx(filename)
+	if mdxErr != nil {
+		dt.ClearMdxFlag()
+	}
 	// don't forget to add dbase end of file marker which is 1Ah
 	dt.dataStore = appendSlice(dt.dataStore, []byte{0x1A})
 	f, err := os.Create(filename)
@@ -160,7 +219,7 @@ func (dt *DbfTable) SaveFile(filename string) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	return mdxErr
 }
 
 // Sets field value by name.
@@ -195,6 +254,7 @@ func (dt *DbfTable) findSpot() int {
 func (dt *DbfTable) Delete(row int) {
 	dt.dataStore[dt.getRowOffset(row)] = 0x2A // set deleted record marker
 	dt.delRows = append(dt.delRows, row)
+	dt.reindex(row)
 }
 
 // IsDeleted row.
@@ -202,72 +262,97 @@ func (dt *DbfTable) IsDeleted(row int) bool {
 	return dt.dataStore[dt.getRowOffset(row)] == 0x2A
 }
 
-// Sets field value by index.
+// Sets field value by index. Panics when value of currency field is not a
+// number or out of range, SetDecimalValue returns the error instead.
 func (dt *DbfTable) SetFieldValue(row int, fieldIndex int, value string) {
+	if err := dt.setFieldValueAt(row, fieldIndex, dt.fieldOffset(fieldIndex), value); err != nil {
+		panic(err.Error())
+	}
+}
+
+// setFieldValueAt sets field value, recordOffset is offset of the field from
+// the start of the record as returned by fieldOffset. Nothing changes when
+// the value can not be stored.
+func (dt *DbfTable) setFieldValueAt(row, fieldIndex, recordOffset int, value string) error {
 	dt.frozenStruct = true // table structure can not be changed from this point
 
-	b := []byte(value)
+	// locate the offset of the field in DbfTable dataStore
+	offset := dt.getRowOffset(row) + recordOffset
 	fieldLength := int(dt.fields[fieldIndex].Length)
 
-	// locate the offset of the field in DbfTable dataStore
-	offset := dt.getRowOffset(row)
+	if err := dt.putField(dt.dataStore[offset:offset+fieldLength], fieldIndex, value); err != nil {
+		return err
+	}
+	dt.clearNull(row, fieldIndex)
+	dt.reindex(row)
+	return nil
+}
+
+// fieldOffset returns offset of the field from the start of the record.
+func (dt *DbfTable) fieldOffset(fieldIndex int) int {
 	recordOffset := 1
+	for i := 0; i < fieldIndex; i++ {
+		recordOffset += int(dt.fields[i].Length)
+	}
+	return recordOffset
+}
 
-	//fmt.Println("total fields: ", dt.fields)
-	for i := 0; i < len(dt.fields); i++ {
-		if i == fieldIndex {
-			break
-		} else {
-			recordOffset += int(dt.fields[i].Length)
-		}
+// putField writes value into cell, which must be exactly field length long.
+// Only currency values are checked, other values are stored as given.
+func (dt *DbfTable) putField(cell []byte, fieldIndex int, value string) error {
+	if dt.fields[fieldIndex].Type == "Y" {
+		return putCurrency(cell, value)
 	}
+	b := []byte(value)
 
 	// first fill the field with space values
-	for i := 0; i < fieldLength; i++ {
-		dt.dataStore[offset+recordOffset+i] = 0x20
+	for i := range cell {
+		cell[i] = 0x20
 	}
 
 	// write new value
-	// TODO: this should use copy() or other fast way to move data
 	switch dt.fields[fieldIndex].Type {
 	case "C", "L", "D":
-		for i := 0; i < len(b) && i < fieldLength; i++ {
-			dt.dataStore[offset+recordOffset+i] = b[i]
-		}
-	case "N":
-		for i := 0; i < fieldLength; i++ {
-			if i < len(b) {
-				dt.dataStore[offset+recordOffset+(fieldLength-i-1)] = b[(len(b)-1)-i]
-			} else {
-				break
-			}
+		copy(cell, b)
+	case "N", "F":
+		// numbers are right aligned
+		if len(b) > len(cell) {
+			b = b[len(b)-len(cell):]
 		}
+		copy(cell[len(cell)-len(b):], b)
 	}
+	return nil
 }
 
 func (dt *DbfTable) FieldValue(row int, fieldIndex int) string {
+	return dt.fieldValueAt(row, fieldIndex, dt.fieldOffset(fieldIndex))
+}
+
+// fieldValueAt returns field value, recordOffset is offset of the field from
+// the start of the record as returned by fieldOffset.
+func (dt *DbfTable) fieldValueAt(row, fieldIndex, recordOffset int) string {
 	offset := int(dt.headerSize)
 	recordLength := int(dt.recordLength)
 
 	offset = offset + (row * recordLength)
-	recordOffset := 1
-
-	for i := 0; i < len(dt.fields); i++ {
-		if i == fieldIndex {
-			break
-		} else {
-			recordOffset += int(dt.fields[i].Length)
-		}
-	}
 
 	temp := dt.dataStore[(offset + recordOffset):((offset + recordOffset) + int(dt.fields[fieldIndex].Length))]
-	for i := 0; i < len(temp); i++ {
-		if temp[i] == 0x00 {
-			temp = temp[0:i]
+	return cellText(&dt.fields[fieldIndex], temp)
+}
+
+// cellText returns value of the field stored in cell, text ends at the first
+// zero byte and is trimmed.
+func cellText(field *DbfField, cell []byte) string {
+	if field.Type == "Y" {
+		return currencyText(cell)
+	}
+	for i := 0; i < len(cell); i++ {
+		if cell[i] == 0x00 {
+			cell = cell[0:i]
 			break
 		}
 	}
-	s := string(temp)
+	s := string(cell)
 	return strings.TrimSpace(s)
 }
 
@@ -288,6 +373,7 @@ func (dt *DbfTable) InsertRecord() int {
 	if row := dt.findSpot(); row > -1 {
 		// undelete selected row
 		dt.dataStore[dt.getRowOffset(row)] = 0x20
+		dt.reindex(row)
 		return row
 	}
 	return dt.AddRecord()
@@ -308,6 +394,7 @@ func (dt *DbfTable) AddRecord() int {
 	dt.dataStore[5] = s[1]
 	dt.dataStore[6] = s[2]
 	dt.dataStore[7] = s[3]
+	dt.reindex(newRecordNumber)
 	return newRecordNumber
 }
 
@@ -331,6 +418,12 @@ func (dt *DbfTable) AddFloatField(fieldName string) error {
 	return dt.addField(fieldName, 'N', 17, 8)
 }
 
+// AddCurrencyField adds Visual FoxPro currency field, 8 byte integer of value
+// times 10000. FieldValue returns its value as text with four decimals.
+func (dt *DbfTable) AddCurrencyField(fieldName string) error {
+	return dt.addField(fieldName, 'Y', 8, currencyScale)
+}
+
 // Boolean field stores 't' or 'f' in the cell.
 func (dt *DbfTable) AddBoolField(fieldName string) error {
 	return dt.addField(fieldName, 'L', 1, 0)
@@ -356,6 +449,11 @@ func (dt *DbfTable) addField(fieldName string, fieldType byte, length, prec uint
 	}
 
 	s := dt.getNormalizedFieldName(fieldName)
+	dt.codecMu.Lock()
+	dt.codecs = nil // struct codecs and null flags depend on the schema
+	dt.codecMu.Unlock()
+	dt.nullBits = nil
+	dt.scratch = nil
 	if dt.isFieldExist(s) {
 		return errors.New("Field with name '" + s + "' already exist!")
 	}
@@ -364,6 +462,7 @@ func (dt *DbfTable) addField(fieldName string, fieldType byte, length, prec uint
 	df.Name = s
 	df.Type = string(fieldType)
 	df.Length = length
+	df.Decimals = prec
 
 	slice := dt.convertToByteSlice(s, 10)
 	// Field name in ASCII (max 10 chracters)
@@ -428,6 +527,7 @@ func (dt *DbfTable) updateHeader() {
 	s = uint32ToBytes(uint32(dt.recordLength))
 	dt.dataStore[10] = s[0]
 	dt.dataStore[11] = s[1]
+	dt.layoutNulls()
 }
 
 // Row reads record at index.
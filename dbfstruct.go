@@ -1,35 +1,6 @@
 package dbf
 
-import (
-	"fmt"
-	"reflect"
-	"strconv"
-)
-
-type Iterator struct {
-	dt     *DbfTable
-	index  int
-	last   int
-	offset int
-}
-
-func (dt *DbfTable) NewIterator() *Iterator {
-	return &Iterator{dt: dt, index: -1, offset: -1, last: dt.NumRecords()}
-}
-
-func (it *Iterator) Index() int {
-	return it.index
-}
-
-// Next iterates over records in the table.
-func (it *Iterator) Next() bool {
-	for it.index++; it.index < it.last; it.index++ {
-		if !it.dt.IsDeleted(it.index) {
-			return true
-		}
-	}
-	return false // it.index < it.last
-}
+import "reflect"
 
 // Read data into struct.
 func (it *Iterator) Read(spec interface{}) error {
@@ -62,47 +33,8 @@ func (dt *DbfTable) Create(spec interface{}) error {
 		panic("dbf: spec parameter must be a struct")
 	}
 
-	var err error
-	typeOfSpec := s.Type()
-	for i := 0; i < s.NumField(); i++ {
-		var sz uint8 = 50 // text fields default to 50 unless specified
-		f := s.Field(i)
-		if typeOfSpec.Field(i).PkgPath != "" || typeOfSpec.Field(i).Anonymous {
-			continue // ignore unexported or embedded fields
-		}
-		fieldName := typeOfSpec.Field(i).Name
-		alt := typeOfSpec.Field(i).Tag.Get("dbf")
-		// ignore '-' tags
-		if alt == "-" {
-			continue
-		}
-		if alt != "" {
-			n, err := strconv.ParseUint(alt, 0, 8)
-			if err != nil {
-				panic("dbf: invalid struct tag " + alt)
-			}
-			sz = uint8(n)
-		}
-
-		switch f.Kind() {
-		default:
-			panic("dbf: unsupported type for database table schema, use dash to omit")
-
-		case reflect.String:
-			err = dt.AddTextField(fieldName, sz)
-
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
-			reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			err = dt.AddIntField(fieldName)
-
-		case reflect.Bool:
-			err = dt.AddBoolField(fieldName)
-
-		case reflect.Float32, reflect.Float64:
-			err = dt.AddFloatField(fieldName)
-		}
-
-		if err != nil {
+	for _, sf := range structFields(s.Type()) {
+		if err := sf.addTo(dt); err != nil {
 			return err
 		}
 	}
@@ -114,7 +46,9 @@ func (dt *DbfTable) Append(spec interface{}) int {
 	return dt.Write(dt.AddRecord(), spec)
 }
 
-// Write data into DbfTable from the spec.
+// Write data into DbfTable from the spec. Panics when converter of a field
+// fails to encode its value, Decimal does not fit its field or when strict
+// mapping finds mismatch.
 func (dt *DbfTable) Write(row int, spec interface{}) int {
 	s := reflect.ValueOf(spec)
 	if s.Kind() == reflect.Ptr {
@@ -124,39 +58,8 @@ func (dt *DbfTable) Write(row int, spec interface{}) int {
 		panic("dbf: spec parameter must be a struct")
 	}
 
-	typeOfSpec := s.Type()
-	for i := 0; i < s.NumField(); i++ {
-		f := s.Field(i)
-		if typeOfSpec.Field(i).PkgPath != "" || typeOfSpec.Field(i).Anonymous {
-			continue // ignore unexported or embedded fields
-		}
-
-		alt := typeOfSpec.Field(i).Tag.Get("dbf")
-		// ignore '-' tags
-		if alt == "-" {
-			continue
-		}
-
-		val := ""
-		switch f.Kind() {
-		default:
-			panic("dbf: unsupported type for database table schema, use dash to omit")
-		case reflect.String:
-			val = f.String()
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
-			reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			val = fmt.Sprintf("%d", f.Int())
-		case reflect.Bool:
-			val = "f"
-			if f.Bool() {
-				val = "t"
-			}
-		case reflect.Float32, reflect.Float64:
-			val = fmt.Sprintf("%f", f.Float())
-		}
-
-		//fmt.Println(typeOfSpec.Field(i).Name)
-		dt.SetFieldValueByName(row, typeOfSpec.Field(i).Name, val)
+	if err := dt.codec(s.Type()).write(dt, row, s); err != nil {
+		panic(err)
 	}
 	return row
 }
@@ -172,52 +75,5 @@ func (dt *DbfTable) Read(row int, spec interface{}) error {
 		panic("dbf: spec parameter must be a struct")
 	}
 
-	typeOfSpec := s.Type()
-	for i := 0; i < s.NumField(); i++ {
-		f := s.Field(i)
-		if f.CanSet() {
-			var fieldName string
-			alt := typeOfSpec.Field(i).Tag.Get("dbf")
-
-			// ignore '-' tags
-			if alt == "-" {
-				continue
-			}
-			fieldName = typeOfSpec.Field(i).Name
-			value := dt.FieldValueByName(row, fieldName)
-
-			switch f.Kind() {
-			default:
-				panic("dbf: unsupported type for database table schema, use dash to omit")
-
-			case reflect.String:
-				f.SetString(value)
-
-			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
-				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-				intValue, err := strconv.ParseInt(value, 0, f.Type().Bits())
-				if err != nil {
-					return fmt.Errorf("fail to parse field '%s' type: %s value: %s",
-						fieldName, f.Type().String(), value)
-				}
-				f.SetInt(intValue)
-
-			case reflect.Bool:
-				if value == "T" || value == "t" || value == "Y" || value == "y" {
-					f.SetBool(true)
-				} else {
-					f.SetBool(false)
-				}
-
-			case reflect.Float32, reflect.Float64:
-				floatValue, err := strconv.ParseFloat(value, f.Type().Bits())
-				if err != nil {
-					return fmt.Errorf("fail to parse field '%s' type: %s value: %s",
-						fieldName, f.Type().String(), value)
-				}
-				f.SetFloat(floatValue)
-			}
-		}
-	}
-	return nil
+	return dt.codec(s.Type()).read(dt, row, s)
 }
@@ -0,0 +1,294 @@
+package dbf
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Decimal is exact decimal number as stored in N, F and Y fields, unlike
+// float64 it keeps 0.1 + 0.2 equal to 0.3. Value is unscaled integer divided
+// by 10 to the power of scale, zero value is 0. Decimals are immutable, their
+// methods return new values.
+type Decimal struct {
+	unscaled *big.Int // nil is zero
+	scale    int      // digits after decimal point, never negative
+}
+
+// NewDecimal returns unscaled * 10^-scale, NewDecimal(12345, 2) is 123.45.
+func NewDecimal(unscaled int64, scale int) Decimal {
+	return newDecimal(big.NewInt(unscaled), scale)
+}
+
+func newDecimal(unscaled *big.Int, scale int) Decimal {
+	if scale < 0 {
+		unscaled.Mul(unscaled, pow10(-scale))
+		scale = 0
+	}
+	return Decimal{unscaled: unscaled, scale: scale}
+}
+
+// pow10 returns 10^n.
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// ParseDecimal reads decimal number as stored in tables: optional sign,
+// digits with optional decimal point and optional exponent, as 1.5E+10 of F
+// fields. Surrounding spaces are ignored, scale is number of digits after the
+// point, so "1.50" keeps two decimals.
+func ParseDecimal(s string) (Decimal, error) {
+	fail := func() (Decimal, error) {
+		return Decimal{}, errors.New("dbf: invalid decimal number '" + s + "'")
+	}
+	t := strings.TrimSpace(s)
+	exp := 0
+	if i := strings.IndexAny(t, "eE"); i >= 0 {
+		n, err := strconv.Atoi(t[i+1:])
+		if err != nil || n > 1000 || n < -1000 {
+			return fail()
+		}
+		t, exp = t[:i], n
+	}
+	neg := false
+	if t != "" && (t[0] == '-' || t[0] == '+') {
+		neg, t = t[0] == '-', t[1:]
+	}
+	intPart, frac, _ := strings.Cut(t, ".")
+	digits := intPart + frac
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return fail()
+	}
+	u, _ := new(big.Int).SetString(digits, 10)
+	if neg {
+		u.Neg(u)
+	}
+	return newDecimal(u, len(frac)-exp), nil
+}
+
+// DecimalFromFloat returns the shortest decimal that converts back to f. NaN
+// and infinities give zero.
+func DecimalFromFloat(f float64) Decimal {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Decimal{}
+	}
+	d, _ := ParseDecimal(strconv.FormatFloat(f, 'f', -1, 64))
+	return d
+}
+
+// DecimalFromRat returns r rounded to scale digits after decimal point, half
+// away from zero. Exact results of Sum and Avg convert with it. Panics when
+// scale is negative.
+func DecimalFromRat(r *big.Rat, scale int) Decimal {
+	if scale < 0 {
+		panic("dbf: negative decimal scale")
+	}
+	num := new(big.Int).Mul(r.Num(), pow10(scale))
+	return Decimal{unscaled: quoRound(num, r.Denom()), scale: scale}
+}
+
+// quoRound returns x / y rounded half away from zero.
+func quoRound(x, y *big.Int) *big.Int {
+	q, m := new(big.Int).QuoRem(x, y, new(big.Int))
+	if m.Sign() != 0 && new(big.Int).Abs(new(big.Int).Lsh(m, 1)).Cmp(new(big.Int).Abs(y)) >= 0 {
+		if x.Sign()*y.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
+
+// int returns unscaled value, never nil.
+func (d Decimal) int() *big.Int {
+	if d.unscaled == nil {
+		return new(big.Int)
+	}
+	return d.unscaled
+}
+
+// rescaled returns unscaled value at greater or equal scale.
+func (d Decimal) rescaled(scale int) *big.Int {
+	return new(big.Int).Mul(d.int(), pow10(scale-d.scale))
+}
+
+// Scale returns number of digits after decimal point.
+func (d Decimal) Scale() int {
+	return d.scale
+}
+
+// Sign returns -1, 0 or 1.
+func (d Decimal) Sign() int {
+	return d.int().Sign()
+}
+
+// IsZero reports whether d is 0.
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+// Cmp compares values, 1.50 and 1.5 are equal.
+func (d Decimal) Cmp(y Decimal) int {
+	scale := max(d.scale, y.scale)
+	return d.rescaled(scale).Cmp(y.rescaled(scale))
+}
+
+// Add returns d + y, scale is the greater of scales.
+func (d Decimal) Add(y Decimal) Decimal {
+	scale := max(d.scale, y.scale)
+	return Decimal{unscaled: new(big.Int).Add(d.rescaled(scale), y.rescaled(scale)), scale: scale}
+}
+
+// Sub returns d - y, scale is the greater of scales.
+func (d Decimal) Sub(y Decimal) Decimal {
+	return d.Add(y.Neg())
+}
+
+// Mul returns d * y, scale is sum of scales.
+func (d Decimal) Mul(y Decimal) Decimal {
+	return Decimal{unscaled: new(big.Int).Mul(d.int(), y.int()), scale: d.scale + y.scale}
+}
+
+// Quo returns d / y rounded to scale digits after decimal point, half away
+// from zero. Panics when y is zero or scale is negative.
+func (d Decimal) Quo(y Decimal, scale int) Decimal {
+	if y.IsZero() {
+		panic("dbf: decimal division by zero")
+	}
+	if scale < 0 {
+		panic("dbf: negative decimal scale")
+	}
+	// d / y = d.u * 10^(y.scale - d.scale) / y.u
+	num := new(big.Int).Mul(d.int(), pow10(max(0, scale+y.scale-d.scale)))
+	den := new(big.Int).Mul(y.int(), pow10(max(0, d.scale-y.scale-scale)))
+	return Decimal{unscaled: quoRound(num, den), scale: scale}
+}
+
+// Neg returns -d.
+func (d Decimal) Neg() Decimal {
+	return Decimal{unscaled: new(big.Int).Neg(d.int()), scale: d.scale}
+}
+
+// Abs returns |d|.
+func (d Decimal) Abs() Decimal {
+	return Decimal{unscaled: new(big.Int).Abs(d.int()), scale: d.scale}
+}
+
+// Round returns d with scale digits after decimal point, rounded half away
+// from zero as xBase ROUND does. Greater scale pads with zeros.
+func (d Decimal) Round(scale int) Decimal {
+	if scale < 0 {
+		scale = 0
+	}
+	if scale >= d.scale {
+		return Decimal{unscaled: d.rescaled(scale), scale: scale}
+	}
+	return Decimal{unscaled: quoRound(d.int(), pow10(d.scale-scale)), scale: scale}
+}
+
+// Rat returns exact value as big.Rat.
+func (d Decimal) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(d.int(), pow10(d.scale))
+}
+
+// Float64 returns the nearest float64.
+func (d Decimal) Float64() float64 {
+	f, _ := d.Rat().Float64()
+	return f
+}
+
+// String returns number with all digits of the scale, as 123.50.
+func (d Decimal) String() string {
+	u := d.int()
+	digits := new(big.Int).Abs(u).String()
+	if d.scale > 0 {
+		if len(digits) <= d.scale {
+			digits = strings.Repeat("0", d.scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-d.scale] + "." + digits[len(digits)-d.scale:]
+	}
+	if u.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Decimal) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Decimal) UnmarshalText(b []byte) error {
+	v, err := ParseDecimal(string(b))
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// DecimalValue returns exact value of N, F or Y field, ok is false for blank,
+// null and invalid cells.
+func (dt *DbfTable) DecimalValue(row, fieldIndex int) (d Decimal, ok bool) {
+	value := dt.FieldValue(row, fieldIndex)
+	if value == "" || dt.IsNull(row, fieldIndex) {
+		return d, false
+	}
+	d, err := ParseDecimal(value)
+	return d, err == nil
+}
+
+// SetDecimalValue stores decimal in N, F or Y field rounded to decimals of
+// the field, error is returned when it does not fit.
+func (dt *DbfTable) SetDecimalValue(row, fieldIndex int, d Decimal) error {
+	s, err := dt.convertValue(&dt.fields[fieldIndex], d)
+	if err != nil {
+		return err
+	}
+	dt.SetFieldValue(row, fieldIndex, s)
+	return nil
+}
+
+// currency fields hold int64 of value times 10000, little endian
+const currencyScale = 4
+
+// currencyText returns value of Y cell, blank when cell was never written.
+func currencyText(cell []byte) string {
+	if strings.Trim(string(cell), " ") == "" {
+		return ""
+	}
+	var u uint64
+	for i := len(cell) - 1; i >= 0; i-- {
+		u = u<<8 | uint64(cell[i])
+	}
+	return NewDecimal(int64(u), currencyScale).String()
+}
+
+// putCurrency stores decimal text in Y cell, blank text as blank cell. Invalid
+// and out of range values leave the cell unchanged and are returned as errors.
+func putCurrency(cell []byte, value string) error {
+	if strings.TrimSpace(value) == "" {
+		for i := range cell {
+			cell[i] = ' '
+		}
+		return nil
+	}
+	d, err := ParseDecimal(value)
+	if err != nil {
+		return err
+	}
+	n := d.Round(currencyScale).int()
+	if !n.IsInt64() {
+		return errors.New("dbf: currency value '" + value + "' is out of range")
+	}
+	u := uint64(n.Int64())
+	for i := range cell {
+		cell[i] = byte(u)
+		u >>= 8
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package dbf
+
+import (
+	"encoding/json"
+	"math/big"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecimal(t *testing.T) {
+	for _, c := range []struct{ in, out string }{
+		{"123.45", "123.45"},
+		{" -0.50 ", "-0.50"},
+		{"+7", "7"},
+		{".5", "0.5"},
+		{"1.5E+3", "1500"},
+		{"25e-4", "0.0025"},
+	} {
+		d, err := ParseDecimal(c.in)
+		if err != nil || d.String() != c.out {
+			t.Fatalf("ParseDecimal(%q) expected %s found: %s %v", c.in, c.out, d, err)
+		}
+	}
+	for _, s := range []string{"", "-", "1.2.3", "1e", "12a", "NaN"} {
+		if _, err := ParseDecimal(s); err == nil {
+			t.Fatalf("expected error for %q", s)
+		}
+	}
+
+	a, _ := ParseDecimal("0.1")
+	b, _ := ParseDecimal("0.2")
+	if sum := a.Add(b); sum.String() != "0.3" || sum.Cmp(NewDecimal(3, 1)) != 0 {
+		t.Fatal("expected 0.3 found:", sum)
+	}
+	price := NewDecimal(1999, 2)
+	if v := price.Mul(NewDecimal(3, 0)).Sub(NewDecimal(5, 1)); v.String() != "59.47" {
+		t.Fatal("expected 59.47 found:", v)
+	}
+	if v := NewDecimal(10, 0).Quo(NewDecimal(3, 0), 4); v.String() != "3.3333" {
+		t.Fatal("expected 3.3333 found:", v)
+	}
+	if v := NewDecimal(-2, 0).Quo(NewDecimal(3, 0), 2); v.String() != "-0.67" {
+		t.Fatal("expected -0.67 found:", v)
+	}
+	if v := NewDecimal(125, 3).Round(2); v.String() != "0.13" {
+		t.Fatal("expected half away from zero 0.13 found:", v)
+	}
+	if v := NewDecimal(-125, 3).Round(2); v.String() != "-0.13" {
+		t.Fatal("expected -0.13 found:", v)
+	}
+	if v := NewDecimal(5, 0).Round(2); v.String() != "5.00" {
+		t.Fatal("expected 5.00 found:", v)
+	}
+	var zero Decimal
+	if !zero.IsZero() || zero.String() != "0" || zero.Add(price).String() != "19.99" {
+		t.Fatal("unexpected zero value:", zero)
+	}
+	if v := DecimalFromFloat(0.1); v.String() != "0.1" {
+		t.Fatal("expected 0.1 found:", v)
+	}
+	if v := DecimalFromRat(big.NewRat(2, 3), 3); v.String() != "0.667" {
+		t.Fatal("expected 0.667 found:", v)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected panic for negative scale")
+			}
+		}()
+		DecimalFromRat(big.NewRat(2, 3), -1)
+	}()
+
+	b2, err := json.Marshal(map[string]Decimal{"x": price})
+	if err != nil || string(b2) != `{"x":"19.99"}` {
+		t.Fatal("unexpected JSON:", string(b2), err)
+	}
+	var m map[string]Decimal
+	if err := json.Unmarshal(b2, &m); err != nil || m["x"].Cmp(price) != 0 {
+		t.Fatal("unexpected decoded JSON:", m, err)
+	}
+}
+
+type Invoice struct {
+	Number string   `dbf:"10"`
+	Total  Decimal  `dbf:",len=12,dec=2"`
+	Rate   Decimal  `dbf:",type=Y"`
+	Tax    *Decimal `dbf:",len=8,dec=2"`
+	Plain  Decimal
+}
+
+func TestDecimalFields(t *testing.T) {
+	db := New()
+	if err := db.Create(Invoice{}); err != nil {
+		t.Fatal(err)
+	}
+	f := db.Fields()
+	if f[1].Type != "N" || f[1].Length != 12 || f[1].Decimals != 2 || f[2].Type != "Y" || f[2].Length != 8 ||
+		f[4].Length != 17 || f[4].Decimals != 8 {
+		t.Fatal("unexpected fields:", f)
+	}
+
+	total, _ := ParseDecimal("1234567.455")
+	rate, _ := ParseDecimal("-0.12345")
+	row := db.Append(Invoice{Number: "A1", Total: total, Rate: rate})
+	if v := db.FieldValue(row, 1); v != "1234567.46" {
+		t.Fatal("expected total rounded to 1234567.46 found:", v)
+	}
+	if v := db.FieldValue(row, 2); v != "-0.1235" {
+		t.Fatal("expected currency -0.1235 found:", v)
+	}
+	if v := db.FieldValue(row, 3); v != "" {
+		t.Fatal("expected blank tax found:", v)
+	}
+
+	path := filepath.Join(t.TempDir(), "invoice.dbf")
+	if err := db.SaveFile(path); err != nil {
+		t.Fatal(err)
+	}
+	db, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inv Invoice
+	if err := db.Read(row, &inv); err != nil {
+		t.Fatal(err)
+	}
+	if inv.Total.String() != "1234567.46" || inv.Rate.String() != "-0.1235" || inv.Tax != nil {
+		t.Fatal("unexpected invoice:", inv)
+	}
+
+	// exact arithmetic on stored values
+	d, ok := db.DecimalValue(row, 1)
+	if !ok {
+		t.Fatal("expected total value")
+	}
+	if err := db.SetDecimalValue(row, 1, d.Add(NewDecimal(1, 2))); err != nil {
+		t.Fatal(err)
+	}
+	if v := db.FieldValue(row, 1); v != "1234567.47" {
+		t.Fatal("expected 1234567.47 found:", v)
+	}
+	if err := db.SetDecimalValue(row, 1, NewDecimal(1, -12)); err == nil {
+		t.Fatal("expected error for value wider than field")
+	}
+	if _, ok := db.DecimalValue(row, 3); ok {
+		t.Fatal("expected no value of blank cell")
+	}
+
+	// maps and aggregates read currency
+	if err := db.WriteMap(row, map[string]interface{}{"rate": "922337203685477.5807"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.WriteMap(row, map[string]interface{}{"rate": "922337203685477.5808"}); err == nil {
+		t.Fatal("expected error for currency out of range")
+	}
+	if err := db.WriteMap(row, map[string]interface{}{"rate": 2.5}); err != nil {
+		t.Fatal(err)
+	}
+	if m := db.RowMap(row); m["RATE"] != 2.5 {
+		t.Fatal("expected rate 2.5 found:", m["RATE"])
+	}
+	if sum, err := db.Sum("rate"); err != nil || sum.Cmp(big.NewRat(5, 2)) != 0 {
+		t.Fatal("unexpected sum of currency:", sum, err)
+	}
+
+	// values wider than field are errors, invalid currency text changes nothing
+	tax, _ := ParseDecimal("1234567.89")
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected panic for tax wider than field")
+			}
+		}()
+		db.Write(row, Invoice{Number: "A1", Tax: &tax})
+	}()
+	db.SetFieldValue(row, 2, "2.5")
+	for _, value := range []string{"bad", "922337203685477.5808"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected panic for currency", value)
+				}
+			}()
+			db.SetFieldValue(row, 2, value)
+		}()
+	}
+	if v := db.FieldValue(row, 2); v != "2.5000" {
+		t.Fatal("expected unchanged currency found:", v)
+	}
+}
@@ -4,7 +4,20 @@ Package for working with dBase III plus database files.
 1. Package provides both reflection-via-struct interface and direct Row()/FieldValueByName()/AddxxxField() interface.
 2. Once table is created and rows added to it, table structure can not be modified.
 3. Working with reflection-via-struct interface is easier and produces less verbose code.
-4. Use Iterator to iterate over table since it skips deleted rows.
+4. Use Iterator to iterate over table since it skips deleted rows, NewIterator options add filters and orderings.
+5. Clipper .NTX indexes can be opened or created with OpenNtx/CreateNtx, they follow table changes.
+6. FoxPro .CDX compound indexes are handled the same way with OpenCdx/CreateCdx and their tags.
+7. dBase IV .MDX production index is opened by LoadFile and saved by SaveFile, see Mdx and CreateMdx.
+8. In-memory indexes are built with CreateIndex and used with Seek and Range.
+9. Package dbf/expr evaluates xBase expressions for filters and index keys.
+10. Rows and Table[T] give range-over-func iteration and typed access to rows.
+11. RowMap, WriteMap and AppendMap read and write rows as maps of typed values.
+12. Package dbf/sqldriver registers database/sql driver "dbf" for directories of .dbf files.
+13. Package dbf/query runs SQL with joins and grouping on tables in memory, using their indexes.
+14. Sum, Avg, Min, Max, Count and GroupBy(...).Agg compute totals, numbers are exact big.Rat.
+15. Decimal holds exact N and Y (currency) values, in struct fields too.
+16. SortTo and SortFile write sorted copies of tables, SortFile merges runs spilled to disk.
+17. Collations order text by case, accents and language in sorts, in-memory indexes and queries.
 
 TODO: File is loaded and kept in-memory. Not a good design choice if file is huge.
 This should be changed to use buffers and keep some of the data on-disk in the future.
@@ -0,0 +1,483 @@
+package expr
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tadvi/dbf"
+)
+
+// numberWidth is width of numeric results not coming from fields, as in STR.
+const numberWidth = 10
+
+// env is the row expression is evaluated for.
+type env struct {
+	dt  *dbf.DbfTable
+	row int
+}
+
+// node is compiled and type checked part of expression. Values are string,
+// float64, time.Time and bool for types C, N, D and L.
+type node struct {
+	t    byte // C, N, D or L
+	w    int  // width of text and numeric results
+	d    int  // decimals of numeric results
+	eval func(e *env) interface{}
+	// constant is set for literals, their value does not depend on the row
+	constant bool
+}
+
+func constant(t byte, v interface{}, w, d int) *node {
+	return &node{t: t, w: w, d: d, eval: func(e *env) interface{} { return v }, constant: true}
+}
+
+func (p *parser) logical(pos int, op string, x, y *node) (*node, error) {
+	if x.t != 'L' || y.t != 'L' {
+		return nil, p.errorAt(pos, "operands of ."+op+". must be logical")
+	}
+	if op == "AND" {
+		return &node{t: 'L', w: 1, eval: func(e *env) interface{} { return x.eval(e).(bool) && y.eval(e).(bool) }}, nil
+	}
+	return &node{t: 'L', w: 1, eval: func(e *env) interface{} { return x.eval(e).(bool) || y.eval(e).(bool) }}, nil
+}
+
+func (p *parser) comparison(pos int, op string, x, y *node) (*node, error) {
+	if x.t != y.t {
+		return nil, p.errorAt(pos, "type mismatch, "+typeName(x.t)+" "+op+" "+typeName(y.t))
+	}
+	if op == "$" {
+		if x.t != 'C' {
+			return nil, p.errorAt(pos, "operands of $ must be character")
+		}
+		return &node{t: 'L', w: 1, eval: func(e *env) interface{} {
+			return strings.Contains(y.eval(e).(string), x.eval(e).(string))
+		}}, nil
+	}
+
+	var cmp func(a, b interface{}) int
+	switch x.t {
+	case 'C':
+		cmp = func(a, b interface{}) int { return compareText(a.(string), b.(string), op) }
+	case 'N':
+		cmp = func(a, b interface{}) int { return compareNumber(a.(float64), b.(float64)) }
+	case 'D':
+		cmp = func(a, b interface{}) int { return compareNumber(julian(a.(time.Time)), julian(b.(time.Time))) }
+	case 'L':
+		cmp = func(a, b interface{}) int { return compareNumber(boolNumber(a.(bool)), boolNumber(b.(bool))) }
+	}
+
+	var test func(c int) bool
+	switch op {
+	case "=", "==":
+		test = func(c int) bool { return c == 0 }
+	case "!=", "<>", "#":
+		test = func(c int) bool { return c != 0 }
+	case "<":
+		test = func(c int) bool { return c < 0 }
+	case "<=":
+		test = func(c int) bool { return c <= 0 }
+	case ">":
+		test = func(c int) bool { return c > 0 }
+	case ">=":
+		test = func(c int) bool { return c >= 0 }
+	}
+	return &node{t: 'L', w: 1, eval: func(e *env) interface{} { return test(cmp(x.eval(e), y.eval(e))) }}, nil
+}
+
+// compareText compares strings the xBase way. With = and friends, SET EXACT
+// OFF, left side is compared only up to the length of the right side. With ==
+// trailing blanks are ignored. Shorter string is padded with blanks.
+func compareText(a, b, op string) int {
+	switch op {
+	case "==":
+		a, b = strings.TrimRight(a, " "), strings.TrimRight(b, " ")
+	case "<", "<=", ">", ">=":
+	default:
+		if len(a) > len(b) {
+			a = a[:len(b)]
+		}
+	}
+	if len(a) < len(b) {
+		a = pad(a, len(b))
+	} else if len(b) < len(a) {
+		b = pad(b, len(a))
+	}
+	return strings.Compare(a, b)
+}
+
+func compareNumber(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func boolNumber(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (p *parser) arithmetic(pos int, op string, x, y *node) (*node, error) {
+	switch {
+	case x.t == 'N' && y.t == 'N':
+		d := x.d
+		if y.d > d {
+			d = y.d
+		}
+		var fn func(a, b float64) float64
+		switch op {
+		case "+":
+			fn = func(a, b float64) float64 { return a + b }
+		case "-":
+			fn = func(a, b float64) float64 { return a - b }
+		case "*":
+			fn = func(a, b float64) float64 { return a * b }
+		case "/":
+			fn = func(a, b float64) float64 { return a / b }
+		case "%":
+			fn = math.Mod
+		case "^":
+			fn = math.Pow
+		}
+		w := x.w
+		if y.w > w {
+			w = y.w
+		}
+		return &node{t: 'N', w: w, d: d, eval: func(e *env) interface{} {
+			return fn(x.eval(e).(float64), y.eval(e).(float64))
+		}}, nil
+
+	case x.t == 'C' && y.t == 'C' && op == "+":
+		return &node{t: 'C', w: x.w + y.w, eval: func(e *env) interface{} {
+			return x.eval(e).(string) + y.eval(e).(string)
+		}}, nil
+
+	case x.t == 'C' && y.t == 'C' && op == "-":
+		// trailing blanks of the left side are moved to the end
+		return &node{t: 'C', w: x.w + y.w, eval: func(e *env) interface{} {
+			a, b := x.eval(e).(string), y.eval(e).(string)
+			t := strings.TrimRight(a, " ")
+			return t + b + strings.Repeat(" ", len(a)-len(t))
+		}}, nil
+
+	case x.t == 'D' && y.t == 'N' && (op == "+" || op == "-"),
+		x.t == 'N' && y.t == 'D' && op == "+":
+		if x.t == 'N' {
+			x, y = y, x
+		}
+		sign := 1
+		if op == "-" {
+			sign = -1
+		}
+		return &node{t: 'D', w: 8, eval: func(e *env) interface{} {
+			d := x.eval(e).(time.Time)
+			if d.IsZero() {
+				return d
+			}
+			return d.AddDate(0, 0, sign*int(y.eval(e).(float64)))
+		}}, nil
+
+	case x.t == 'D' && y.t == 'D' && op == "-":
+		return &node{t: 'N', w: numberWidth, eval: func(e *env) interface{} {
+			return julian(x.eval(e).(time.Time)) - julian(y.eval(e).(time.Time))
+		}}, nil
+	}
+	return nil, p.errorAt(pos, "operator "+op+" can not be used with "+typeName(x.t)+" and "+typeName(y.t))
+}
+
+// function describes argument types, '?' is any type, last optional arguments
+// can be left out.
+type function struct {
+	args     string
+	optional int
+	build    func(args []*node) (*node, error)
+}
+
+var functions map[string]function
+
+func init() {
+	text := func(fn func(string) string) function {
+		return function{args: "C", build: func(args []*node) (*node, error) {
+			x := args[0]
+			return &node{t: 'C', w: x.w, eval: func(e *env) interface{} { return fn(x.eval(e).(string)) }}, nil
+		}}
+	}
+	number := func(fn func(float64) float64) function {
+		return function{args: "N", build: func(args []*node) (*node, error) {
+			x := args[0]
+			return &node{t: 'N', w: x.w, d: x.d, eval: func(e *env) interface{} { return fn(x.eval(e).(float64)) }}, nil
+		}}
+	}
+	datePart := func(fn func(time.Time) int) function {
+		return function{args: "D", build: func(args []*node) (*node, error) {
+			x := args[0]
+			return &node{t: 'N', w: numberWidth, eval: func(e *env) interface{} {
+				d := x.eval(e).(time.Time)
+				if d.IsZero() {
+					return 0.0
+				}
+				return float64(fn(d))
+			}}, nil
+		}}
+	}
+
+	functions = map[string]function{
+		"UPPER":   text(func(s string) string { return mapASCII(s, 'a', 'A') }),
+		"LOWER":   text(func(s string) string { return mapASCII(s, 'A', 'a') }),
+		"TRIM":    text(func(s string) string { return strings.TrimRight(s, " ") }),
+		"RTRIM":   text(func(s string) string { return strings.TrimRight(s, " ") }),
+		"LTRIM":   text(func(s string) string { return strings.TrimLeft(s, " ") }),
+		"ALLTRIM": text(func(s string) string { return strings.Trim(s, " ") }),
+		"ABS":     number(math.Abs),
+		"INT":     number(math.Trunc),
+		"YEAR":    datePart(func(d time.Time) int { return d.Year() }),
+		"MONTH":   datePart(func(d time.Time) int { return int(d.Month()) }),
+		"DAY":     datePart(func(d time.Time) int { return d.Day() }),
+
+		"SUBSTR": {args: "CNN", optional: 1, build: func(args []*node) (*node, error) {
+			s, start := args[0], args[1]
+			w := s.w
+			var count *node
+			if len(args) == 3 {
+				count = args[2]
+				w = constWidth(count, w)
+			}
+			return &node{t: 'C', w: w, eval: func(e *env) interface{} {
+				v := s.eval(e).(string)
+				from := int(start.eval(e).(float64)) - 1
+				if from < 0 {
+					from = 0
+				}
+				if from > len(v) {
+					return ""
+				}
+				v = v[from:]
+				if count != nil {
+					if n := int(count.eval(e).(float64)); n < len(v) {
+						v = v[:maxInt(n, 0)]
+					}
+				}
+				return v
+			}}, nil
+		}},
+		"LEFT": {args: "CN", build: func(args []*node) (*node, error) {
+			s, count := args[0], args[1]
+			return &node{t: 'C', w: constWidth(count, s.w), eval: func(e *env) interface{} {
+				v := s.eval(e).(string)
+				if n := int(count.eval(e).(float64)); n < len(v) {
+					v = v[:maxInt(n, 0)]
+				}
+				return v
+			}}, nil
+		}},
+		"RIGHT": {args: "CN", build: func(args []*node) (*node, error) {
+			s, count := args[0], args[1]
+			return &node{t: 'C', w: constWidth(count, s.w), eval: func(e *env) interface{} {
+				v := s.eval(e).(string)
+				if n := int(count.eval(e).(float64)); n < len(v) {
+					v = v[len(v)-maxInt(n, 0):]
+				}
+				return v
+			}}, nil
+		}},
+		"LEN": {args: "C", build: func(args []*node) (*node, error) {
+			s := args[0]
+			return &node{t: 'N', w: numberWidth, eval: func(e *env) interface{} { return float64(len(s.eval(e).(string))) }}, nil
+		}},
+		"ROUND": {args: "NN", build: func(args []*node) (*node, error) {
+			x, places := args[0], args[1]
+			return &node{t: 'N', w: x.w, d: constWidth(places, x.d), eval: func(e *env) interface{} {
+				p := math.Pow10(int(places.eval(e).(float64)))
+				return math.Round(x.eval(e).(float64)*p) / p
+			}}, nil
+		}},
+		"STR": {args: "NNN", optional: 2, build: func(args []*node) (*node, error) {
+			x := args[0]
+			w, d := numberWidth, 0
+			if len(args) > 1 {
+				if w = constWidth(args[1], -1); w < 1 {
+					return nil, errors.New("STR() length must be a positive constant")
+				}
+			}
+			if len(args) > 2 {
+				if d = constWidth(args[2], -1); d < 0 {
+					return nil, errors.New("STR() decimals must be a constant")
+				}
+			}
+			return &node{t: 'C', w: w, eval: func(e *env) interface{} { return formatNumber(x.eval(e).(float64), w, d) }}, nil
+		}},
+		"VAL": {args: "C", build: func(args []*node) (*node, error) {
+			s := args[0]
+			return &node{t: 'N', w: numberWidth, d: 2, eval: func(e *env) interface{} { return val(s.eval(e).(string)) }}, nil
+		}},
+		"DTOS": {args: "D", build: func(args []*node) (*node, error) {
+			x := args[0]
+			return &node{t: 'C', w: 8, eval: func(e *env) interface{} { return dtos(x.eval(e).(time.Time)) }}, nil
+		}},
+		"DTOC": {args: "D", build: func(args []*node) (*node, error) {
+			x := args[0]
+			return &node{t: 'C', w: 10, eval: func(e *env) interface{} {
+				d := x.eval(e).(time.Time)
+				if d.IsZero() {
+					return "  /  /    "
+				}
+				return d.Format("01/02/2006")
+			}}, nil
+		}},
+		"CTOD": {args: "C", build: func(args []*node) (*node, error) {
+			s := args[0]
+			return &node{t: 'D', w: 8, eval: func(e *env) interface{} {
+				d, _ := ctod(s.eval(e).(string))
+				return d
+			}}, nil
+		}},
+		"EMPTY": {args: "?", build: func(args []*node) (*node, error) {
+			x := args[0]
+			return &node{t: 'L', w: 1, eval: func(e *env) interface{} {
+				switch v := x.eval(e).(type) {
+				case string:
+					return strings.TrimSpace(v) == ""
+				case float64:
+					return v == 0
+				case time.Time:
+					return v.IsZero()
+				case bool:
+					return !v
+				}
+				return true
+			}}, nil
+		}},
+		"IIF": {args: "L??", build: func(args []*node) (*node, error) {
+			c, a, b := args[0], args[1], args[2]
+			if a.t != b.t {
+				return nil, errors.New("IIF() results must have the same type")
+			}
+			w, d := a.w, a.d
+			if b.w > w {
+				w = b.w
+			}
+			if b.d > d {
+				d = b.d
+			}
+			return &node{t: a.t, w: w, d: d, eval: func(e *env) interface{} {
+				if c.eval(e).(bool) {
+					return a.eval(e)
+				}
+				return b.eval(e)
+			}}, nil
+		}},
+		"DELETED": {build: func(args []*node) (*node, error) {
+			return &node{t: 'L', w: 1, eval: func(e *env) interface{} { return e.dt.IsDeleted(e.row) }}, nil
+		}},
+		"RECNO": {build: func(args []*node) (*node, error) {
+			return &node{t: 'N', w: numberWidth, eval: func(e *env) interface{} { return float64(e.row + 1) }}, nil
+		}},
+	}
+}
+
+// constWidth returns value of constant numeric argument, def if it is not constant.
+func constWidth(n *node, def int) int {
+	if !n.constant {
+		return def
+	}
+	if v, ok := n.eval(nil).(float64); ok {
+		return int(v)
+	}
+	return def
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// mapASCII changes case of ASCII letters starting with from to letters
+// starting with to. Text is mapped byte by byte, so code page letters and key
+// widths are kept.
+func mapASCII(s string, from, to byte) string {
+	b := []byte(s)
+	for i, c := range b {
+		if from <= c && c <= from+'z'-'a' {
+			b[i] = c - from + to
+		}
+	}
+	return string(b)
+}
+
+// pad string with blanks to width.
+func pad(s string, w int) string {
+	if len(s) >= w {
+		return s
+	}
+	return s + strings.Repeat(" ", w-len(s))
+}
+
+// formatNumber works as STR(), numbers too wide for the field become asterisks.
+func formatNumber(f float64, w, d int) string {
+	s := strconv.FormatFloat(f, 'f', d, 64)
+	if len(s) > w {
+		return strings.Repeat("*", w)
+	}
+	return strings.Repeat(" ", w-len(s)) + s
+}
+
+// val reads number from the start of the string the way VAL() does.
+func val(s string) float64 {
+	s = strings.TrimLeft(s, " ")
+	end := 0
+	for end < len(s) {
+		c := s[end]
+		if c >= '0' && c <= '9' || c == '.' || (c == '-' || c == '+') && end == 0 {
+			end++
+			continue
+		}
+		break
+	}
+	for end > 0 {
+		if f, err := strconv.ParseFloat(s[:end], 64); err == nil {
+			return f
+		}
+		end--
+	}
+	return 0
+}
+
+// dtos formats date as YYYYMMDD, blank dates are blanks.
+func dtos(d time.Time) string {
+	if d.IsZero() {
+		return "        "
+	}
+	return d.Format("20060102")
+}
+
+// ctod reads MM/DD/YYYY date, blank text is a blank date.
+func ctod(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if strings.Trim(s, " /.-") == "" {
+		return time.Time{}, true
+	}
+	for _, layout := range []string{"01/02/2006", "1/2/2006", "01/02/06"} {
+		if d, err := time.Parse(layout, s); err == nil {
+			return d, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// julian returns day number of the date, zero for blank dates.
+func julian(d time.Time) float64 {
+	if d.IsZero() {
+		return 0
+	}
+	return float64(d.Unix()/86400 + 2440588)
+}
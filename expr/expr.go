@@ -0,0 +1,152 @@
+/*
+Package expr parses and evaluates xBase expressions against rows of dbf tables.
+
+Expressions use the dialect found in index keys and SET FILTER conditions:
+
+	UPPER(LASTNAME)+DTOS(BIRTHDATE)
+	AMOUNT > 100 .AND. !DELETED()
+
+Values are character, numeric, date or logical. Operators are + - * / % ^,
+comparisons = == != <> # < <= > >= and $ (contained in), and the logical
+.AND. .OR. .NOT. (also !). Literals are "text", 'text', [text], numbers,
+.T. .F. and dates written as {^2006-01-02} or {01/02/2006}.
+
+Functions: UPPER, LOWER, TRIM, RTRIM, LTRIM, ALLTRIM, SUBSTR, LEFT, RIGHT,
+LEN, STR, VAL, DTOS, DTOC, CTOD, YEAR, MONTH, DAY, ABS, INT, ROUND, EMPTY,
+IIF, DELETED and RECNO.
+
+Importing the package registers it with dbf, so that index files with such
+key expressions and FOR conditions are maintained as the table changes.
+*/
+package expr
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/tadvi/dbf"
+)
+
+func init() {
+	dbf.RegisterExpr(compile)
+}
+
+// Expr is expression compiled for a table.
+type Expr struct {
+	dt  *dbf.DbfTable
+	src string
+	n   *node
+}
+
+// Compile parses expression and checks it against fields of the table.
+func Compile(dt *dbf.DbfTable, src string) (*Expr, error) {
+	p := &parser{dt: dt, src: src}
+	if err := p.lex(); err != nil {
+		return nil, err
+	}
+	n, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	return &Expr{dt: dt, src: src, n: n}, nil
+}
+
+// Filter compiles logical expression, for example "AMOUNT > 100 .AND. !DELETED()".
+func Filter(dt *dbf.DbfTable, src string) (*Expr, error) {
+	e, err := Compile(dt, src)
+	if err != nil {
+		return nil, err
+	}
+	if e.n.t != 'L' {
+		return nil, errors.New("expr: filter '" + src + "' is not a logical expression")
+	}
+	return e, nil
+}
+
+// String returns expression source.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Type returns type of the expression result: C, N, D or L.
+func (e *Expr) Type() string {
+	return string(e.n.t)
+}
+
+// Len returns length of index key built from the expression.
+func (e *Expr) Len() int {
+	switch e.n.t {
+	case 'D':
+		return 8
+	case 'L':
+		return 1
+	}
+	return e.n.w
+}
+
+// Eval evaluates expression for the row, result is string, float64, time.Time
+// or bool. Blank dates are zero time.
+func (e *Expr) Eval(row int) interface{} {
+	return e.n.eval(&env{dt: e.dt, row: row})
+}
+
+// Match evaluates logical expression for the row, other expressions never match.
+func (e *Expr) Match(row int) bool {
+	b, ok := e.Eval(row).(bool)
+	return ok && b
+}
+
+// Key returns index key for the row: text is padded to key length, numbers are
+// formatted like STR, dates like DTOS and logicals as T or F.
+func (e *Expr) Key(row int) string {
+	switch v := e.Eval(row).(type) {
+	case float64:
+		return formatNumber(v, e.n.w, e.n.d)
+	case time.Time:
+		return dtos(v)
+	case bool:
+		if v {
+			return "T"
+		}
+		return "F"
+	case string:
+		if len(v) >= e.n.w {
+			return v[:e.n.w]
+		}
+		return v + strings.Repeat(" ", e.n.w-len(v))
+	}
+	return ""
+}
+
+// KeyFunc returns index key function of the expression, use it with index
+// builders such as CreateNtxFunc.
+func (e *Expr) KeyFunc() dbf.KeyFunc {
+	return func(dt *dbf.DbfTable, row int) (string, bool) {
+		return e.Key(row), true
+	}
+}
+
+// CondFunc returns key function which leaves out rows where logical expression
+// is false, as index FOR conditions do.
+func (e *Expr) CondFunc() dbf.KeyFunc {
+	return func(dt *dbf.DbfTable, row int) (string, bool) {
+		return "", e.Match(row)
+	}
+}
+
+// compile is registered with dbf for index key expressions and conditions.
+func compile(dt *dbf.DbfTable, src string, cond bool) (dbf.KeyFunc, int, error) {
+	if cond {
+		e, err := Filter(dt, src)
+		if err != nil {
+			return nil, 0, err
+		}
+		return e.CondFunc(), 0, nil
+	}
+	e, err := Compile(dt, src)
+	if err != nil {
+		return nil, 0, err
+	}
+	return e.KeyFunc(), e.Len(), nil
+}
@@ -0,0 +1,131 @@
+package expr
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tadvi/dbf"
+)
+
+func testTable() *dbf.DbfTable {
+	db := dbf.New()
+	db.AddTextField("last", 10)
+	db.AddNumberField("amount", 10, 2)
+	db.AddDateField("born")
+	db.AddBoolField("active")
+	db.AddCurrencyField("price")
+	rows := [][]string{
+		{"smith", "150.50", "19800215", "T", "1234.5678"},
+		{"Jones", "99", "19991231", "F", "-2"},
+		{"brown", "100", "", "T"},
+		{"m\x81ller", "1", "", "F"}, // code page 437
+	}
+	for _, r := range rows {
+		row := db.AddRecord()
+		for i, v := range r {
+			db.SetFieldValue(row, i, v)
+		}
+	}
+	return db
+}
+
+func TestEval(t *testing.T) {
+	db := testTable()
+	tests := []struct {
+		src  string
+		row  int
+		want interface{}
+	}{
+		{"UPPER(LAST)+DTOS(BORN)", 0, "SMITH     19800215"},
+		{"TRIM(last) + '-' + STR(AMOUNT, 8, 1)", 0, "smith-   150.5"},
+		{"AMOUNT > 100 .AND. !DELETED()", 0, true},
+		{"AMOUNT > 100 .and. .not. DELETED()", 1, false},
+		{"amount*2 - 1", 1, 197.0},
+		{"LAST = 'Jo'", 1, true},
+		{"LAST == 'Jo'", 1, false},
+		{"LAST == \"Jones\"", 1, true},
+		{"'on' $ LAST", 1, true},
+		{"SUBSTR(LAST, 2, 3)", 2, "row"},
+		{"VAL('12.5abc') + 1", 0, 13.5},
+		{"IIF(ACTIVE, 'Y', 'N')", 1, "N"},
+		{"RECNO()", 2, 3.0},
+		{"EMPTY(BORN)", 2, true},
+		{"BORN + 1 = CTOD('01/01/2000')", 1, true},
+		{"BORN > {^1990-01-01}", 1, true},
+		{"BORN - {01/01/1980}", 0, 45.0},
+		{"YEAR(BORN)", 0, 1980.0},
+		{"(1 + 2) * 3 ^ 2", 0, 27.0},
+		{"ACTIVE .OR. AMOUNT < 100", 1, true},
+		{"x->LAST = 'smith'", 0, true},
+		{"UPPER(LAST)", 3, "M\x81LLER    "},
+		{"LOWER('\x8eBC')", 3, "\x8ebc"},
+		{"PRICE > 100", 0, true},
+		{"PRICE * 2", 1, -4.0},
+		{"STR(PRICE, 10, 2)", 0, "   1234.57"},
+	}
+	for _, test := range tests {
+		e, err := Compile(db, test.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := e.Eval(test.row); got != test.want {
+			t.Fatalf("%s: expected %#v found: %#v", test.src, test.want, got)
+		}
+	}
+
+	for _, src := range []string{"LAST + 1", "NOPE", "UPPER(AMOUNT)", "SUBSTR(LAST)", "(LAST", "IIF(.T., 1, 'a')", "'abc"} {
+		if _, err := Compile(db, src); err == nil {
+			t.Fatal("expected compile error for:", src)
+		}
+	}
+	if _, err := Filter(db, "LAST"); err == nil {
+		t.Fatal("filter must be logical")
+	}
+
+	d := time.Date(1999, 12, 31, 0, 0, 0, 0, time.UTC)
+	if got := (&Expr{dt: db, n: constant('D', d, 8, 0)}).Key(0); got != "19991231" {
+		t.Fatal("expected date key 19991231 found:", got)
+	}
+}
+
+func TestWhereExpr(t *testing.T) {
+	db := testTable()
+	it := db.NewIterator(dbf.WhereExpr("AMOUNT >= 100 .AND. ACTIVE"))
+	rows := []int{}
+	for it.Next() {
+		rows = append(rows, it.Index())
+	}
+	if it.Err() != nil || len(rows) != 2 || rows[0] != 0 || rows[1] != 2 {
+		t.Fatal("expected rows 0 and 2 found:", rows, it.Err())
+	}
+	if err := db.NewIterator(dbf.WhereExpr("AMOUNT")).Err(); err == nil {
+		t.Fatal("numeric filter should fail")
+	}
+}
+
+func TestIndexExpr(t *testing.T) {
+	db := testTable()
+	defer os.Remove("temp.ntx")
+
+	x, err := db.CreateNtx("temp.ntx", "UPPER(LAST)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row, ok := x.Seek("JONES"); !ok || row != 1 {
+		t.Fatal("seek failed, found:", ok, row)
+	}
+	db.SetFieldValue(2, 0, "adams")
+	if it := x.Iterator(); !it.Next() || it.Index() != 2 {
+		t.Fatal("index does not follow table changes")
+	}
+	x.Close()
+
+	x, err = db.OpenNtx("temp.ntx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+}
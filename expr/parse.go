@@ -0,0 +1,466 @@
+package expr
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/tadvi/dbf"
+)
+
+// token kinds
+const (
+	tokEOF = iota
+	tokNum
+	tokStr
+	tokDate
+	tokBool
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind int
+	text string // operators and identifiers are upper case
+	pos  int
+}
+
+// dotWords are operators and literals written between dots.
+var dotWords = map[string]string{
+	".AND.": "AND", ".OR.": "OR", ".NOT.": "NOT",
+	".T.": "T", ".F.": "F", ".Y.": "T", ".N.": "F",
+}
+
+// ops are symbol operators, longer ones first.
+var ops = []string{"**", "==", "!=", "<>", "<=", ">=", "->",
+	"+", "-", "*", "/", "%", "^", "=", "#", "<", ">", "$", "!", "(", ")", ","}
+
+type parser struct {
+	dt   *dbf.DbfTable
+	src  string
+	toks []token
+	pos  int
+}
+
+// lex splits source into tokens.
+func (p *parser) lex() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+
+		case c == '"' || c == '\'' || c == '[':
+			end := c
+			if c == '[' {
+				end = ']'
+			}
+			j := strings.IndexByte(s[i+1:], end)
+			if j < 0 {
+				return p.errorAt(i, "unterminated string")
+			}
+			p.toks = append(p.toks, token{kind: tokStr, text: s[i+1 : i+1+j], pos: i})
+			i += j + 2
+
+		case c == '{':
+			j := strings.IndexByte(s[i:], '}')
+			if j < 0 {
+				return p.errorAt(i, "unterminated date")
+			}
+			p.toks = append(p.toks, token{kind: tokDate, text: strings.TrimSpace(s[i+1 : i+j]), pos: i})
+			i += j + 1
+
+		case c == '.' && dotWord(s[i:]) != "":
+			w := dotWord(s[i:])
+			kind := tokOp
+			if v := dotWords[w]; v == "T" || v == "F" {
+				kind = tokBool
+			}
+			p.toks = append(p.toks, token{kind: kind, text: dotWords[w], pos: i})
+			i += len(w)
+
+		case c >= '0' && c <= '9' || c == '.':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.' && dotWord(s[j:]) == "") {
+				j++
+			}
+			p.toks = append(p.toks, token{kind: tokNum, text: s[i:j], pos: i})
+			i = j
+
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i
+			for j < len(s) && (s[j] == '_' || unicode.IsLetter(rune(s[j])) || s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			p.toks = append(p.toks, token{kind: tokIdent, text: strings.ToUpper(s[i:j]), pos: i})
+			i = j
+
+		default:
+			op := ""
+			for _, o := range ops {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return p.errorAt(i, "unexpected character "+strconv.QuoteRune(rune(c)))
+			}
+			p.toks = append(p.toks, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	p.toks = append(p.toks, token{kind: tokEOF, pos: len(s)})
+	return nil
+}
+
+// dotWord returns dot operator or literal at the start of s.
+func dotWord(s string) string {
+	j := strings.IndexByte(s[1:], '.')
+	if j < 0 {
+		return ""
+	}
+	w := strings.ToUpper(s[:j+2])
+	if _, ok := dotWords[w]; ok {
+		return w
+	}
+	return ""
+}
+
+func (p *parser) errorAt(pos int, msg string) error {
+	return errors.New("expr: " + msg + " at position " + strconv.Itoa(pos+1) + " in '" + p.src + "'")
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes operator if it is next.
+func (p *parser) accept(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		return p.errorAt(p.peek().pos, "expected '"+op+"'")
+	}
+	return nil
+}
+
+// parse whole expression.
+func (p *parser) parse() (*node, error) {
+	n, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorAt(t.pos, "unexpected '"+t.text+"'")
+	}
+	return n, nil
+}
+
+func (p *parser) or() (*node, error) {
+	x, err := p.and()
+	for err == nil {
+		pos := p.peek().pos
+		if _, ok := p.accept("OR"); !ok {
+			break
+		}
+		var y *node
+		if y, err = p.and(); err == nil {
+			x, err = p.logical(pos, "OR", x, y)
+		}
+	}
+	return x, err
+}
+
+func (p *parser) and() (*node, error) {
+	x, err := p.not()
+	for err == nil {
+		pos := p.peek().pos
+		if _, ok := p.accept("AND"); !ok {
+			break
+		}
+		var y *node
+		if y, err = p.not(); err == nil {
+			x, err = p.logical(pos, "AND", x, y)
+		}
+	}
+	return x, err
+}
+
+func (p *parser) not() (*node, error) {
+	pos := p.peek().pos
+	if _, ok := p.accept("NOT", "!"); ok {
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		if x.t != 'L' {
+			return nil, p.errorAt(pos, "operand of .NOT. must be logical")
+		}
+		return &node{t: 'L', w: 1, eval: func(e *env) interface{} { return !x.eval(e).(bool) }}, nil
+	}
+	return p.compare()
+}
+
+func (p *parser) compare() (*node, error) {
+	x, err := p.add()
+	if err != nil {
+		return nil, err
+	}
+	pos := p.peek().pos
+	op, ok := p.accept("==", "=", "!=", "<>", "#", "<=", ">=", "<", ">", "$")
+	if !ok {
+		return x, nil
+	}
+	y, err := p.add()
+	if err != nil {
+		return nil, err
+	}
+	return p.comparison(pos, op, x, y)
+}
+
+func (p *parser) add() (*node, error) {
+	x, err := p.mul()
+	for err == nil {
+		pos := p.peek().pos
+		op, ok := p.accept("+", "-")
+		if !ok {
+			break
+		}
+		var y *node
+		if y, err = p.mul(); err == nil {
+			x, err = p.arithmetic(pos, op, x, y)
+		}
+	}
+	return x, err
+}
+
+func (p *parser) mul() (*node, error) {
+	x, err := p.pow()
+	for err == nil {
+		pos := p.peek().pos
+		op, ok := p.accept("*", "/", "%")
+		if !ok {
+			break
+		}
+		var y *node
+		if y, err = p.pow(); err == nil {
+			x, err = p.arithmetic(pos, op, x, y)
+		}
+	}
+	return x, err
+}
+
+func (p *parser) pow() (*node, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	pos := p.peek().pos
+	if _, ok := p.accept("^", "**"); !ok {
+		return x, nil
+	}
+	y, err := p.pow()
+	if err != nil {
+		return nil, err
+	}
+	return p.arithmetic(pos, "^", x, y)
+}
+
+func (p *parser) unary() (*node, error) {
+	pos := p.peek().pos
+	op, ok := p.accept("-", "+")
+	if !ok {
+		return p.primary()
+	}
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	if x.t != 'N' {
+		return nil, p.errorAt(pos, "operand of unary "+op+" must be numeric")
+	}
+	if op == "+" {
+		return x, nil
+	}
+	return &node{t: 'N', w: x.w, d: x.d, eval: func(e *env) interface{} { return -x.eval(e).(float64) }}, nil
+}
+
+func (p *parser) primary() (*node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNum:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorAt(t.pos, "invalid number '"+t.text+"'")
+		}
+		d := 0
+		if i := strings.IndexByte(t.text, '.'); i >= 0 {
+			d = len(t.text) - i - 1
+		}
+		return constant('N', f, numberWidth, d), nil
+
+	case tokStr:
+		return constant('C', t.text, len(t.text), 0), nil
+
+	case tokBool:
+		return constant('L', t.text == "T", 1, 0), nil
+
+	case tokDate:
+		d, ok := parseDateLiteral(t.text)
+		if !ok {
+			return nil, p.errorAt(t.pos, "invalid date {"+t.text+"}")
+		}
+		return constant('D', d, 8, 0), nil
+
+	case tokIdent:
+		if _, ok := p.accept("->"); ok {
+			// alias is ignored, expressions are compiled for one table
+			t = p.next()
+			if t.kind != tokIdent {
+				return nil, p.errorAt(t.pos, "expected field name after ->")
+			}
+		}
+		if _, ok := p.accept("("); ok {
+			return p.call(t)
+		}
+		return p.field(t)
+
+	case tokOp:
+		if t.text == "(" {
+			x, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+		}
+	}
+	if t.kind == tokEOF {
+		return nil, p.errorAt(t.pos, "unexpected end of expression")
+	}
+	return nil, p.errorAt(t.pos, "unexpected '"+t.text+"'")
+}
+
+// call parses function arguments, opening parenthesis is already consumed.
+func (p *parser) call(name token) (*node, error) {
+	args := []*node{}
+	if _, ok := p.accept(")"); !ok {
+		for {
+			x, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, x)
+			if _, ok := p.accept(","); !ok {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+
+	f, ok := functions[name.text]
+	if !ok {
+		return nil, p.errorAt(name.pos, "unknown function "+name.text+"()")
+	}
+	if len(args) < len(f.args)-f.optional || len(args) > len(f.args) {
+		return nil, p.errorAt(name.pos, "wrong number of arguments for "+name.text+"()")
+	}
+	for i, x := range args {
+		if f.args[i] != '?' && f.args[i] != x.t {
+			return nil, p.errorAt(name.pos, name.text+"() argument "+strconv.Itoa(i+1)+" must be "+typeName(f.args[i]))
+		}
+	}
+	n, err := f.build(args)
+	if err != nil {
+		return nil, p.errorAt(name.pos, err.Error())
+	}
+	return n, nil
+}
+
+// field returns node reading field of the current row.
+func (p *parser) field(name token) (*node, error) {
+	for i, f := range p.dt.Fields() {
+		if !strings.EqualFold(f.Name, name.text) {
+			continue
+		}
+		w, d := int(f.Length), int(f.Decimals)
+		if f.Type == "Y" {
+			// binary currency is read as decimal text with four decimals
+			w, d = 20, 4
+		}
+		switch f.Type {
+		case "N", "F", "Y":
+			return &node{t: 'N', w: w, d: d, eval: func(e *env) interface{} {
+				v, _ := strconv.ParseFloat(e.dt.FieldValue(e.row, i), 64)
+				return v
+			}}, nil
+		case "D":
+			return &node{t: 'D', w: 8, eval: func(e *env) interface{} {
+				v, _ := time.Parse("20060102", e.dt.FieldValue(e.row, i))
+				return v
+			}}, nil
+		case "L":
+			return &node{t: 'L', w: 1, eval: func(e *env) interface{} {
+				v := e.dt.FieldValue(e.row, i)
+				return v == "T" || v == "t" || v == "Y" || v == "y"
+			}}, nil
+		}
+		return &node{t: 'C', w: w, eval: func(e *env) interface{} {
+			return pad(e.dt.FieldValue(e.row, i), w)
+		}}, nil
+	}
+	return nil, p.errorAt(name.pos, "unknown field "+name.text)
+}
+
+// parseDateLiteral reads {^2006-01-02}, {01/02/2006} and blank {} dates.
+func parseDateLiteral(s string) (time.Time, bool) {
+	if s == "" || s == "/" || s == "^" {
+		return time.Time{}, true
+	}
+	if strings.HasPrefix(s, "^") {
+		d, err := time.Parse("2006-01-02", strings.TrimSpace(s[1:]))
+		return d, err == nil
+	}
+	d, ok := ctod(s)
+	return d, ok
+}
+
+func typeName(t byte) string {
+	switch t {
+	case 'N':
+		return "numeric"
+	case 'D':
+		return "date"
+	case 'L':
+		return "logical"
+	}
+	return "character"
+}
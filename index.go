@@ -0,0 +1,374 @@
+package dbf
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// KeyFunc computes index key of the row. Rows with ok set to false are left
+// out of the index, this is how index FOR conditions are implemented.
+type KeyFunc func(dt *DbfTable, row int) (key string, ok bool)
+
+// orderEntry is one key of an ordered index.
+type orderEntry struct {
+	key string
+	row int
+}
+
+// order keeps table rows sorted by key. All index types, on-disk and in-memory,
+// are backed by order and the table keeps them up to date as records change.
+type order struct {
+	dt      *DbfTable
+	keyFn   KeyFunc
+	entries []orderEntry // sorted by key and then by row
+	rowKeys map[int]string
+	// changed rows have keys in rowKeys but not in entries yet, entries are
+	// sorted again on next use so that bulk changes are not quadratic
+	changed map[int]bool
+	compare func(a, b string) int
+	// stale is set when table changed but order has no key function to follow it
+	stale bool
+	// field is index of the field keys start with and probe turns its value
+	// into key or key prefix, field is -1 when order can not be used by Lookup
+	field int
+	probe func(value string) string
+	// collation of text keys, nil when they compare byte by byte
+	collation Collation
+	// unique order has one entry per key, of the first row with the key;
+	// rowKeys has keys of all rows so that other rows take over the key
+	unique bool
+}
+
+func newOrder(dt *DbfTable, keyFn KeyFunc) *order {
+	return &order{dt: dt, keyFn: keyFn, rowKeys: map[int]string{}, compare: strings.Compare, field: -1}
+}
+
+// less orders entries by key, equal keys stay in physical order.
+func (o *order) less(a orderEntry, b orderEntry) bool {
+	if c := o.compare(a.key, b.key); c != 0 {
+		return c < 0
+	}
+	return a.row < b.row
+}
+
+// build computes keys for all rows in the table.
+func (o *order) build() {
+	o.entries = o.entries[:0]
+	o.rowKeys = map[int]string{}
+	for row := 0; row < o.dt.NumRecords(); row++ {
+		if key, ok := o.keyFn(o.dt, row); ok {
+			o.entries = append(o.entries, orderEntry{key: key, row: row})
+			o.rowKeys[row] = key
+		}
+	}
+	sort.SliceStable(o.entries, func(i, j int) bool { return o.less(o.entries[i], o.entries[j]) })
+	if o.unique {
+		o.entries = o.firstOfKeys(o.entries)
+	}
+	o.changed = nil
+	o.stale = false
+}
+
+// firstOfKeys keeps the first of sorted entries with the same key.
+func (o *order) firstOfKeys(entries []orderEntry) []orderEntry {
+	kept := entries[:0]
+	for i, e := range entries {
+		if i == 0 || o.compare(e.key, kept[len(kept)-1].key) != 0 {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// load entries read from index file, they must already be sorted.
+func (o *order) load(entries []orderEntry) {
+	o.entries = entries
+	o.changed = nil
+	o.rowKeys = make(map[int]string, len(entries))
+	for _, e := range entries {
+		o.rowKeys[e.row] = e.key
+	}
+	if o.unique && o.keyFn != nil {
+		// keys of rows left out for their duplicate keys
+		for row := 0; row < o.dt.NumRecords(); row++ {
+			if _, ok := o.rowKeys[row]; !ok {
+				if key, ok := o.keyFn(o.dt, row); ok {
+					o.rowKeys[row] = key
+				}
+			}
+		}
+	}
+}
+
+// update records new key of the row, entries are sorted on next use.
+func (o *order) update(row int) {
+	if o.keyFn == nil {
+		o.stale = true
+		return
+	}
+	key, ok := o.keyFn(o.dt, row)
+	old, had := o.rowKeys[row]
+	if had == ok && old == key {
+		return
+	}
+	if ok {
+		o.rowKeys[row] = key
+	} else {
+		delete(o.rowKeys, row)
+	}
+	if o.changed == nil {
+		o.changed = map[int]bool{}
+	}
+	o.changed[row] = true
+}
+
+// sorted returns entries after moving changed rows to positions of their
+// current keys: entries of other rows are merged with sorted keys of changed
+// rows.
+func (o *order) sorted() []orderEntry {
+	if len(o.changed) == 0 {
+		return o.entries
+	}
+	if o.unique {
+		// row with changed key may leave its key to another row
+		entries := make([]orderEntry, 0, len(o.rowKeys))
+		for row, key := range o.rowKeys {
+			entries = append(entries, orderEntry{key: key, row: row})
+		}
+		sort.Slice(entries, func(i, j int) bool { return o.less(entries[i], entries[j]) })
+		o.entries, o.changed = o.firstOfKeys(entries), nil
+		return o.entries
+	}
+	kept := make([]orderEntry, 0, len(o.entries))
+	for _, e := range o.entries {
+		if !o.changed[e.row] {
+			kept = append(kept, e)
+		}
+	}
+	added := []orderEntry{}
+	for row := range o.changed {
+		if key, ok := o.rowKeys[row]; ok {
+			added = append(added, orderEntry{key: key, row: row})
+		}
+	}
+	sort.Slice(added, func(i, j int) bool { return o.less(added[i], added[j]) })
+
+	entries := make([]orderEntry, 0, len(kept)+len(added))
+	for len(kept) > 0 && len(added) > 0 {
+		if o.less(added[0], kept[0]) {
+			entries, added = append(entries, added[0]), added[1:]
+		} else {
+			entries, kept = append(entries, kept[0]), kept[1:]
+		}
+	}
+	entries = append(append(entries, kept...), added...)
+	o.entries, o.changed = entries, nil
+	return entries
+}
+
+// seek returns position of the first entry with key greater or equal to key.
+func (o *order) seek(key string) int {
+	o.sorted()
+	return sort.Search(len(o.entries), func(i int) bool { return o.compare(o.entries[i].key, key) >= 0 })
+}
+
+// seekRow finds first not deleted row with key starting with key, the way
+// xBase SEEK works with SET EXACT OFF.
+func (o *order) seekRow(key string) (int, bool) {
+	for i := o.seek(key); i < len(o.entries); i++ {
+		e := o.entries[i]
+		if !strings.HasPrefix(e.key, key) && o.compare(e.key, key) != 0 {
+			break
+		}
+		if !o.dt.IsDeleted(e.row) {
+			return e.row, true
+		}
+	}
+	return -1, false
+}
+
+// lookupField lets Lookup use order when key expression is single C or D
+// field, or N field with typed binary keys. Keys of values are computed with
+// key function of the order on one row scratch table. Orders must be loaded
+// or built first: unique orders and orders without key of every row, as
+// those with FOR condition, hold some of the rows only and are not used.
+func (o *order) lookupField(expr string, typedNumbers, unique bool) {
+	i, ok := o.dt.fieldMap[strings.ToUpper(strings.TrimSpace(expr))]
+	if !ok || o.keyFn == nil || unique || len(o.entries) != o.dt.NumRecords() {
+		return
+	}
+	switch o.dt.fields[i].Type {
+	case "C", "D":
+	case "N":
+		if !typedNumbers {
+			return // numbers are keyed as stored, with varying decimals
+		}
+	default:
+		return
+	}
+	o.field = i
+	o.probe = func(value string) string {
+		s := o.dt.scratchTable()
+		s.SetFieldValue(0, i, value)
+		key, _ := o.keyFn(s, 0)
+		return key
+	}
+}
+
+// scratchTable returns one row table with fields of the table.
+func (dt *DbfTable) scratchTable() *DbfTable {
+	if dt.scratch == nil {
+		s := New()
+		for _, f := range dt.fields {
+			s.addField(f.Name, f.Type[0], f.Length, f.Decimals)
+		}
+		s.AddRecord()
+		dt.scratch = s
+	}
+	return dt.scratch
+}
+
+// Lookup returns not deleted rows, in physical order, with field equal to
+// value using an index of the table: in-memory index starting with the field
+// or .NTX index, .CDX or .MDX tag keyed by the field alone, neither unique nor
+// filtered by FOR condition. Values are given as stored, dates as YYYYMMDD.
+// ok is false when there is no such index.
+func (dt *DbfTable) Lookup(field, value string) (rows []int, ok bool) {
+	return dt.LookupCollated(field, value, Binary)
+}
+
+// LookupCollated returns rows as Lookup does, with C field equal to value by
+// collation c. Only in-memory indexes created with the same collation are
+// used for C fields: .NTX, .CDX and .MDX keys are binary, so they are used
+// with Binary collation only.
+func (dt *DbfTable) LookupCollated(field, value string, c Collation) (rows []int, ok bool) {
+	i, found := dt.fieldMap[strings.ToUpper(field)]
+	if !found {
+		return nil, false
+	}
+	text := dt.fields[i].Type == "C"
+	for _, o := range dt.orders {
+		if o.field != i || o.stale || text && !sameCollation(o.collation, c) {
+			continue
+		}
+		key := o.probe(value)
+		for j := o.seek(key); j < len(o.entries) && strings.HasPrefix(o.entries[j].key, key); j++ {
+			if row := o.entries[j].row; !dt.IsDeleted(row) {
+				rows = append(rows, row)
+			}
+		}
+		sort.Ints(rows)
+		return rows, true
+	}
+	return nil, false
+}
+
+// check returns error if order can not be trusted anymore.
+func (o *order) check() error {
+	if o.stale {
+		return errors.New("dbf: index key expression is not supported, index is out of date")
+	}
+	return nil
+}
+
+// attach order so that it follows table changes.
+func (dt *DbfTable) attach(o *order) {
+	dt.orders = append(dt.orders, o)
+}
+
+// detach order from the table.
+func (dt *DbfTable) detach(o *order) {
+	for i := range dt.orders {
+		if dt.orders[i] == o {
+			dt.orders = append(dt.orders[:i], dt.orders[i+1:]...)
+			return
+		}
+	}
+}
+
+// reindex updates all attached orders after row changed.
+func (dt *DbfTable) reindex(row int) {
+	for _, o := range dt.orders {
+		o.update(row)
+	}
+}
+
+// exprCompiler compiles xBase expressions that are not plain field lists.
+var exprCompiler func(dt *DbfTable, expr string, cond bool) (KeyFunc, int, error)
+
+// RegisterExpr installs compiler for xBase expressions, package dbf/expr
+// registers itself when imported. With cond set compiler returns KeyFunc that
+// reports whether the logical expression is true for the row, as used by
+// index FOR conditions and filters, otherwise KeyFunc returns index key.
+func RegisterExpr(compile func(dt *DbfTable, expr string, cond bool) (KeyFunc, int, error)) {
+	exprCompiler = compile
+}
+
+// keyFunc returns KeyFunc for index key expression, plain field lists are
+// handled by FieldKey and other expressions by the registered compiler.
+func (dt *DbfTable) keyFunc(expr string) (KeyFunc, int, error) {
+	fn, keyLen, err := dt.FieldKey(expr)
+	if err != nil && exprCompiler != nil {
+		return exprCompiler(dt, expr, false)
+	}
+	return fn, keyLen, err
+}
+
+// forFunc adds FOR condition to key function, rows where condition is false
+// are left out of the index.
+func (dt *DbfTable) forFunc(keyFn KeyFunc, forExpr string) (KeyFunc, error) {
+	if forExpr == "" || keyFn == nil {
+		return keyFn, nil
+	}
+	if exprCompiler == nil {
+		return nil, errors.New("dbf: FOR condition needs expression compiler, import dbf/expr")
+	}
+	cond, _, err := exprCompiler(dt, forExpr, true)
+	if err != nil {
+		return nil, err
+	}
+	return func(dt *DbfTable, row int) (string, bool) {
+		if _, ok := cond(dt, row); !ok {
+			return "", false
+		}
+		return keyFn(dt, row)
+	}, nil
+}
+
+// rawField returns cell bytes as stored, without trimming.
+func (dt *DbfTable) rawField(row int, fieldIndex int) []byte {
+	offset := dt.getRowOffset(row) + dt.fieldOffset(fieldIndex)
+	return dt.dataStore[offset : offset+int(dt.fields[fieldIndex].Length)]
+}
+
+// FieldKey returns KeyFunc for key expression made of field names joined with
+// plus sign, for example "LASTNAME+FIRSTNAME". Fields are used as stored in the
+// table, padded to the field length, and keyLen is the sum of field lengths.
+func (dt *DbfTable) FieldKey(expr string) (fn KeyFunc, keyLen int, err error) {
+	cols := []int{}
+	for _, name := range strings.Split(expr, "+") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		i, ok := dt.fieldMap[name]
+		if !ok {
+			return nil, 0, errors.New("dbf: key expression field '" + name + "' does not exist")
+		}
+		cols = append(cols, i)
+		keyLen += int(dt.fields[i].Length)
+	}
+
+	fn = func(dt *DbfTable, row int) (string, bool) {
+		b := make([]byte, 0, keyLen)
+		for _, i := range cols {
+			cell := dt.rawField(row, i)
+			for _, c := range cell {
+				if c == 0x00 {
+					c = 0x20 // new records are filled with zeros
+				}
+				b = append(b, c)
+			}
+		}
+		return string(b), true
+	}
+	return fn, keyLen, nil
+}
@@ -0,0 +1,396 @@
+package dbf
+
+import (
+	"errors"
+	"strings"
+)
+
+// Iterator walks table rows, by default in physical order skipping deleted
+// rows. Options given to NewIterator add filters, bounds and orderings. Next
+// and Skip move the record pointer the way xBase SKIP does, Bof and Eof report
+// when it went past the first or last row.
+type Iterator struct {
+	dt     *DbfTable
+	index  int
+	last   int
+	offset int
+	// pos is logical position, -1 before the first row and size() after the last
+	pos      int
+	bof, eof bool
+	err      error
+
+	// order is set when iterating in index order
+	order   *order
+	reverse bool
+	// encode turns Seek values into index keys, nil for raw keys
+	encode func(values []string) string
+	// lo and hi are the first and the last key of Range when hasLo and hasHi
+	// are set
+	lo, hi       string
+	hasLo, hasHi bool
+
+	first, stop    int // row bounds, stop is exclusive
+	filter         func(dt *DbfTable, row int) bool
+	includeDeleted bool
+}
+
+// IteratorOption configures Iterator created by NewIterator.
+type IteratorOption func(it *Iterator)
+
+// Index is an ordered index usable with UseIndex: *Ntx, *CdxTag and *MdxTag.
+type Index interface {
+	indexOrder() (o *order, descend bool)
+}
+
+// Where skips rows for which fn returns false.
+func Where(fn func(dt *DbfTable, row int) bool) IteratorOption {
+	return func(it *Iterator) {
+		prev := it.filter
+		it.filter = fn
+		if prev != nil {
+			it.filter = func(dt *DbfTable, row int) bool { return prev(dt, row) && fn(dt, row) }
+		}
+	}
+}
+
+// WhereExpr skips rows for which xBase logical expression is false, for example
+// "AMOUNT > 100 .AND. STATE = 'NY'". Package dbf/expr must be imported, errors
+// are reported by Err.
+func WhereExpr(expr string) IteratorOption {
+	return func(it *Iterator) {
+		if exprCompiler == nil {
+			it.err = errors.New("dbf: filter expression needs expression compiler, import dbf/expr")
+			return
+		}
+		cond, _, err := exprCompiler(it.dt, expr, true)
+		if err != nil {
+			it.err = err
+			return
+		}
+		Where(func(dt *DbfTable, row int) bool {
+			_, ok := cond(dt, row)
+			return ok
+		})(it)
+	}
+}
+
+// Reverse walks rows from the last one to the first one.
+func Reverse() IteratorOption {
+	return func(it *Iterator) {
+		it.reverse = !it.reverse
+	}
+}
+
+// Bounds limits iteration to rows from start up to, but not including, stop.
+// Negative stop means the end of the table.
+func Bounds(start, stop int) IteratorOption {
+	return func(it *Iterator) {
+		if start > it.first {
+			it.first = start
+		}
+		if stop >= 0 && stop < it.stop {
+			it.stop = stop
+		}
+	}
+}
+
+// WithDeleted includes deleted rows.
+func WithDeleted() IteratorOption {
+	return func(it *Iterator) {
+		it.includeDeleted = true
+	}
+}
+
+// OrderBy walks rows in order of in-memory index created with CreateIndex.
+func OrderBy(index string) IteratorOption {
+	return func(it *Iterator) {
+		x, err := it.dt.index(index)
+		if err != nil {
+			it.err = err
+			return
+		}
+		it.order = x.order
+		it.encode = func(values []string) string { return x.key(it.dt, values) }
+	}
+}
+
+// UseIndex walks rows in order of .NTX index or .CDX or .MDX tag.
+func UseIndex(x Index) IteratorOption {
+	return func(it *Iterator) {
+		o, descend := x.indexOrder()
+		it.order = o
+		it.encode = nil
+		if descend {
+			it.reverse = !it.reverse
+		}
+	}
+}
+
+// SortBy walks rows sorted by fields, compared by type as in CreateIndex.
+// Rows are sorted when iterator is created and later changes are not followed.
+func SortBy(fields ...string) IteratorOption {
+	return func(it *Iterator) {
+		x := &memIndex{}
+		for _, field := range fields {
+			i := it.dt.fieldIndex(field)
+			if i < 0 {
+				it.err = errors.New("dbf: sort field '" + field + "' does not exist")
+				return
+			}
+			x.fields = append(x.fields, i)
+		}
+		x.order = newOrder(it.dt, x.keyFunc())
+		x.order.build()
+		it.order = x.order
+		it.encode = func(values []string) string { return x.key(it.dt, values) }
+	}
+}
+
+// NewIterator returns iterator positioned before the first row.
+func (dt *DbfTable) NewIterator(opts ...IteratorOption) *Iterator {
+	it := &Iterator{dt: dt, index: -1, offset: -1, last: dt.NumRecords(), pos: -1, stop: dt.NumRecords()}
+	for _, opt := range opts {
+		opt(it)
+	}
+	return it
+}
+
+// Index returns current row, -1 when iterator is not on a row.
+func (it *Iterator) Index() int {
+	return it.index
+}
+
+// Err returns error of iterator options, iterator with error has no rows.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Bof reports whether last move tried to go before the first row.
+func (it *Iterator) Bof() bool {
+	return it.bof
+}
+
+// Eof reports whether iterator moved past the last row.
+func (it *Iterator) Eof() bool {
+	return it.eof
+}
+
+// size returns number of positions the iterator walks.
+func (it *Iterator) size() int {
+	if it.order != nil {
+		return len(it.order.sorted())
+	}
+	if it.stop > it.last {
+		return it.last - it.first
+	}
+	return it.stop - it.first
+}
+
+// row returns row at logical position.
+func (it *Iterator) row(pos int) int {
+	if it.order != nil {
+		return it.order.sorted()[it.entry(pos)].row
+	}
+	return it.first + it.entry(pos)
+}
+
+// visible reports whether row at logical position is not skipped.
+func (it *Iterator) visible(pos int) bool {
+	row := it.row(pos)
+	if row < it.first || row >= it.stop {
+		return false
+	}
+	if !it.includeDeleted && it.dt.IsDeleted(row) {
+		return false
+	}
+	if it.outside(pos) {
+		return false
+	}
+	return it.filter == nil || it.filter(it.dt, row)
+}
+
+// below reports whether key is before the first key of Range.
+func (it *Iterator) below(key string) bool {
+	return it.hasLo && it.order.compare(key, it.lo) < 0
+}
+
+// above reports whether key is past the last key of Range, keys starting with
+// it are in range.
+func (it *Iterator) above(key string) bool {
+	return it.hasHi && it.order.compare(key, it.hi) > 0 && !strings.HasPrefix(key, it.hi)
+}
+
+// outside reports whether key at logical position is out of Range.
+func (it *Iterator) outside(pos int) bool {
+	if !it.hasLo && !it.hasHi {
+		return false
+	}
+	key := it.order.sorted()[it.entry(pos)].key
+	return it.below(key) || it.above(key)
+}
+
+// beyond reports whether position is past the end of Range in the walking
+// direction, the first key when walking in reverse.
+func (it *Iterator) beyond(pos int) bool {
+	if !it.hasLo && !it.hasHi {
+		return false
+	}
+	key := it.order.sorted()[it.entry(pos)].key
+	if it.reverse {
+		return it.below(key)
+	}
+	return it.above(key)
+}
+
+// find returns next visible position from pos in direction dir, -1 or size()
+// when there is none.
+func (it *Iterator) find(pos, dir int) int {
+	size := it.size()
+	for pos += dir; pos >= 0 && pos < size; pos += dir {
+		if dir > 0 && it.beyond(pos) {
+			return size
+		}
+		if it.visible(pos) {
+			return pos
+		}
+	}
+	if pos < 0 {
+		return -1
+	}
+	return size
+}
+
+// moveTo sets position and current row.
+func (it *Iterator) moveTo(pos int) {
+	it.pos = pos
+	it.bof, it.eof = false, false
+	if pos >= 0 && pos < it.size() {
+		it.index = it.row(pos)
+		return
+	}
+	it.index = -1
+	it.eof = pos >= 0
+}
+
+// move goes one visible row forward or backward. Going past the last row sets
+// Eof, going before the first row sets Bof and stays on the first row.
+func (it *Iterator) move(dir int) bool {
+	if it.err != nil || it.eof && dir > 0 {
+		return false
+	}
+	pos := it.pos
+	if it.bof && dir < 0 {
+		return false
+	}
+	if it.eof {
+		pos = it.size()
+	}
+	next := it.find(pos, dir)
+	if next < 0 {
+		it.GoTop()
+		it.bof = true
+		return false
+	}
+	it.moveTo(next)
+	return !it.eof
+}
+
+// Next moves to the next row, use it to loop over the table.
+func (it *Iterator) Next() bool {
+	return it.move(1)
+}
+
+// Skip moves n rows forward, or backward when n is negative, and reports
+// whether iterator is still on a row.
+func (it *Iterator) Skip(n int) bool {
+	dir := 1
+	if n < 0 {
+		dir, n = -1, -n
+	}
+	for i := 0; i < n; i++ {
+		if !it.move(dir) {
+			return false
+		}
+	}
+	return it.index >= 0
+}
+
+// GoTop moves to the first row.
+func (it *Iterator) GoTop() bool {
+	it.moveTo(it.find(-1, 1))
+	if it.eof {
+		it.bof = true
+	}
+	return it.index >= 0
+}
+
+// GoBottom moves to the last row.
+func (it *Iterator) GoBottom() bool {
+	pos := it.find(it.size(), -1)
+	if pos < 0 {
+		it.moveTo(it.size())
+		it.bof = true
+		return false
+	}
+	it.moveTo(pos)
+	return true
+}
+
+// GoTo moves to the row, as xBase GOTO it ignores filters.
+func (it *Iterator) GoTo(row int) bool {
+	if it.err != nil || row < 0 || row >= it.dt.NumRecords() {
+		return false
+	}
+	for pos := 0; pos < it.size(); pos++ {
+		if it.row(pos) == row {
+			it.moveTo(pos)
+			return true
+		}
+	}
+	return false
+}
+
+// Seek moves to the first row of iterator order with key starting with key.
+// Values of in-memory index and SortBy keys are given per field, as in
+// DbfTable.Seek. Iterator is at Eof when key is not found.
+func (it *Iterator) Seek(key ...string) bool {
+	if it.order == nil {
+		it.err = errors.New("dbf: seek needs iterator ordered by index")
+		return false
+	}
+	k := strings.Join(key, "")
+	if it.encode != nil {
+		k = it.encode(key)
+	}
+	match := func(pos int) bool {
+		e := it.order.sorted()[it.entry(pos)]
+		return strings.HasPrefix(e.key, k) || it.order.compare(e.key, k) == 0
+	}
+
+	size := it.size()
+	at := it.order.seek(k)
+	if it.reverse {
+		// logically first match is the physically last one
+		end := at
+		for end < size && (strings.HasPrefix(it.order.sorted()[end].key, k) || it.order.compare(it.order.sorted()[end].key, k) == 0) {
+			end++
+		}
+		at = size - end
+	}
+	for pos := at; pos < size && match(pos); pos++ {
+		if it.visible(pos) {
+			it.moveTo(pos)
+			return true
+		}
+	}
+	it.moveTo(size)
+	return false
+}
+
+// entry returns entries index of logical position.
+func (it *Iterator) entry(pos int) int {
+	if it.reverse {
+		return it.size() - 1 - pos
+	}
+	return pos
+}
@@ -0,0 +1,108 @@
+package dbf
+
+import (
+	"strconv"
+	"testing"
+)
+
+// rows collects rows visited by the iterator.
+func rows(it *Iterator) []int {
+	list := []int{}
+	for it.Next() {
+		list = append(list, it.Index())
+	}
+	return list
+}
+
+func sameRows(t *testing.T, got []int, want ...int) {
+	if len(got) != len(want) {
+		t.Fatal("expected rows", want, "found:", got)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatal("expected rows", want, "found:", got)
+		}
+	}
+}
+
+func TestIteratorOptions(t *testing.T) {
+	db := New()
+	db.AddTextField("name", 10)
+	db.AddIntField("num")
+	for i, name := range []string{"delta", "alpha", "echo", "bravo", "charlie"} {
+		row := db.AddRecord()
+		db.SetFieldValue(row, 0, name)
+		db.SetFieldValue(row, 1, strconv.Itoa(10-i))
+	}
+	db.Delete(2)
+
+	sameRows(t, rows(db.NewIterator()), 0, 1, 3, 4)
+	sameRows(t, rows(db.NewIterator(WithDeleted())), 0, 1, 2, 3, 4)
+	sameRows(t, rows(db.NewIterator(Reverse())), 4, 3, 1, 0)
+	sameRows(t, rows(db.NewIterator(Bounds(1, 4))), 1, 3)
+	sameRows(t, rows(db.NewIterator(SortBy("name"))), 1, 3, 4, 0)
+	sameRows(t, rows(db.NewIterator(SortBy("Num"), Reverse())), 0, 1, 3, 4)
+	odd := Where(func(dt *DbfTable, row int) bool { return row%2 == 1 })
+	sameRows(t, rows(db.NewIterator(odd, WithDeleted())), 1, 3)
+
+	if err := db.NewIterator(SortBy("nope")).Err(); err == nil {
+		t.Fatal("sort by missing field should fail")
+	}
+	if err := db.NewIterator(WhereExpr("NUM > 1")).Err(); err == nil {
+		t.Fatal("expression filter needs compiler")
+	}
+
+	db.CreateIndex("name", "name")
+	sameRows(t, rows(db.NewIterator(OrderBy("name"), Bounds(0, 4))), 1, 3, 0)
+}
+
+func TestIteratorCursor(t *testing.T) {
+	db := New()
+	db.AddTextField("name", 10)
+	for _, name := range []string{"delta", "alpha", "echo", "bravo"} {
+		db.SetFieldValue(db.AddRecord(), 0, name)
+	}
+	db.CreateIndex("name", "name")
+
+	it := db.NewIterator(OrderBy("name"))
+	if it.Seek("c") || !it.Eof() {
+		t.Fatal("failed seek should leave iterator at eof")
+	}
+	if !it.Seek("br") || it.Index() != 3 {
+		t.Fatal("seek failed, found:", it.Index())
+	}
+	if !it.Skip(1) || it.Index() != 0 {
+		t.Fatal("expected delta after bravo found:", it.Index())
+	}
+	if it.Skip(5) || !it.Eof() {
+		t.Fatal("skip past last row should set eof")
+	}
+	if !it.Skip(-1) || it.Index() != 2 {
+		t.Fatal("skip back from eof should go to the last row, found:", it.Index())
+	}
+	if it.Skip(-10) || !it.Bof() || it.Index() != 1 {
+		t.Fatal("skip before first row should set bof and stay on first row")
+	}
+	if !it.GoBottom() || it.Index() != 2 {
+		t.Fatal("expected last row echo found:", it.Index())
+	}
+	if !it.GoTo(3) || it.Index() != 3 || !it.Next() || it.Index() != 0 {
+		t.Fatal("goto failed, found:", it.Index())
+	}
+
+	it = db.NewIterator(OrderBy("name"), Reverse())
+	if !it.Seek("d") || it.Index() != 0 || !it.Next() || it.Index() != 3 {
+		t.Fatal("reverse seek failed, found:", it.Index())
+	}
+	it.GoTop()
+	if it.Index() != 2 {
+		t.Fatal("reverse order should start with echo, found:", it.Index())
+	}
+
+	empty := New()
+	empty.AddTextField("name", 10)
+	it = empty.NewIterator()
+	if it.GoTop() || !it.Bof() || !it.Eof() {
+		t.Fatal("empty table should be at bof and eof")
+	}
+}
@@ -0,0 +1,98 @@
+package dbf
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Mapping selects how Read, Write, Append and Table match struct fields with
+// table fields. Fields are matched by name ignoring case.
+type Mapping int
+
+const (
+	// MapDefault panics when struct field has no table field, the way
+	// FieldValueByName does. Table fields without struct field are ignored.
+	MapDefault Mapping = iota
+	// MapLenient leaves struct fields without table field at zero value on
+	// Read and does not write them. Table fields without struct field are ignored.
+	MapLenient
+	// MapStrict returns MappingError listing every struct field without table
+	// field and every table field without struct field. Write panics with it.
+	MapStrict
+)
+
+// MappingError lists fields of struct and table that do not match.
+type MappingError struct {
+	Type    string   // struct type
+	Missing []string // struct fields without table field
+	Extra   []string // table fields without struct field
+}
+
+func (e *MappingError) Error() string {
+	s := "dbf: struct " + e.Type + " does not match table"
+	if len(e.Missing) > 0 {
+		s += ", missing table fields: " + strings.Join(e.Missing, ", ")
+	}
+	if len(e.Extra) > 0 {
+		s += ", table fields without struct field: " + strings.Join(e.Extra, ", ")
+	}
+	return s
+}
+
+// SetMapping sets how struct fields are matched with table fields.
+func (dt *DbfTable) SetMapping(m Mapping) {
+	dt.mapping = m
+}
+
+// CheckMapping returns *MappingError listing every mismatch of spec struct and
+// table fields, nil when they match. It does not depend on mapping of the table.
+func (dt *DbfTable) CheckMapping(spec interface{}) error {
+	t := reflect.TypeOf(spec)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		panic("dbf: spec parameter must be a struct")
+	}
+	if c := dt.codec(t); c.mismatch != nil {
+		return c.mismatch
+	}
+	return nil
+}
+
+// fieldIndex returns index of the field with name matched ignoring case, -1
+// when there is no such field.
+func (dt *DbfTable) fieldIndex(name string) int {
+	if i, ok := dt.fieldMap[strings.ToUpper(name)]; ok {
+		return i
+	}
+	for i := range dt.fields {
+		if strings.EqualFold(dt.fields[i].Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// match returns mismatch of codec fields and table fields. Hidden _NullFlags
+// field is never reported.
+func (c *codec) match(dt *DbfTable, t reflect.Type) *MappingError {
+	e := &MappingError{Type: t.String()}
+	used := make([]bool, len(dt.fields))
+	for j, sf := range c.fields {
+		if c.cols[j] < 0 {
+			e.Missing = append(e.Missing, sf.name)
+			continue
+		}
+		used[c.cols[j]] = true
+	}
+	for i, ok := range used {
+		if !ok && dt.fields[i].Type != nullFlagsType {
+			e.Extra = append(e.Extra, dt.fields[i].Name)
+		}
+	}
+	if e.Missing == nil && e.Extra == nil {
+		return nil
+	}
+	return e
+}
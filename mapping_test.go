@@ -0,0 +1,70 @@
+package dbf
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMapping(t *testing.T) {
+	db := New()
+	db.AddTextField("name", 10)
+	db.AddIntField("age")
+	db.AddTextField("extra", 5)
+	row := db.AddRecord()
+	db.SetFieldValueByName(row, "name", "tad")
+	db.SetFieldValueByName(row, "age", "42")
+
+	type person struct {
+		Name  string
+		Age   int
+		Email string
+	}
+
+	p := person{Email: "stale"}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("default mapping should panic on missing field")
+			}
+		}()
+		db.Read(row, &p)
+	}()
+
+	db.SetMapping(MapLenient)
+	if err := db.Read(row, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "tad" || p.Age != 42 || p.Email != "" {
+		t.Fatal("unexpected lenient read:", p)
+	}
+	db.Write(row, person{Name: "ann", Age: 7, Email: "a@b"})
+	if v := db.FieldValueByName(row, "NAME"); v != "ann" {
+		t.Fatal("expected ann found:", v)
+	}
+	if _, err := NewTable[person](db); err != nil {
+		t.Fatal(err)
+	}
+
+	db.SetMapping(MapStrict)
+	err := db.Read(row, &p)
+	var me *MappingError
+	if !errors.As(err, &me) || len(me.Missing) != 1 || me.Missing[0] != "EMAIL" || len(me.Extra) != 1 || me.Extra[0] != "EXTRA" {
+		t.Fatal("expected mismatch of EMAIL and EXTRA found:", err)
+	}
+	if _, err := NewTable[person](db); err == nil {
+		t.Fatal("strict table should fail")
+	}
+
+	type exact struct {
+		Name  string
+		Age   int
+		Extra string
+	}
+	if err := db.CheckMapping(exact{}); err != nil {
+		t.Fatal(err)
+	}
+	var e exact
+	if err := db.Read(row, &e); err != nil || e.Name != "ann" {
+		t.Fatal("strict read failed:", err, e)
+	}
+}
@@ -0,0 +1,658 @@
+package dbf
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dBase IV .MDX multiple index file layout.
+const (
+	mdxBlock       = 512 // pointers in the file count 512 byte blocks
+	mdxPageSize    = 1024
+	mdxMaxTags     = 48
+	mdxTagEntryLen = 32
+	mdxTagTable    = 544
+	mdxTagNameLen  = 10
+	mdxExprOffset  = 24
+	mdxExprLength  = 220
+	mdxMaxDepth    = 64 // protects against loops in broken files
+
+	mdxDescending = 0x08
+	mdxFieldKey   = 0x10
+	mdxUniqueKey  = 0x40
+
+	// dbase header byte 28 is set when table has production .MDX file
+	mdxProductionFlag = 28
+)
+
+// Mdx is dBase IV .MDX multiple index file. Tags are kept in memory and follow
+// SetFieldValue, AddRecord, InsertRecord and Delete. Production index of the
+// table is opened by LoadFile and saved by SaveFile.
+type Mdx struct {
+	dt       *DbfTable
+	fileName string
+	tags     []*MdxTag
+}
+
+// MdxTag is one index order of Mdx file.
+type MdxTag struct {
+	mdx     *Mdx
+	order   *order
+	name    string
+	expr    string
+	keyType byte // C, N or D
+	keyLen  int
+	unique  bool
+	descend bool
+	// header read from the file, parts not known to the package, as FOR
+	// condition, are written back
+	header []byte
+}
+
+// MdxNumberKey encodes number the way dBase IV stores numeric keys, use it to Seek numeric tags.
+func MdxNumberKey(f float64) string {
+	return mdxBcd(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+// MdxDateKey encodes date the way dBase IV stores date keys, use it to Seek date tags.
+func MdxDateKey(t time.Time) string {
+	b := make([]byte, 8)
+	if !t.IsZero() {
+		t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		binary.LittleEndian.PutUint64(b, math.Float64bits(float64(t.Unix()/86400+2440588)))
+	}
+	return string(b)
+}
+
+// mdxBcd encodes decimal number as 12 byte dBase BCD key: exponent biased by
+// 52, number of digits with sign bit and 20 packed digits.
+func mdxBcd(s string) string {
+	b := make([]byte, 12)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	intPart = strings.TrimLeft(intPart, "0")
+	exp := len(intPart)
+	digits := intPart + fracPart
+	if intPart == "" {
+		trimmed := strings.TrimLeft(fracPart, "0")
+		exp = len(trimmed) - len(fracPart)
+		digits = trimmed
+	}
+	digits = strings.TrimRight(digits, "0")
+	if len(digits) > 20 {
+		digits = digits[:20]
+	}
+	if digits == "" {
+		exp, neg = 0, false
+	}
+
+	b[0] = byte(52 + exp)
+	b[1] = byte(len(digits) << 2)
+	if neg {
+		b[1] |= 0x80
+	}
+	for i := 0; i < len(digits); i++ {
+		d := digits[i] - '0'
+		if i%2 == 0 {
+			b[2+i/2] |= d << 4
+		} else {
+			b[2+i/2] |= d
+		}
+	}
+	return string(b)
+}
+
+// mdxBcdValue decodes BCD key into float64 for comparisons.
+func mdxBcdValue(key string) float64 {
+	if len(key) < 12 {
+		return 0
+	}
+	n := int(key[1]>>2) & 0x1F
+	var f float64
+	for i := 0; i < n && i < 20; i++ {
+		d := key[2+i/2]
+		if i%2 == 0 {
+			d >>= 4
+		}
+		f = f*10 + float64(d&0x0F)
+	}
+	f *= math.Pow10(int(key[0]) - 52 - n)
+	if key[1]&0x80 != 0 {
+		f = -f
+	}
+	return f
+}
+
+// mdxCompare returns comparison function for keys of the type.
+func mdxCompare(keyType byte) func(a, b string) int {
+	var value func(string) float64
+	switch keyType {
+	case 'N':
+		value = mdxBcdValue
+	case 'D':
+		value = func(key string) float64 {
+			if len(key) < 8 {
+				return 0
+			}
+			return math.Float64frombits(binary.LittleEndian.Uint64([]byte(key)))
+		}
+	default:
+		return strings.Compare
+	}
+	return func(a, b string) int {
+		x, y := value(a), value(b)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+}
+
+// mdxKey returns key function and key type for expression made of field names
+// joined with plus sign. Single numeric or date field gives dBase binary keys.
+func (dt *DbfTable) mdxKey(expr string) (fn KeyFunc, keyLen int, keyType byte, err error) {
+	name := strings.ToUpper(strings.TrimSpace(expr))
+	if i, ok := dt.fieldMap[name]; ok {
+		switch dt.fields[i].Type {
+		case "N":
+			fn = func(dt *DbfTable, row int) (string, bool) {
+				v := dt.FieldValue(row, i)
+				if _, err := strconv.ParseFloat(v, 64); err != nil {
+					v = "0"
+				}
+				return mdxBcd(v), true
+			}
+			return fn, 12, 'N', nil
+		case "D":
+			fn = func(dt *DbfTable, row int) (string, bool) {
+				t, _ := time.Parse("20060102", dt.FieldValue(row, i))
+				return MdxDateKey(t), true
+			}
+			return fn, 8, 'D', nil
+		}
+	}
+	fn, keyLen, err = dt.keyFunc(expr)
+	return fn, keyLen, 'C', err
+}
+
+// HasMdx reports whether table header says that table has production .MDX file.
+func (dt *DbfTable) HasMdx() bool {
+	return dt.dataStore[mdxProductionFlag] == 0x01
+}
+
+// Mdx returns production index opened by LoadFile, nil if there is none.
+func (dt *DbfTable) Mdx() *Mdx {
+	return dt.mdx
+}
+
+// ClearMdxFlag removes production index flag from table header and stops
+// maintaining the index. Use it when table is saved without its .MDX file.
+func (dt *DbfTable) ClearMdxFlag() {
+	dt.dataStore[mdxProductionFlag] = 0x00
+	if dt.mdx != nil {
+		dt.mdx.Close()
+		dt.mdx = nil
+	}
+}
+
+// mdxFileName returns name of the production index next to the table file.
+func mdxFileName(fileName string) string {
+	ext := filepath.Ext(fileName)
+	base := strings.TrimSuffix(fileName, ext)
+	if ext == strings.ToUpper(ext) && ext != "" {
+		return base + ".MDX"
+	}
+	return base + ".mdx"
+}
+
+// openProductionMdx opens production index of table loaded from fileName.
+// Missing index file is not an error, the flag stays set and Mdx returns nil.
+func (dt *DbfTable) openProductionMdx(fileName string) error {
+	if !dt.HasMdx() {
+		return nil
+	}
+	name := mdxFileName(fileName)
+	if _, err := os.Stat(name); err != nil {
+		return nil
+	}
+	m, err := dt.OpenMdx(name)
+	if err != nil {
+		return err
+	}
+	dt.mdx = m
+	return nil
+}
+
+// saveProductionMdx writes production index next to table saved as fileName.
+func (dt *DbfTable) saveProductionMdx(fileName string) error {
+	if dt.mdx == nil || !dt.HasMdx() {
+		return nil
+	}
+	dt.mdx.fileName = mdxFileName(fileName)
+	return dt.mdx.Save()
+}
+
+// OpenMdx reads .MDX index file for the table. Tags with key expressions made
+// of field names joined with plus sign, or any expression once dbf/expr is
+// imported, are maintained when the table changes, other tags can be used for
+// seeks and ordered iteration only. So are tags with FOR condition, found by
+// rows left out of them.
+func (dt *DbfTable) OpenMdx(fileName string) (*Mdx, error) {
+	s, err := readFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if len(s) < mdxTagTable+mdxMaxTags*mdxTagEntryLen {
+		return nil, errors.New("dbf: mdx file is too short")
+	}
+
+	pageSize := int(binary.LittleEndian.Uint16(s[22:]))
+	if pageSize == 0 {
+		pageSize = int(binary.LittleEndian.Uint16(s[20:])) * mdxBlock
+	}
+	if pageSize < mdxBlock {
+		return nil, errors.New("dbf: mdx file has invalid block size")
+	}
+
+	m := &Mdx{dt: dt, fileName: fileName}
+	count := int(binary.LittleEndian.Uint16(s[28:]))
+	if count > mdxMaxTags {
+		return nil, errors.New("dbf: mdx file is corrupted")
+	}
+	for i := 0; i < count; i++ {
+		entry := s[mdxTagTable+i*mdxTagEntryLen:]
+		t, err := m.readTag(s, cString(entry[4:15]), binary.LittleEndian.Uint32(entry), pageSize)
+		if err != nil {
+			return nil, err
+		}
+		m.tags = append(m.tags, t)
+	}
+	for _, t := range m.tags {
+		dt.attach(t.order)
+	}
+	return m, nil
+}
+
+// CreateMdx creates index file without tags and, when production is set, marks
+// it as the production index of the table saved and opened with the table.
+func (dt *DbfTable) CreateMdx(fileName string, production bool) (*Mdx, error) {
+	m := &Mdx{dt: dt, fileName: fileName}
+	if err := m.Save(); err != nil {
+		return nil, err
+	}
+	if production {
+		if dt.mdx != nil {
+			dt.mdx.Close()
+		}
+		dt.mdx = m
+		dt.dataStore[mdxProductionFlag] = 0x01
+	}
+	return m, nil
+}
+
+// readTag reads tag header and all keys of the tag.
+func (m *Mdx) readTag(s []byte, name string, block uint32, pageSize int) (*MdxTag, error) {
+	offset := int(block) * mdxBlock
+	if offset+mdxBlock > len(s) {
+		return nil, errors.New("dbf: mdx file is corrupted")
+	}
+	h := s[offset:]
+	t := &MdxTag{mdx: m, name: name}
+	root := binary.LittleEndian.Uint32(h[0:])
+	t.descend = h[8]&mdxDescending != 0
+	t.unique = h[8]&mdxUniqueKey != 0 || h[23] != 0
+	t.keyType = h[9]
+	t.keyLen = int(binary.LittleEndian.Uint16(h[12:]))
+	itemLen := int(binary.LittleEndian.Uint16(h[18:]))
+	if t.keyLen < 1 || itemLen < t.keyLen+4 || itemLen*2+8 > pageSize {
+		return nil, errors.New("dbf: mdx file has invalid key size")
+	}
+	t.expr = cString(h[mdxExprOffset : mdxExprOffset+mdxExprLength])
+
+	keyFn, _, keyType, err := m.dt.mdxKey(t.expr)
+	if err != nil || keyType != t.keyType {
+		keyFn = nil // tag can be read but not maintained
+	}
+
+	t.header = append([]byte(nil), h[:mdxBlock]...)
+
+	entries := []orderEntry{}
+	if err := t.readPage(s, root, pageSize, itemLen, 0, &entries); err != nil {
+		return nil, err
+	}
+	if keyFn != nil && t.missesRows(t.fixKey(keyFn), entries) {
+		// FOR condition is not read, filtered tag goes out of date when
+		// table changes
+		keyFn = nil
+	}
+	t.order = newOrder(m.dt, t.fixKey(keyFn))
+	t.order.compare = mdxCompare(t.keyType)
+	t.order.unique = t.unique
+	t.order.load(entries)
+	t.order.lookupField(t.expr, true, t.unique)
+	return t, nil
+}
+
+// missesRows reports whether rows are left out of the tag for other reason than
+// duplicate keys of unique tag, that is the tag has FOR condition.
+func (t *MdxTag) missesRows(keyFn KeyFunc, entries []orderEntry) bool {
+	dt := t.mdx.dt
+	if len(entries) >= dt.NumRecords() {
+		return false
+	}
+	if !t.unique {
+		return true
+	}
+	keys, rows := map[string]bool{}, map[int]bool{}
+	for _, e := range entries {
+		keys[e.key], rows[e.row] = true, true
+	}
+	for row := 0; row < dt.NumRecords(); row++ {
+		if rows[row] {
+			continue
+		}
+		if key, ok := keyFn(dt, row); !ok || !keys[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// readPage appends keys of the page and its children in order. Leaf pages hold
+// record numbers, interior pages hold one more child pointer than keys.
+func (t *MdxTag) readPage(s []byte, block uint32, pageSize, itemLen, depth int, entries *[]orderEntry) error {
+	offset := int(block) * mdxBlock
+	if depth > mdxMaxDepth || block == 0 || offset+pageSize > len(s) {
+		return errors.New("dbf: mdx file is corrupted")
+	}
+	page := s[offset : offset+pageSize]
+	count := int(binary.LittleEndian.Uint32(page))
+	if 8+(count+1)*itemLen > pageSize {
+		return errors.New("dbf: mdx file is corrupted")
+	}
+
+	leaf := binary.LittleEndian.Uint32(page[8+count*itemLen:]) == 0
+	for i := 0; i <= count; i++ {
+		item := page[8+i*itemLen:]
+		ptr := binary.LittleEndian.Uint32(item)
+		if leaf {
+			if i == count {
+				break
+			}
+			row := int(ptr) - 1
+			if row >= 0 && row < t.mdx.dt.NumRecords() {
+				*entries = append(*entries, orderEntry{key: string(item[4 : 4+t.keyLen]), row: row})
+			}
+			continue
+		}
+		if err := t.readPage(s, ptr, pageSize, itemLen, depth+1, entries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tags returns all tags of the index.
+func (m *Mdx) Tags() []*MdxTag {
+	return m.tags
+}
+
+// Tag finds tag by case insensitive name, returns nil if not found.
+func (m *Mdx) Tag(name string) *MdxTag {
+	for _, t := range m.tags {
+		if strings.EqualFold(t.name, name) {
+			return t
+		}
+	}
+	return nil
+}
+
+// AddTag builds new tag for key expression made of field names joined with
+// plus sign, single numeric and date fields are indexed as dBase binary keys.
+func (m *Mdx) AddTag(name, expr string) (*MdxTag, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if name == "" || len(name) > mdxTagNameLen {
+		return nil, errors.New("dbf: mdx tag name must be 1 to 10 characters long")
+	}
+	if m.Tag(name) != nil {
+		return nil, errors.New("dbf: mdx tag '" + name + "' already exist")
+	}
+	if len(m.tags) >= mdxMaxTags {
+		return nil, errors.New("dbf: mdx file can not hold more than 48 tags")
+	}
+	if len(expr) >= mdxExprLength {
+		return nil, errors.New("dbf: mdx key expression is too long")
+	}
+	keyFn, keyLen, keyType, err := m.dt.mdxKey(expr)
+	if err != nil {
+		return nil, err
+	}
+	if keyLen > 100 {
+		return nil, errors.New("dbf: mdx key length can not be over 100")
+	}
+
+	t := &MdxTag{mdx: m, name: name, expr: expr, keyType: keyType, keyLen: keyLen}
+	t.order = newOrder(m.dt, t.fixKey(keyFn))
+	t.order.compare = mdxCompare(keyType)
+	t.order.build()
+	t.order.lookupField(expr, true, t.unique)
+	m.tags = append(m.tags, t)
+	m.dt.attach(t.order)
+	return t, nil
+}
+
+// DeleteTag removes tag from the index.
+func (m *Mdx) DeleteTag(name string) error {
+	for i, t := range m.tags {
+		if strings.EqualFold(t.name, name) {
+			m.dt.detach(t.order)
+			m.tags = append(m.tags[:i], m.tags[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("dbf: mdx tag '" + name + "' does not exist")
+}
+
+// Close detaches all tags from the table, they no longer follow table changes.
+func (m *Mdx) Close() {
+	for _, t := range m.tags {
+		m.dt.detach(t.order)
+	}
+}
+
+// Save writes index with all tags to its file.
+func (m *Mdx) Save() error {
+	for _, t := range m.tags {
+		if err := t.order.check(); err != nil {
+			return errors.New("dbf: mdx tag " + t.name + ": " + err.Error())
+		}
+	}
+	f, err := os.Create(m.fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(m.encode())
+	return err
+}
+
+// encode whole file, header and tag table are followed by tag headers and pages.
+func (m *Mdx) encode() []byte {
+	start := (mdxTagTable + mdxMaxTags*mdxTagEntryLen + mdxPageSize - 1) / mdxPageSize * mdxPageSize
+	s := make([]byte, start)
+
+	now := time.Now()
+	s[0] = 2 // version
+	s[1], s[2], s[3] = byte(now.Year()%100), byte(now.Month()), byte(now.Day())
+	name := strings.ToUpper(strings.TrimSuffix(filepath.Base(m.fileName), filepath.Ext(m.fileName)))
+	copy(s[4:19], name)
+	binary.LittleEndian.PutUint16(s[20:], mdxPageSize/mdxBlock)
+	binary.LittleEndian.PutUint16(s[22:], mdxPageSize)
+	s[24] = 1 // production index
+	s[25] = mdxMaxTags
+	s[26] = mdxTagEntryLen
+	binary.LittleEndian.PutUint16(s[28:], uint16(len(m.tags)))
+	s[44], s[45], s[46] = s[1], s[2], s[3]
+
+	for i, t := range m.tags {
+		headerBlock := uint32(len(s) / mdxBlock)
+		s = append(s, make([]byte, mdxPageSize)...)
+		itemLen := (t.keyLen + 4 + 3) / 4 * 4
+		maxKeys := (mdxPageSize - 8 - itemLen) / itemLen
+		root := t.writeTree(&s, itemLen, maxKeys)
+
+		h := s[int(headerBlock)*mdxBlock:]
+		copy(h[:mdxBlock], t.header)
+		binary.LittleEndian.PutUint32(h[0:], root)
+		binary.LittleEndian.PutUint32(h[4:], uint32((len(s)-int(headerBlock)*mdxBlock)/mdxPageSize))
+		h[8] = mdxFieldKey
+		if t.descend {
+			h[8] |= mdxDescending
+		}
+		if t.unique {
+			h[8] |= mdxUniqueKey
+			h[23] = 1
+		}
+		h[9] = t.keyType
+		binary.LittleEndian.PutUint16(h[12:], uint16(t.keyLen))
+		binary.LittleEndian.PutUint16(h[14:], uint16(maxKeys))
+		binary.LittleEndian.PutUint16(h[18:], uint16(itemLen))
+		copy(h[mdxExprOffset:mdxExprOffset+mdxExprLength-1], t.expr)
+
+		entry := s[mdxTagTable+i*mdxTagEntryLen:]
+		binary.LittleEndian.PutUint32(entry, headerBlock)
+		copy(entry[4:4+mdxTagNameLen], t.name)
+		entry[15] = mdxFieldKey
+		entry[19] = 0x02
+		entry[20] = t.keyType
+	}
+
+	blocks := uint32(len(s) / mdxBlock)
+	binary.LittleEndian.PutUint32(s[32:], blocks)
+	binary.LittleEndian.PutUint32(s[36:], blocks)
+	return s
+}
+
+// writeTree appends pages of the tag to s and returns block of the root page.
+// Parent keeps the last key of every child, the last child has no key.
+func (t *MdxTag) writeTree(s *[]byte, itemLen, maxKeys int) uint32 {
+	type item struct {
+		ptr uint32
+		key string
+	}
+
+	items := []item{}
+	for _, e := range t.order.sorted() {
+		items = append(items, item{ptr: uint32(e.row + 1), key: e.key})
+	}
+
+	leaf := true
+	for {
+		pages := (len(items) + maxKeys - 1) / maxKeys
+		if !leaf {
+			// interior page holds one more pointer than keys
+			pages = (len(items) + maxKeys) / (maxKeys + 1)
+		}
+		if pages == 0 {
+			pages = 1
+		}
+		per := (len(items) + pages - 1) / pages
+
+		parents := []item{}
+		for p := 0; p < pages; p++ {
+			from, to := p*per, (p+1)*per
+			if to > len(items) {
+				to = len(items)
+			}
+			block := uint32(len(*s) / mdxBlock)
+			page := make([]byte, mdxPageSize)
+			count := to - from
+			if !leaf {
+				count-- // last pointer is stored without key
+			}
+			binary.LittleEndian.PutUint32(page, uint32(count))
+			for i := from; i < to; i++ {
+				at := page[8+(i-from)*itemLen:]
+				binary.LittleEndian.PutUint32(at, items[i].ptr)
+				if leaf || i < to-1 {
+					copy(at[4:4+t.keyLen], items[i].key)
+				}
+			}
+			*s = append(*s, page...)
+			last := ""
+			if to > from {
+				last = items[to-1].key
+			}
+			parents = append(parents, item{ptr: block, key: last})
+		}
+		if pages == 1 {
+			return parents[0].ptr
+		}
+		items, leaf = parents, false
+	}
+}
+
+// fixKey makes sure keys are exactly key length long.
+func (t *MdxTag) fixKey(keyFn KeyFunc) KeyFunc {
+	if keyFn == nil {
+		return nil
+	}
+	return func(dt *DbfTable, row int) (string, bool) {
+		key, ok := keyFn(dt, row)
+		return padKey(key, t.keyLen), ok
+	}
+}
+
+// Name of the tag.
+func (t *MdxTag) Name() string {
+	return t.name
+}
+
+// Expr returns tag key expression.
+func (t *MdxTag) Expr() string {
+	return t.expr
+}
+
+// Type returns key type, C, N or D.
+func (t *MdxTag) Type() string {
+	return string(t.keyType)
+}
+
+// Seek finds first row with key starting with key, deleted rows are skipped.
+// Numeric and date tags need keys encoded with MdxNumberKey and MdxDateKey.
+func (t *MdxTag) Seek(key string) (row int, ok bool) {
+	return t.order.seekRow(key)
+}
+
+// Iterator walks not deleted rows in tag order, see UseIndex for more options.
+func (t *MdxTag) Iterator(opts ...IteratorOption) *Iterator {
+	return t.mdx.dt.NewIterator(append([]IteratorOption{UseIndex(t)}, opts...)...)
+}
+
+// indexOrder returns order of the tag, descending tags are walked in reverse.
+func (t *MdxTag) indexOrder() (*order, bool) {
+	return t.order, t.descend
+}
+
+// Reindex rebuilds tag from the table.
+func (t *MdxTag) Reindex() error {
+	if t.order.keyFn == nil {
+		return errors.New("dbf: can not reindex, tag '" + t.name + "' expression is not supported")
+	}
+	t.order.build()
+	return nil
+}
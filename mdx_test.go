@@ -0,0 +1,167 @@
+package dbf
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMdx(t *testing.T) {
+	db := ntxTable(500)
+	defer os.Remove(tempdbf)
+	defer os.Remove("temp.mdx")
+
+	if db.HasMdx() {
+		t.Fatal("new table should not have production index")
+	}
+	m, err := db.CreateMdx("temp.mdx", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.AddTag("LAST", "LAST+FIRST"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.AddTag("NUM", "NUM"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.AddTag("last", "FIRST"); err == nil {
+		t.Fatal("duplicate tag name should fail")
+	}
+	if err := db.SaveFile(tempdbf); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = LoadFile(tempdbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !db.HasMdx() || db.Mdx() == nil {
+		t.Fatal("production index was not opened")
+	}
+	m = db.Mdx()
+	if len(m.Tags()) != 2 {
+		t.Fatal("expected 2 tags found:", len(m.Tags()))
+	}
+
+	last := m.Tag("last")
+	keyFn, _, _ := db.FieldKey(last.Expr())
+	checkOrder(t, db, last.Iterator(), keyFn, 500)
+
+	num := m.Tag("NUM")
+	if num.Type() != "N" {
+		t.Fatal("expected numeric tag found:", num.Type())
+	}
+	nums := []float64{}
+	for iter := num.Iterator(); iter.Next(); {
+		v, _ := strconv.ParseFloat(db.FieldValue(iter.Index(), 2), 64)
+		nums = append(nums, v)
+	}
+	if len(nums) != 500 || !sort.Float64sAreSorted(nums) {
+		t.Fatal("rows are not in numeric order")
+	}
+	row, ok := num.Seek(MdxNumberKey(42))
+	if !ok || db.FieldValue(row, 2) != "42" {
+		t.Fatal("numeric seek failed, found:", ok, row)
+	}
+
+	// tags follow table changes and are saved with the table
+	db.SetFieldValue(row, 2, "-7")
+	if iter := num.Iterator(); !iter.Next() || iter.Index() != row {
+		t.Fatal("negative number should be first")
+	}
+	db.Delete(0)
+	if err := db.SaveFile(tempdbf); err != nil {
+		t.Fatal(err)
+	}
+	db, err = LoadFile(tempdbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := db.Mdx().Tag("NUM").Seek(MdxNumberKey(-7)); !ok || got != row {
+		t.Fatal("seek after reload failed, found:", ok, got)
+	}
+	checkOrder(t, db, db.Mdx().Tag("LAST").Iterator(), keyFn, 499)
+
+	db.ClearMdxFlag()
+	if db.HasMdx() || db.Mdx() != nil {
+		t.Fatal("production index flag was not cleared")
+	}
+
+	// table with out of date tag is saved without its index
+	db, err = LoadFile(tempdbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Mdx().Tag("NUM").order.stale = true
+	if err := db.SaveFile(tempdbf); err == nil {
+		t.Fatal("expected error of out of date tag")
+	}
+	if saved, err := LoadFile(tempdbf); err != nil || saved.HasMdx() || saved.NumRecords() != 500 {
+		t.Fatal("table should be saved without production index:", err)
+	}
+}
+
+func TestMdxKeys(t *testing.T) {
+	values := []float64{-1000.5, -3, -0.25, 0, 0.001, 0.5, 1, 9.99, 10, 123456.789}
+	cmp := mdxCompare('N')
+	for i := 1; i < len(values); i++ {
+		if cmp(MdxNumberKey(values[i-1]), MdxNumberKey(values[i])) >= 0 {
+			t.Fatal("wrong order of numeric keys", values[i-1], values[i])
+		}
+	}
+	for _, v := range values {
+		if got := mdxBcdValue(MdxNumberKey(v)); got != v {
+			t.Fatal("expected", v, "found:", got)
+		}
+	}
+
+	a := MdxDateKey(time.Date(1999, 12, 31, 0, 0, 0, 0, time.UTC))
+	b := MdxDateKey(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	if mdxCompare('D')(a, b) >= 0 {
+		t.Fatal("wrong order of date keys")
+	}
+}
+
+func TestMdxFiltered(t *testing.T) {
+	db := ntxTable(10)
+	defer os.Remove("temp.mdx")
+	m, err := db.CreateMdx("temp.mdx", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.AddTag("NUM", "NUM"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Save(); err != nil {
+		t.Fatal(err)
+	}
+	m.Close()
+
+	// unknown header bytes, as FOR condition, are written back
+	s, _ := os.ReadFile("temp.mdx")
+	block := int(s[mdxTagTable]) | int(s[mdxTagTable+1])<<8
+	s[block*mdxBlock+300] = 'x'
+	os.WriteFile("temp.mdx", s, 0644)
+
+	// rows missing from the tag are left out by FOR condition
+	db.SetFieldValue(db.AddRecord(), 2, "10")
+	m, err = db.OpenMdx("temp.mdx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Tag("NUM").Reindex(); err == nil {
+		t.Fatal("filtered tag should not be reindexed")
+	}
+	if err := m.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := os.ReadFile("temp.mdx"); s[block*mdxBlock+300] != 'x' {
+		t.Fatal("tag header was not written back")
+	}
+	db.SetFieldValue(0, 2, "42")
+	if err := m.Save(); err == nil {
+		t.Fatal("changed filtered tag should be out of date")
+	}
+}
@@ -0,0 +1,202 @@
+package dbf
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// memIndex is in-memory index created with CreateIndex.
+type memIndex struct {
+	order     *order
+	fields    []int
+	collation Collation // of C fields, nil is byte by byte
+}
+
+// CreateIndex builds in-memory index over one or more fields. Fields are
+// compared by type: numbers by value, dates by calendar and text byte by byte.
+// Index follows SetFieldValue, AddRecord, InsertRecord and Delete.
+func (dt *DbfTable) CreateIndex(name string, fields ...string) error {
+	return dt.CreateCollatedIndex(name, nil, fields...)
+}
+
+// CreateCollatedIndex builds in-memory index as CreateIndex does, with text
+// ordered by collation c. Seek and Range match last text value by Prefix of
+// the collation and Lookup with the same collation finds equal text.
+//
+//	err := dt.CreateCollatedIndex("NAME", dbf.UnicodeCollation("lt"), "LAST", "FIRST")
+func (dt *DbfTable) CreateCollatedIndex(name string, c Collation, fields ...string) error {
+	name = strings.ToUpper(name)
+	if _, ok := dt.indexes[name]; ok {
+		return errors.New("dbf: index '" + name + "' already exist")
+	}
+	if len(fields) == 0 {
+		return errors.New("dbf: index '" + name + "' has no fields")
+	}
+
+	x := &memIndex{}
+	if !sameCollation(c, Binary) {
+		x.collation = c
+	}
+	for _, field := range fields {
+		i, ok := dt.fieldMap[strings.ToUpper(field)]
+		if !ok {
+			return errors.New("dbf: index field '" + field + "' does not exist")
+		}
+		x.fields = append(x.fields, i)
+	}
+	x.order = newOrder(dt, x.keyFunc())
+	x.order.build()
+	x.order.field = x.fields[0]
+	x.order.collation = x.collation
+	x.order.probe = func(value string) string { return string(x.appendKey(dt, nil, x.fields[0], value, false)) }
+
+	if dt.indexes == nil {
+		dt.indexes = map[string]*memIndex{}
+	}
+	dt.indexes[name] = x
+	dt.attach(x.order)
+	return nil
+}
+
+// DropIndex removes in-memory index.
+func (dt *DbfTable) DropIndex(name string) error {
+	x, err := dt.index(name)
+	if err != nil {
+		return err
+	}
+	dt.detach(x.order)
+	delete(dt.indexes, strings.ToUpper(name))
+	return nil
+}
+
+// index returns in-memory index by name.
+func (dt *DbfTable) index(name string) (*memIndex, error) {
+	x, ok := dt.indexes[strings.ToUpper(name)]
+	if !ok {
+		return nil, errors.New("dbf: index '" + name + "' does not exist")
+	}
+	return x, nil
+}
+
+// keyFunc returns key function of the index.
+func (x *memIndex) keyFunc() KeyFunc {
+	return func(dt *DbfTable, row int) (string, bool) {
+		b := []byte{}
+		for _, i := range x.fields {
+			b = x.appendKey(dt, b, i, dt.FieldValue(row, i), false)
+		}
+		return string(b), true
+	}
+}
+
+// key encodes field values of the index, missing trailing values and text
+// of the last value given match as prefix.
+func (x *memIndex) key(dt *DbfTable, values []string) string {
+	if len(values) > len(x.fields) {
+		values = values[:len(x.fields)]
+	}
+	b := []byte{}
+	for j, v := range values {
+		b = x.appendKey(dt, b, x.fields[j], v, j == len(values)-1)
+	}
+	return string(b)
+}
+
+// appendKey appends key of field value, text of collated index by collation.
+func (x *memIndex) appendKey(dt *DbfTable, b []byte, fieldIndex int, value string, partial bool) []byte {
+	if x.collation != nil && dt.fields[fieldIndex].Type == "C" {
+		return appendCollated(b, x.collation, value, partial)
+	}
+	return dt.appendTypedKey(b, fieldIndex, value, partial)
+}
+
+// appendTypedKey appends value of the field encoded so that byte order of keys
+// is the order of values. Text is padded to field length unless partial.
+func (dt *DbfTable) appendTypedKey(b []byte, fieldIndex int, value string, partial bool) []byte {
+	field := dt.fields[fieldIndex]
+	switch field.Type {
+	case "N", "F", "Y":
+		d, err := ParseDecimal(value)
+		if err != nil {
+			// blanks are placed before all numbers
+			return append(b, 0)
+		}
+		return appendDecimalKey(b, d)
+	case "D":
+		return append(b, padKey(strings.TrimSpace(value), 8)...)
+	case "L":
+		switch strings.ToUpper(strings.TrimSpace(value)) {
+		case "T", "Y":
+			return append(b, 'T')
+		case "F", "N":
+			return append(b, 'F')
+		}
+		return append(b, ' ')
+	}
+	if partial {
+		return append(b, value...)
+	}
+	return append(b, padKey(value, int(field.Length))...)
+}
+
+// appendDecimalKey appends key of exact number: sign, exponent and digits
+// without trailing zeros. Digits end with zero byte, so no key is prefix of
+// another and keys of following fields compare after the whole number. Keys
+// of negative numbers are inverted.
+func appendDecimalKey(b []byte, d Decimal) []byte {
+	if d.Sign() == 0 {
+		return append(b, 2)
+	}
+	digits := new(big.Int).Abs(d.int()).String()
+	exp := uint16(len(digits) - d.scale + 0x8000) // value is 0.digits * 10^exp
+	start := len(b)
+	b = append(b, 3, byte(exp>>8), byte(exp))
+	b = append(b, strings.TrimRight(digits, "0")...)
+	b = append(b, 0)
+	if d.Sign() < 0 {
+		b[start] = 1
+		for i := start + 1; i < len(b); i++ {
+			b[i] ^= 0xFF
+		}
+	}
+	return b
+}
+
+// Seek finds first not deleted row of the index matching key, values are given
+// for leading fields of the index and the last text value matches as prefix.
+// ok is false when index does not exist.
+func (dt *DbfTable) Seek(index string, key ...string) (row int, ok bool) {
+	x, err := dt.index(index)
+	if err != nil {
+		return -1, false
+	}
+	return x.order.seekRow(x.key(dt, key))
+}
+
+// Range returns iterator walking not deleted rows of the index with keys from
+// lo to hi inclusive, nil lo or hi leaves range open on that side. Options,
+// such as Reverse or Where, are applied too. Unknown index is reported by Err.
+func (dt *DbfTable) Range(index string, lo, hi []string, opts ...IteratorOption) *Iterator {
+	it := dt.NewIterator(append([]IteratorOption{OrderBy(index)}, opts...)...)
+	if it.err != nil {
+		return it
+	}
+	x, _ := dt.index(index)
+	if lo != nil {
+		it.lo, it.hasLo = x.key(dt, lo), true
+	}
+	if hi != nil {
+		it.hi, it.hasHi = x.key(dt, hi), true
+	}
+	// start next to the first key in range
+	entries := it.order.sorted()
+	if !it.reverse && it.hasLo {
+		it.pos = it.order.seek(it.lo) - 1
+	} else if it.reverse && it.hasHi {
+		end := sort.Search(len(entries), func(i int) bool { return it.above(entries[i].key) })
+		it.pos = len(entries) - end - 1
+	}
+	return it
+}
@@ -0,0 +1,210 @@
+package dbf
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	db := ntxTable(1000)
+	if err := db.CreateIndex("byname", "last", "num"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateIndex("bynum", "num"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateIndex("bynum", "first"); err == nil {
+		t.Fatal("duplicate index name should fail")
+	}
+	if err := db.CreateIndex("bad", "nope"); err == nil {
+		t.Fatal("index on missing field should fail")
+	}
+
+	// numbers are compared by value, not as text
+	prev := -1
+	for it := db.Range("bynum", nil, nil); it.Next(); {
+		n := db.FieldValue(it.Index(), 2)
+		var v int
+		fmt.Sscan(n, &v)
+		if v <= prev {
+			t.Fatal("rows are not in numeric order:", prev, v)
+		}
+		prev = v
+	}
+
+	row, ok := db.Seek("bynum", "42")
+	if !ok || db.FieldValue(row, 2) != "42" {
+		t.Fatal("seek failed, found:", ok, row)
+	}
+	if _, ok := db.Seek("byname", "NAME0004"); !ok {
+		t.Fatal("partial text key should match as prefix")
+	}
+
+	count := 0
+	for it := db.Range("bynum", []string{"10"}, []string{"19"}); it.Next(); count++ {
+	}
+	if count != 10 {
+		t.Fatal("expected 10 rows in range, found:", count)
+	}
+	nums := []string{}
+	for it := db.Range("bynum", []string{"10"}, []string{"19"}, Reverse()); it.Next(); {
+		nums = append(nums, db.FieldValue(it.Index(), 2))
+	}
+	if fmt.Sprint(nums) != "[19 18 17 16 15 14 13 12 11 10]" {
+		t.Fatal("unexpected reverse range:", nums)
+	}
+
+	// unknown index is an error, not a panic
+	if it := db.Range("nope", nil, nil); it.Next() || it.Err() == nil {
+		t.Fatal("expected error of unknown index")
+	}
+	if it := db.NewIterator(OrderBy("nope")); it.Err() == nil {
+		t.Fatal("expected error of unknown index")
+	}
+	if _, ok := db.Seek("nope", "1"); ok {
+		t.Fatal("seek of unknown index should fail")
+	}
+	if err := db.DropIndex("nope"); err == nil {
+		t.Fatal("expected error dropping unknown index")
+	}
+
+	// index follows table changes
+	db.SetFieldValue(row, 2, "5000")
+	if _, ok := db.Seek("bynum", "42"); ok {
+		t.Fatal("changed value is still in the index")
+	}
+	db.Delete(row)
+	if _, ok := db.Seek("bynum", "5000"); ok {
+		t.Fatal("deleted row should be skipped")
+	}
+	row = db.InsertRecord()
+	db.SetFieldValue(row, 2, "-1")
+	if it := db.Range("bynum", nil, nil); !it.Next() || it.Index() != row {
+		t.Fatal("inserted record should be first")
+	}
+	row = db.AddRecord()
+	db.SetFieldValue(row, 2, "15")
+	count = 0
+	for it := db.Range("bynum", []string{"10"}, []string{"19"}); it.Next(); count++ {
+	}
+	if count != 11 {
+		t.Fatal("expected 11 rows in range, found:", count)
+	}
+
+	db.DropIndex("bynum")
+	if err := db.CreateIndex("bynum", "num"); err != nil {
+		t.Fatal(err)
+	}
+
+	// rows added after the index are sorted on next use
+	for i := 0; i < 1000; i++ {
+		db.SetFieldValue(db.AddRecord(), 2, fmt.Sprint((i*7919)%1000+2000))
+	}
+	prev = -2
+	count = 0
+	for it := db.Range("bynum", nil, nil); it.Next(); count++ {
+		var v int
+		fmt.Sscan(db.FieldValue(it.Index(), 2), &v)
+		if v < prev {
+			t.Fatal("rows are not in numeric order:", prev, v)
+		}
+		prev = v
+	}
+	if count != 2001 || prev != 2999 {
+		t.Fatal("expected 2001 rows up to 2999, found:", count, prev)
+	}
+}
+
+func TestIndexNumbers(t *testing.T) {
+	db := New()
+	db.AddNumberField("num", 20, 2)
+	db.AddTextField("name", 4)
+	values := []string{"9007199254740993", "-0.5", "", "9007199254740992", "0", "-12", "0.25", "1e2", "-0.25", "100.01", "-9007199254740993"}
+	for _, v := range values {
+		row := db.AddRecord()
+		db.SetFieldValue(row, 0, v)
+		db.SetFieldValue(row, 1, "x")
+	}
+	if err := db.CreateIndex("bynum", "num", "name"); err != nil {
+		t.Fatal(err)
+	}
+	nums := []string{}
+	for it := db.Range("bynum", nil, nil); it.Next(); {
+		nums = append(nums, db.FieldValue(it.Index(), 0))
+	}
+	want := "[ -9007199254740993 -12 -0.5 -0.25 0 0.25 1e2 100.01 9007199254740992 9007199254740993]"
+	if fmt.Sprint(nums) != want {
+		t.Fatal("expected", want, "found:", nums)
+	}
+	if row, ok := db.Seek("bynum", "9007199254740993.00"); !ok || row != 0 {
+		t.Fatal("expected exact match of row 0 found:", row, ok)
+	}
+	if row, ok := db.Seek("bynum", "100"); !ok || row != 7 {
+		t.Fatal("expected 100 to match 1e2 of row 7 found:", row, ok)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	db := ntxTable(100)
+	if _, ok := db.Lookup("first", "F1"); ok {
+		t.Fatal("lookup without index should fail")
+	}
+	if err := db.CreateIndex("byfirst", "first", "num"); err != nil {
+		t.Fatal(err)
+	}
+	rows, ok := db.Lookup("first", "F1")
+	if !ok || len(rows) != 33 || rows[0] != 1 || rows[1] != 4 {
+		t.Fatal("expected 33 rows starting with 1 and 4, found:", ok, len(rows))
+	}
+
+	defer os.Remove(tempcdx)
+	c, err := db.CreateCdx(tempcdx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.AddTag("num", "num"); err != nil {
+		t.Fatal(err)
+	}
+	db.Delete(42)
+	if rows, ok := db.Lookup("num", "43"); !ok || len(rows) != 1 || rows[0] != 43 {
+		t.Fatal("expected row 43 found:", ok, rows)
+	}
+	if rows, ok := db.Lookup("num", "42"); !ok || len(rows) != 0 {
+		t.Fatal("deleted row should be skipped, found:", rows)
+	}
+
+	// unique indexes and indexes missing rows hold some of the rows only
+	db = ntxTable(10)
+	defer os.Remove(tempntx)
+	x, err := db.CreateNtx(tempntx, "FIRST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows, ok := db.Lookup("first", "F1"); !ok || len(rows) != 3 {
+		t.Fatal("expected 3 rows found:", ok, rows)
+	}
+	x.Close()
+	x.unique = true
+	if err := x.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if x, err = db.OpenNtx(tempntx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.Lookup("first", "F1"); ok {
+		t.Fatal("unique index should not be used")
+	}
+	x.Close()
+	x.unique = false
+	if err := x.Save(); err != nil {
+		t.Fatal(err)
+	}
+	db.SetFieldValue(db.AddRecord(), 1, "F1")
+	if _, err := db.OpenNtx(tempntx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.Lookup("first", "F1"); ok {
+		t.Fatal("index without every row should not be used")
+	}
+}
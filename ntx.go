@@ -0,0 +1,332 @@
+package dbf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"strings"
+)
+
+// Clipper .NTX index file layout.
+const (
+	ntxPageSize  = 1024
+	ntxSignature = 0x0006
+	ntxMaxDepth  = 64 // protects against loops in broken files
+
+	ntxExprOffset    = 22
+	ntxExprLength    = 256
+	ntxUniqueOffset  = 278
+	ntxDescendOffset = 280
+)
+
+// Ntx is Clipper .NTX index attached to the table. Index is kept in memory and
+// follows SetFieldValue, AddRecord, InsertRecord and Delete, call Save to write
+// it back to the file.
+type Ntx struct {
+	dt       *DbfTable
+	order    *order
+	fileName string
+	expr     string
+	keyLen   int
+	unique   bool
+	descend  bool
+}
+
+// OpenNtx reads .NTX index file for the table. Key expressions made of field
+// names joined with plus sign, or any expression once dbf/expr is imported, are
+// maintained when the table changes, other indexes can be used for seeks and
+// ordered iteration only.
+func (dt *DbfTable) OpenNtx(fileName string) (*Ntx, error) {
+	s, err := readFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if len(s) < ntxPageSize {
+		return nil, errors.New("dbf: ntx file is too short")
+	}
+
+	x := &Ntx{dt: dt, fileName: fileName}
+	root := binary.LittleEndian.Uint32(s[4:])
+	itemSize := int(binary.LittleEndian.Uint16(s[12:]))
+	x.keyLen = int(binary.LittleEndian.Uint16(s[14:]))
+	if x.keyLen == 0 || itemSize != x.keyLen+8 {
+		return nil, errors.New("dbf: ntx file has invalid key size")
+	}
+	x.expr = cString(s[ntxExprOffset : ntxExprOffset+ntxExprLength])
+	x.unique = s[ntxUniqueOffset] != 0
+	x.descend = s[ntxDescendOffset] != 0
+
+	entries := []orderEntry{}
+	if err := x.readPage(s, root, 0, &entries); err != nil {
+		return nil, err
+	}
+
+	keyFn, _, err := dt.keyFunc(x.expr)
+	if err != nil {
+		keyFn = nil // index can be read but not maintained
+	}
+	x.order = newOrder(dt, x.fixKey(keyFn))
+	if x.descend {
+		x.order.compare = func(a, b string) int { return strings.Compare(b, a) }
+	}
+	x.order.unique = x.unique
+	x.order.load(entries)
+	x.order.lookupField(x.expr, false, x.unique)
+	dt.attach(x.order)
+	return x, nil
+}
+
+// CreateNtx builds index for key expression made of field names joined with
+// plus sign, for example "LASTNAME+FIRSTNAME", and writes it to the file.
+// Other xBase expressions are accepted once dbf/expr is imported.
+func (dt *DbfTable) CreateNtx(fileName, expr string) (*Ntx, error) {
+	keyFn, keyLen, err := dt.keyFunc(expr)
+	if err != nil {
+		return nil, err
+	}
+	x, err := dt.CreateNtxFunc(fileName, expr, keyLen, keyFn)
+	if err != nil {
+		return nil, err
+	}
+	x.order.lookupField(expr, false, x.unique)
+	return x, nil
+}
+
+// CreateNtxFunc builds index with custom key function, expr is stored in the
+// file for other programs and keys are padded or cut to keyLen.
+func (dt *DbfTable) CreateNtxFunc(fileName, expr string, keyLen int, keyFn KeyFunc) (*Ntx, error) {
+	if keyLen < 1 || keyLen > 250 {
+		return nil, errors.New("dbf: ntx key length must be between 1 and 250")
+	}
+	if len(expr) >= ntxExprLength {
+		return nil, errors.New("dbf: ntx key expression is too long")
+	}
+	x := &Ntx{dt: dt, fileName: fileName, expr: expr, keyLen: keyLen}
+	x.order = newOrder(dt, x.fixKey(keyFn))
+	x.order.build()
+	dt.attach(x.order)
+	if err := x.Save(); err != nil {
+		dt.detach(x.order)
+		return nil, err
+	}
+	return x, nil
+}
+
+// fixKey makes sure keys are exactly key length long.
+func (x *Ntx) fixKey(keyFn KeyFunc) KeyFunc {
+	if keyFn == nil {
+		return nil
+	}
+	return func(dt *DbfTable, row int) (string, bool) {
+		key, ok := keyFn(dt, row)
+		return padKey(key, x.keyLen), ok
+	}
+}
+
+// padKey pads key with spaces or cuts it to keyLen bytes.
+func padKey(key string, keyLen int) string {
+	if len(key) >= keyLen {
+		return key[:keyLen]
+	}
+	return key + strings.Repeat(" ", keyLen-len(key))
+}
+
+// Expr returns index key expression.
+func (x *Ntx) Expr() string {
+	return x.expr
+}
+
+// Seek finds first row with key starting with key, deleted rows are skipped.
+func (x *Ntx) Seek(key string) (row int, ok bool) {
+	return x.order.seekRow(key)
+}
+
+// Iterator walks not deleted rows in index order, see UseIndex for more options.
+func (x *Ntx) Iterator(opts ...IteratorOption) *Iterator {
+	return x.dt.NewIterator(append([]IteratorOption{UseIndex(x)}, opts...)...)
+}
+
+// indexOrder returns order of the index, descending indexes compare keys in
+// reverse so they are walked forward.
+func (x *Ntx) indexOrder() (*order, bool) {
+	return x.order, false
+}
+
+// Reindex rebuilds index from the table.
+func (x *Ntx) Reindex() error {
+	if x.order.keyFn == nil {
+		return errors.New("dbf: can not reindex, key expression '" + x.expr + "' is not supported")
+	}
+	x.order.build()
+	return nil
+}
+
+// Close detaches index from the table, it no longer follows table changes.
+func (x *Ntx) Close() {
+	x.dt.detach(x.order)
+}
+
+// Save writes index to its file.
+func (x *Ntx) Save() error {
+	if err := x.order.check(); err != nil {
+		return err
+	}
+	f, err := os.Create(x.fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(x.encode()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ntxMaxItems returns number of keys that fit into the page, it is kept even.
+func ntxMaxItems(keyLen int) int {
+	n := (ntxPageSize-2)/(keyLen+8+2) - 1
+	if n%2 == 1 {
+		n--
+	}
+	return n
+}
+
+// readPage appends keys of the page and its children in order.
+func (x *Ntx) readPage(s []byte, offset uint32, depth int, entries *[]orderEntry) error {
+	if depth > ntxMaxDepth || offset%ntxPageSize != 0 || int(offset)+ntxPageSize > len(s) || offset == 0 {
+		return errors.New("dbf: ntx file is corrupted")
+	}
+	page := s[offset : offset+ntxPageSize]
+	count := int(binary.LittleEndian.Uint16(page))
+	itemSize := x.keyLen + 8
+
+	for i := 0; i <= count; i++ {
+		at := int(binary.LittleEndian.Uint16(page[2+i*2:]))
+		if at+itemSize > ntxPageSize {
+			return errors.New("dbf: ntx file is corrupted")
+		}
+		item := page[at : at+itemSize]
+		if child := binary.LittleEndian.Uint32(item); child != 0 {
+			if err := x.readPage(s, child, depth+1, entries); err != nil {
+				return err
+			}
+		}
+		if i == count {
+			break // last item holds only the right most child
+		}
+		row := int(binary.LittleEndian.Uint32(item[4:])) - 1
+		if row >= 0 && row < x.dt.NumRecords() {
+			*entries = append(*entries, orderEntry{key: string(item[8:]), row: row})
+		}
+	}
+	return nil
+}
+
+// encode index as B-tree, pages are filled evenly from sorted entries.
+func (x *Ntx) encode() []byte {
+	maxItems := ntxMaxItems(x.keyLen)
+	buf := &bytes.Buffer{}
+	buf.Write(make([]byte, ntxPageSize)) // header page is written at the end
+
+	entries := x.order.sorted()
+	height := 1
+	for ntxCapacity(maxItems, height) < len(entries) {
+		height++
+	}
+	root := x.writeNode(buf, entries, height, maxItems)
+
+	s := buf.Bytes()
+	binary.LittleEndian.PutUint16(s[0:], ntxSignature)
+	binary.LittleEndian.PutUint16(s[2:], 1)
+	binary.LittleEndian.PutUint32(s[4:], root)
+	binary.LittleEndian.PutUint32(s[8:], 0)
+	binary.LittleEndian.PutUint16(s[12:], uint16(x.keyLen+8))
+	binary.LittleEndian.PutUint16(s[14:], uint16(x.keyLen))
+	binary.LittleEndian.PutUint16(s[16:], 0)
+	binary.LittleEndian.PutUint16(s[18:], uint16(maxItems))
+	binary.LittleEndian.PutUint16(s[20:], uint16(maxItems/2))
+	copy(s[ntxExprOffset:ntxExprOffset+ntxExprLength-1], x.expr)
+	if x.unique {
+		s[ntxUniqueOffset] = 1
+	}
+	if x.descend {
+		s[ntxDescendOffset] = 1
+	}
+	return s
+}
+
+// ntxCapacity returns number of keys B-tree of given height can hold.
+func ntxCapacity(maxItems, height int) int {
+	c := maxItems
+	for i := 1; i < height; i++ {
+		c = (c+1)*(maxItems+1) - 1
+	}
+	return c
+}
+
+// writeNode writes subtree of given height holding entries, children pages are
+// written before their parent. Returns offset of the page.
+func (x *Ntx) writeNode(buf *bytes.Buffer, entries []orderEntry, height, maxItems int) uint32 {
+	if height == 1 {
+		return x.writePage(buf, entries, nil, maxItems)
+	}
+
+	// number of children needed so that each fits into height-1 subtree
+	capChild := ntxCapacity(maxItems, height-1)
+	c := (len(entries) + 1 + capChild) / (capChild + 1)
+	if c < 2 {
+		c = 2
+	}
+	inChildren := len(entries) - (c - 1)
+
+	keys := []orderEntry{}
+	children := []uint32{}
+	for i := 0; i < c; i++ {
+		n := inChildren / c
+		if i < inChildren%c {
+			n++
+		}
+		children = append(children, x.writeNode(buf, entries[:n], height-1, maxItems))
+		entries = entries[n:]
+		if i < c-1 {
+			keys = append(keys, entries[0])
+			entries = entries[1:]
+		}
+	}
+	return x.writePage(buf, keys, children, maxItems)
+}
+
+// writePage writes one page, children holds len(keys)+1 page offsets or nil for leaf.
+func (x *Ntx) writePage(buf *bytes.Buffer, keys []orderEntry, children []uint32, maxItems int) uint32 {
+	offset := uint32(buf.Len())
+	page := make([]byte, ntxPageSize)
+	itemSize := x.keyLen + 8
+
+	binary.LittleEndian.PutUint16(page, uint16(len(keys)))
+	first := 2 + (maxItems+1)*2
+	for i := 0; i <= maxItems; i++ {
+		binary.LittleEndian.PutUint16(page[2+i*2:], uint16(first+i*itemSize))
+	}
+	for i := 0; i <= len(keys); i++ {
+		item := page[first+i*itemSize : first+(i+1)*itemSize]
+		if children != nil {
+			binary.LittleEndian.PutUint32(item, children[i])
+		}
+		if i < len(keys) {
+			binary.LittleEndian.PutUint32(item[4:], uint32(keys[i].row+1))
+			copy(item[8:], keys[i].key)
+		}
+	}
+	buf.Write(page)
+	return offset
+}
+
+// cString returns zero terminated string.
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(string(b))
+}
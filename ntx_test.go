@@ -0,0 +1,142 @@
+package dbf
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const tempntx = "temp.ntx"
+
+func ntxTable(n int) *DbfTable {
+	db := New()
+	db.AddTextField("last", 12)
+	db.AddTextField("first", 8)
+	db.AddIntField("num")
+	for i := 0; i < n; i++ {
+		row := db.AddRecord()
+		db.SetFieldValue(row, 0, fmt.Sprintf("NAME%05d", (i*7919)%n))
+		db.SetFieldValue(row, 1, fmt.Sprintf("F%d", i%3))
+		db.SetFieldValue(row, 2, fmt.Sprint(i))
+	}
+	return db
+}
+
+// checkOrder verifies that iterator returns rows sorted by key.
+func checkOrder(t *testing.T, db *DbfTable, iter *Iterator, keyFn KeyFunc, count int) {
+	keys := []string{}
+	for iter.Next() {
+		key, _ := keyFn(db, iter.Index())
+		keys = append(keys, key)
+	}
+	if len(keys) != count {
+		t.Fatal("expected", count, "rows in index order, found:", len(keys))
+	}
+	if !sort.StringsAreSorted(keys) {
+		t.Fatal("rows are not in index order")
+	}
+}
+
+func TestNtx(t *testing.T) {
+	db := ntxTable(3000)
+	defer os.Remove(tempntx)
+
+	x, err := db.CreateNtx(tempntx, "LAST+FIRST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFn, keyLen, err := db.FieldKey(x.Expr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyLen != 20 {
+		t.Fatal("expected key length 20 found:", keyLen)
+	}
+	checkOrder(t, db, x.Iterator(), keyFn, 3000)
+	x.Close()
+
+	x, err = db.OpenNtx(tempntx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Expr() != "LAST+FIRST" {
+		t.Fatal("expected key expression 'LAST+FIRST' found:", x.Expr())
+	}
+	checkOrder(t, db, x.Iterator(), keyFn, 3000)
+
+	row, ok := x.Seek("NAME00042")
+	if !ok || db.FieldValue(row, 0) != "NAME00042" {
+		t.Fatal("seek failed, found:", ok, row)
+	}
+	if _, ok := x.Seek("NOPE"); ok {
+		t.Fatal("seek should fail for missing key")
+	}
+
+	// index follows table changes
+	db.SetFieldValue(row, 0, "AAAA")
+	db.Delete(0)
+	row = db.AddRecord()
+	db.SetFieldValue(row, 0, "ZZZZ")
+	if r, ok := x.Seek("AAAA"); !ok || db.FieldValue(r, 0) != "AAAA" {
+		t.Fatal("seek of updated key failed")
+	}
+	if _, ok := x.Seek("NAME00042"); ok {
+		t.Fatal("old key should not be found after update")
+	}
+	checkOrder(t, db, x.Iterator(), keyFn, 3000)
+
+	if err := x.Save(); err != nil {
+		t.Fatal(err)
+	}
+	x.Close()
+	x, err = db.OpenNtx(tempntx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkOrder(t, db, x.Iterator(), keyFn, 3000)
+	if r, ok := x.Seek("ZZZZ"); !ok || r != row {
+		t.Fatal("seek of added key failed")
+	}
+}
+
+// keysOf returns rows of index order as "key:row" list.
+func keysOf(db *DbfTable, it *Iterator) string {
+	s := []string{}
+	for it.Next() {
+		s = append(s, db.FieldValue(it.Index(), 1)+":"+fmt.Sprint(it.Index()))
+	}
+	return strings.Join(s, " ")
+}
+
+func TestNtxUnique(t *testing.T) {
+	db := ntxTable(10)
+	defer os.Remove(tempntx)
+	x, err := db.CreateNtx(tempntx, "FIRST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.unique, x.order.unique = true, true
+	if err := x.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+	if s := keysOf(db, db.NewIterator(UseIndex(x))); s != "F0:0 F1:1 F2:2" {
+		t.Fatal("expected first row of every key found:", s)
+	}
+	if err := x.Save(); err != nil {
+		t.Fatal(err)
+	}
+	x.Close()
+
+	x, err = db.OpenNtx(tempntx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// changed row leaves its key to the next row with it
+	db.SetFieldValue(0, 1, "F9")
+	db.SetFieldValue(db.AddRecord(), 1, "F1")
+	if s := keysOf(db, db.NewIterator(UseIndex(x))); s != "F0:3 F1:1 F2:2 F9:0" {
+		t.Fatal("unexpected unique keys:", s)
+	}
+}
@@ -0,0 +1,79 @@
+package dbf
+
+import "errors"
+
+// Visual FoxPro keeps null values in hidden _NullFlags field of type '0',
+// one bit for every nullable field.
+const (
+	nullFlagsType = "0"
+	fieldNullable = 0x02 // field flags at byte 18 of field descriptor
+	fieldVarying  = "V"  // varchar fields use _NullFlags bit for their length
+	fieldVarbin   = "Q"
+)
+
+// nullBit returns bit of the field in _NullFlags, -1 when field is not nullable.
+func (dt *DbfTable) nullBit(fieldIndex int) int {
+	if fieldIndex >= len(dt.nullBits) {
+		return -1
+	}
+	return dt.nullBits[fieldIndex]
+}
+
+// layoutNulls computes _NullFlags bits of fields, it is done when schema is
+// read or changed so that reading rows does not change the table.
+func (dt *DbfTable) layoutNulls() {
+	dt.nullBits = make([]int, len(dt.fields))
+	dt.nullField = -1
+	bit := 0
+	for i := range dt.fields {
+		f := &dt.fields[i]
+		dt.nullBits[i] = -1
+		if f.Type == nullFlagsType {
+			dt.nullField = i
+		}
+		if f.Type == fieldVarying || f.Type == fieldVarbin {
+			bit++
+		}
+		if f.fieldStore[18]&fieldNullable != 0 {
+			dt.nullBits[i] = bit
+			bit++
+		}
+	}
+	if dt.nullField < 0 || bit > 8*int(dt.fields[dt.nullField].Length) {
+		for i := range dt.nullBits {
+			dt.nullBits[i] = -1
+		}
+	}
+}
+
+// IsNull reports whether nullable field of Visual FoxPro table is null.
+func (dt *DbfTable) IsNull(row int, fieldIndex int) bool {
+	bit := dt.nullBit(fieldIndex)
+	if bit < 0 {
+		return false
+	}
+	flags := dt.rawField(row, dt.nullField)
+	return flags[bit/8]&(1<<uint(bit%8)) != 0
+}
+
+// SetNull sets nullable field of Visual FoxPro table to null, the cell is
+// cleared. Setting field value with SetFieldValue clears null flag.
+func (dt *DbfTable) SetNull(row int, fieldIndex int) error {
+	bit := dt.nullBit(fieldIndex)
+	if bit < 0 {
+		return errors.New("dbf: field '" + dt.fields[fieldIndex].Name + "' is not nullable")
+	}
+	dt.setFieldValueAt(row, fieldIndex, dt.fieldOffset(fieldIndex), "")
+	flags := dt.rawField(row, dt.nullField)
+	flags[bit/8] |= 1 << uint(bit%8)
+	dt.reindex(row)
+	return nil
+}
+
+// clearNull removes null flag of the field.
+func (dt *DbfTable) clearNull(row int, fieldIndex int) {
+	if bit := dt.nullBit(fieldIndex); bit >= 0 {
+		flags := dt.rawField(row, dt.nullField)
+		flags[bit/8] &^= 1 << uint(bit%8)
+	}
+}
@@ -0,0 +1,93 @@
+package dbf
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+)
+
+type nullable struct {
+	Name   *string
+	Amount *float64
+	Count  sql.NullInt64
+	Active *bool
+	Born   *time.Time
+	Flag   sql.NullBool
+	Note   sql.NullString
+}
+
+func TestNullable(t *testing.T) {
+	db := New()
+	if err := db.Create(nullable{}); err != nil {
+		t.Fatal(err)
+	}
+
+	row := db.Append(nullable{})
+	if v := db.FieldValue(row, 3); v != "?" {
+		t.Fatal("null logical should be stored as '?' found:", v)
+	}
+	var n nullable
+	if err := db.Read(row, &n); err != nil {
+		t.Fatal(err)
+	}
+	if n.Name != nil || n.Amount != nil || n.Count.Valid || n.Active != nil || n.Born != nil || n.Flag.Valid || n.Note.Valid {
+		t.Fatal("expected null values found:", n)
+	}
+
+	name, amount, active := "ACME", 12.5, false
+	born := time.Date(2001, 2, 3, 0, 0, 0, 0, time.UTC)
+	row = db.Append(nullable{Name: &name, Amount: &amount, Count: sql.NullInt64{Int64: 7, Valid: true},
+		Active: &active, Born: &born, Flag: sql.NullBool{Bool: true, Valid: true}, Note: sql.NullString{String: "x", Valid: true}})
+	if err := db.Read(row, &n); err != nil {
+		t.Fatal(err)
+	}
+	if *n.Name != name || *n.Amount != amount || n.Count.Int64 != 7 || *n.Active || !n.Born.Equal(born) || !n.Flag.Bool || n.Note.String != "x" {
+		t.Fatal("unexpected values read:", n)
+	}
+}
+
+func TestNullFlags(t *testing.T) {
+	db := New()
+	db.AddTextField("name", 10)
+	db.AddIntField("num")
+	db.addField("_NullFlags", '0', 1, 0)
+	db.fields[0].fieldStore[18] = fieldNullable
+	db.fields[1].fieldStore[18] = fieldNullable
+	db.updateHeader()
+
+	type row struct {
+		Name *string
+		Num  *int
+	}
+	empty, num := "", 5
+	db.Append(row{Name: &empty, Num: nil})
+	if db.IsNull(0, 0) || !db.IsNull(0, 1) {
+		t.Fatal("expected only num to be null")
+	}
+
+	if err := db.SaveFile(tempdbf); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tempdbf)
+	db, err := LoadFile(tempdbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var r row
+	if err := db.Read(0, &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Name == nil || *r.Name != "" || r.Num != nil {
+		t.Fatal("expected empty name and null num found:", r)
+	}
+
+	db.Write(0, row{Name: nil, Num: &num})
+	if !db.IsNull(0, 0) || db.IsNull(0, 1) {
+		t.Fatal("expected only name to be null")
+	}
+	if err := db.SetNull(0, 2); err == nil {
+		t.Fatal("_NullFlags field is not nullable")
+	}
+}
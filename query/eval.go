@@ -0,0 +1,720 @@
+package query
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tadvi/dbf"
+)
+
+// source is table of FROM clause.
+type source struct {
+	alias  string
+	dt     *dbf.DbfTable
+	fields map[string]int // field index by upper case name
+	all    []int          // not deleted rows, loaded when needed
+}
+
+func newSource(alias string, dt *dbf.DbfTable) *source {
+	src := &source{alias: alias, dt: dt, fields: map[string]int{}}
+	for i, f := range dt.Fields() {
+		src.fields[strings.ToUpper(f.Name)] = i
+	}
+	return src
+}
+
+// colRef is resolved column: source and field index.
+type colRef struct {
+	src, field int
+}
+
+// env is evaluation context: current row of every source, statement
+// parameters and aggregate results of the current group.
+type env struct {
+	sources []*source
+	rows    []int // nil when there is no current row, -1 for missing row of LEFT JOIN
+	args    []interface{}
+	aggs    map[*call]interface{}
+	refs    map[*column]colRef
+	coll    dbf.Collation // of text, nil is byte by byte
+}
+
+func newEnv(sources []*source, args []interface{}, coll dbf.Collation) *env {
+	return &env{sources: sources, args: args, refs: map[*column]colRef{}, coll: coll}
+}
+
+// resolve finds source and field of the column, unqualified columns must be
+// found in exactly one source.
+func (e *env) resolve(c *column) (colRef, error) {
+	if ref, ok := e.refs[c]; ok {
+		return ref, nil
+	}
+	ref := colRef{src: -1}
+	for k, src := range e.sources {
+		if c.table != "" && c.table != src.alias {
+			continue
+		}
+		if i, ok := src.fields[c.name]; ok {
+			if ref.src >= 0 {
+				return ref, fmt.Errorf("query: column %s is ambiguous", c.name)
+			}
+			ref = colRef{src: k, field: i}
+		}
+	}
+	if ref.src < 0 {
+		name := c.name
+		if c.table != "" {
+			name = c.table + "." + name
+		}
+		return ref, fmt.Errorf("query: column %s does not exist", name)
+	}
+	e.refs[c] = ref
+	return ref, nil
+}
+
+// eval returns value of expression: nil, int64, float64, string, bool or time.Time.
+func (e *env) eval(x expr) (interface{}, error) {
+	switch x := x.(type) {
+	case *literal:
+		return x.v, nil
+
+	case *param:
+		if x.n >= len(e.args) {
+			return nil, fmt.Errorf("query: missing parameter %d", x.n+1)
+		}
+		return e.args[x.n], nil
+
+	case *column:
+		ref, err := e.resolve(x)
+		if err != nil {
+			return nil, err
+		}
+		if e.rows == nil {
+			return nil, fmt.Errorf("query: column %s can not be used here", x.name)
+		}
+		row := e.rows[ref.src]
+		if row < 0 {
+			return nil, nil
+		}
+		return e.sources[ref.src].dt.Value(row, ref.field), nil
+
+	case *unary:
+		v, err := e.eval(x.x)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		switch x.op {
+		case "NOT":
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("query: NOT of non logical value %v", v)
+			}
+			return !b, nil
+		case "-":
+			return arithmetic("-", int64(0), v)
+		}
+		return arithmetic("+", int64(0), v)
+
+	case *binary:
+		if x.op == "AND" || x.op == "OR" {
+			return e.logical(x)
+		}
+		a, err := e.eval(x.x)
+		if err != nil {
+			return nil, err
+		}
+		b, err := e.eval(x.y)
+		if err != nil || a == nil || b == nil {
+			return nil, err
+		}
+		switch x.op {
+		case "=", "<>", "<", "<=", ">", ">=":
+			c, err := compare(e.exact(x.x, a, b), e.exact(x.y, b, a), e.coll)
+			if err != nil {
+				return nil, err
+			}
+			return compared(x.op, c), nil
+		}
+		return arithmetic(x.op, a, b)
+
+	case *isNull:
+		v, err := e.eval(x.x)
+		return (v == nil) != x.not, err
+
+	case *inList:
+		v, err := e.eval(x.x)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		var result interface{} = false
+		for _, item := range x.list {
+			w, err := e.eval(item)
+			if err != nil {
+				return nil, err
+			}
+			if w == nil {
+				result = nil // unknown unless found
+				continue
+			}
+			c, err := compare(e.exact(x.x, v, w), w, e.coll)
+			if err != nil {
+				return nil, err
+			}
+			if c == 0 {
+				return !x.not, nil
+			}
+		}
+		if result == nil {
+			return nil, nil
+		}
+		return x.not, nil
+
+	case *between:
+		v, err := e.eval(x.x)
+		if err != nil {
+			return nil, err
+		}
+		lo, err := e.eval(x.lo)
+		if err != nil {
+			return nil, err
+		}
+		hi, err := e.eval(x.hi)
+		if err != nil || v == nil || lo == nil || hi == nil {
+			return nil, err
+		}
+		c1, err := compare(e.exact(x.x, v, lo), lo, e.coll)
+		if err != nil {
+			return nil, err
+		}
+		c2, err := compare(e.exact(x.x, v, hi), hi, e.coll)
+		if err != nil {
+			return nil, err
+		}
+		return (c1 >= 0 && c2 <= 0) != x.not, nil
+
+	case *like:
+		v, err := e.eval(x.x)
+		if err != nil {
+			return nil, err
+		}
+		pattern, err := e.eval(x.pattern)
+		if err != nil || v == nil || pattern == nil {
+			return nil, err
+		}
+		return matchLike(toString(pattern), toString(v)) != x.not, nil
+
+	case *call:
+		if aggregates[x.name] {
+			v, ok := e.aggs[x]
+			if !ok {
+				return nil, fmt.Errorf("query: aggregate %s can not be used here", x.name)
+			}
+			return v, nil
+		}
+		args := make([]interface{}, len(x.args))
+		for i, arg := range x.args {
+			v, err := e.eval(arg)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = v
+		}
+		return functions[x.name](args)
+	}
+	return nil, fmt.Errorf("query: unknown expression %T", x)
+}
+
+// exact returns value v of expression x compared with other value. Numeric
+// field compared with Decimal is read as Decimal, other values are returned
+// as they are.
+func (e *env) exact(x expr, v, other interface{}) interface{} {
+	c, ok := x.(*column)
+	if _, isDecimal := other.(dbf.Decimal); !ok || !isDecimal {
+		return v
+	}
+	switch v.(type) {
+	case int64, float64:
+		ref := e.refs[c] // resolved by eval of the column
+		if d, ok := e.sources[ref.src].dt.DecimalValue(e.rows[ref.src], ref.field); ok {
+			return d
+		}
+	}
+	return v
+}
+
+// logical evaluates AND and OR with SQL three-valued logic, nil is unknown.
+func (e *env) logical(x *binary) (interface{}, error) {
+	truth := func(y expr) (interface{}, error) {
+		v, err := e.eval(y)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		if _, ok := v.(bool); !ok {
+			return nil, fmt.Errorf("query: %s of non logical value %v", x.op, v)
+		}
+		return v, nil
+	}
+	a, err := truth(x.x)
+	if err != nil {
+		return nil, err
+	}
+	// short circuit
+	if a != nil && a.(bool) == (x.op == "OR") {
+		return a, nil
+	}
+	b, err := truth(x.y)
+	if err != nil {
+		return nil, err
+	}
+	if b != nil && b.(bool) == (x.op == "OR") {
+		return b, nil
+	}
+	if a == nil || b == nil {
+		return nil, nil
+	}
+	return b, nil
+}
+
+// compared turns comparison result into bool of the operator.
+func compared(op string, c int) bool {
+	switch op {
+	case "=":
+		return c == 0
+	case "<>":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+// compare compares values by type: numbers by value, dates by calendar and
+// text by collation, byte by byte when it is nil. Text is converted when
+// compared with numbers or dates.
+func compare(a, b interface{}, coll dbf.Collation) (int, error) {
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			if coll != nil {
+				return bytes.Compare(coll.Key(nil, x), coll.Key(nil, y)), nil
+			}
+			return strings.Compare(x, y), nil
+		}
+		c, err := compare(b, a, coll)
+		return -c, err
+	case int64:
+		if y, ok := b.(int64); ok {
+			return cmpInt(x, y), nil
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			if x == y {
+				return 0, nil
+			}
+			if y {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	case time.Time:
+		y, ok := b.(time.Time)
+		if s, isText := b.(string); isText {
+			y, ok = parseDate(s)
+		}
+		if ok {
+			return x.Compare(y), nil
+		}
+	}
+	_, aDecimal := a.(dbf.Decimal)
+	_, bDecimal := b.(dbf.Decimal)
+	if aDecimal || bDecimal {
+		if x, ok := decimal(a); ok {
+			if y, ok := decimal(b); ok {
+				return x.Cmp(y), nil
+			}
+		}
+	}
+	if x, ok := number(a); ok {
+		if y, ok := number(b); ok {
+			switch {
+			case x < y:
+				return -1, nil
+			case x > y:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	return 0, fmt.Errorf("query: can not compare %v and %v", a, b)
+}
+
+func cmpInt(x, y int64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// decimal returns exact value of numbers and numeric text.
+func decimal(v interface{}) (dbf.Decimal, bool) {
+	switch x := v.(type) {
+	case dbf.Decimal:
+		return x, true
+	case int64:
+		return dbf.NewDecimal(x, 0), true
+	case float64:
+		return dbf.DecimalFromFloat(x), true
+	case string:
+		d, err := dbf.ParseDecimal(x)
+		return d, err == nil
+	}
+	return dbf.Decimal{}, false
+}
+
+// number returns numeric value of numbers and numeric text.
+func number(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case int64:
+		return float64(x), true
+	case float64:
+		return x, true
+	case dbf.Decimal:
+		return x.Float64(), true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// parseDate reads YYYY-MM-DD or YYYYMMDD text.
+func parseDate(s string) (time.Time, bool) {
+	for _, layout := range []string{"2006-01-02", "20060102", time.RFC3339} {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func toString(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case time.Time:
+		return x.Format("2006-01-02")
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// arithmetic applies operator to numbers, || concatenates text. Integers stay
+// integers unless divided with remainder.
+func arithmetic(op string, a, b interface{}) (interface{}, error) {
+	if op == "||" {
+		return toString(a) + toString(b), nil
+	}
+	x, xok := a.(int64)
+	y, yok := b.(int64)
+	if xok && yok {
+		switch op {
+		case "+":
+			return x + y, nil
+		case "-":
+			return x - y, nil
+		case "*":
+			return x * y, nil
+		case "/":
+			if y == 0 {
+				return nil, nil
+			}
+			if x%y == 0 {
+				return x / y, nil
+			}
+		}
+	}
+	f, fok := numeric(a)
+	g, gok := numeric(b)
+	if !fok || !gok {
+		return nil, fmt.Errorf("query: operator %s needs numbers, found %v and %v", op, a, b)
+	}
+	switch op {
+	case "+":
+		return f + g, nil
+	case "-":
+		return f - g, nil
+	case "*":
+		return f * g, nil
+	}
+	if g == 0 {
+		return nil, nil // division by zero is null
+	}
+	return f / g, nil
+}
+
+// numeric returns value of numbers only.
+func numeric(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case int64:
+		return float64(x), true
+	case float64:
+		return x, true
+	case dbf.Decimal:
+		return x.Float64(), true
+	}
+	return 0, false
+}
+
+// matchLike matches text against LIKE pattern with % and _ wildcards.
+func matchLike(pattern, s string) bool {
+	p, t := []rune(pattern), []rune(s)
+	// star is position of the last % in pattern and match of text after it
+	star, match := -1, 0
+	i, j := 0, 0
+	for j < len(t) {
+		switch {
+		case i < len(p) && (p[i] == '_' || p[i] == t[j]):
+			i++
+			j++
+		case i < len(p) && p[i] == '%':
+			star, match = i, j
+			i++
+		case star >= 0:
+			i = star + 1
+			match++
+			j = match
+		default:
+			return false
+		}
+	}
+	for i < len(p) && p[i] == '%' {
+		i++
+	}
+	return i == len(p)
+}
+
+// functions are scalar functions, null arguments give null unless noted.
+var functions = map[string]func(args []interface{}) (interface{}, error){
+	"UPPER":    textFunc(strings.ToUpper),
+	"LOWER":    textFunc(strings.ToLower),
+	"TRIM":     textFunc(strings.TrimSpace),
+	"LENGTH":   fn1(func(v interface{}) (interface{}, error) { return int64(len([]rune(toString(v)))), nil }),
+	"ABS":      fn1(func(v interface{}) (interface{}, error) { return numFunc(v, math.Abs) }),
+	"ROUND":    round,
+	"COALESCE": coalesce,
+	"SUBSTR":   substr,
+}
+
+func fn1(f func(v interface{}) (interface{}, error)) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("query: function takes one argument, found %d", len(args))
+		}
+		if args[0] == nil {
+			return nil, nil
+		}
+		return f(args[0])
+	}
+}
+
+func textFunc(f func(string) string) func(args []interface{}) (interface{}, error) {
+	return fn1(func(v interface{}) (interface{}, error) { return f(toString(v)), nil })
+}
+
+func numFunc(v interface{}, f func(float64) float64) (interface{}, error) {
+	switch x := v.(type) {
+	case int64:
+		return int64(f(float64(x))), nil
+	case float64:
+		return f(x), nil
+	case dbf.Decimal:
+		return f(x.Float64()), nil
+	}
+	return nil, fmt.Errorf("query: number expected, found %v", v)
+}
+
+func round(args []interface{}) (interface{}, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("query: ROUND takes one or two arguments")
+	}
+	places := int64(0)
+	if len(args) == 2 {
+		p, ok := args[1].(int64)
+		if !ok {
+			return nil, fmt.Errorf("query: ROUND places must be integer")
+		}
+		places = p
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+	scale := math.Pow(10, float64(places))
+	return numFunc(args[0], func(f float64) float64 { return math.Round(f*scale) / scale })
+}
+
+// coalesce returns the first value that is not null.
+func coalesce(args []interface{}) (interface{}, error) {
+	for _, v := range args {
+		if v != nil {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+// substr returns text from one based start, optionally of given length.
+func substr(args []interface{}) (interface{}, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("query: SUBSTR takes two or three arguments")
+	}
+	for _, v := range args {
+		if v == nil {
+			return nil, nil
+		}
+	}
+	r := []rune(toString(args[0]))
+	start, ok := args[1].(int64)
+	if !ok {
+		return nil, fmt.Errorf("query: SUBSTR start must be integer")
+	}
+	if start < 1 {
+		start = 1
+	}
+	if int(start) > len(r) {
+		return "", nil
+	}
+	r = r[start-1:]
+	if len(args) == 3 {
+		n, ok := args[2].(int64)
+		if !ok {
+			return nil, fmt.Errorf("query: SUBSTR length must be integer")
+		}
+		if n < int64(len(r)) {
+			if n < 0 {
+				n = 0
+			}
+			r = r[:n]
+		}
+	}
+	return string(r), nil
+}
+
+// walk calls fn for expression and its subexpressions.
+func walk(x expr, fn func(x expr)) {
+	fn(x)
+	children(x, func(y expr) { walk(y, fn) })
+}
+
+// children calls fn for direct subexpressions.
+func children(x expr, fn func(x expr)) {
+	switch x := x.(type) {
+	case *unary:
+		fn(x.x)
+	case *binary:
+		fn(x.x)
+		fn(x.y)
+	case *isNull:
+		fn(x.x)
+	case *inList:
+		fn(x.x)
+		for _, y := range x.list {
+			fn(y)
+		}
+	case *between:
+		fn(x.x)
+		fn(x.lo)
+		fn(x.hi)
+	case *like:
+		fn(x.x)
+		fn(x.pattern)
+	case *call:
+		for _, y := range x.args {
+			fn(y)
+		}
+	}
+}
+
+// aggState accumulates aggregate over rows of a group.
+type aggState struct {
+	count    int64
+	sum      interface{} // int64 or float64
+	min, max interface{}
+}
+
+// add adds value of the aggregate argument, nulls are skipped.
+func (s *aggState) add(c *call, v interface{}, coll dbf.Collation) error {
+	if c.star {
+		s.count++
+		return nil
+	}
+	if v == nil {
+		return nil
+	}
+	s.count++
+	switch c.name {
+	case "SUM", "AVG":
+		if _, ok := numeric(v); !ok {
+			return fmt.Errorf("query: %s of non numeric value %v", c.name, v)
+		}
+		if s.sum == nil {
+			s.sum = v
+			return nil
+		}
+		sum, err := arithmetic("+", s.sum, v)
+		if err != nil {
+			return err
+		}
+		s.sum = sum
+	case "MIN", "MAX":
+		if s.min == nil {
+			s.min, s.max = v, v
+			return nil
+		}
+		c1, err := compare(v, s.min, coll)
+		if err != nil {
+			return err
+		}
+		c2, err := compare(v, s.max, coll)
+		if err != nil {
+			return err
+		}
+		if c1 < 0 {
+			s.min = v
+		}
+		if c2 > 0 {
+			s.max = v
+		}
+	}
+	return nil
+}
+
+// result returns value of the aggregate.
+func (s *aggState) result(c *call) interface{} {
+	switch c.name {
+	case "COUNT":
+		return s.count
+	case "SUM":
+		return s.sum
+	case "AVG":
+		if s.count == 0 {
+			return nil
+		}
+		f, _ := numeric(s.sum)
+		return f / float64(s.count)
+	case "MIN":
+		return s.min
+	}
+	return s.max
+}
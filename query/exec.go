@@ -0,0 +1,692 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tadvi/dbf"
+)
+
+// fieldColumn returns result column of table field.
+func fieldColumn(name string, f dbf.DbfField) Column {
+	c := Column{Name: name, Type: f.Type, Length: int(f.Length), Decimals: int(f.Decimals)}
+	switch f.Type {
+	case "C":
+		c.Type, c.Decimals = "CHARACTER", 0
+	case "N":
+		c.Type = "NUMERIC"
+	case "F":
+		c.Type = "FLOAT"
+	case "L":
+		c.Type, c.Length = "LOGICAL", 0
+	case "D":
+		c.Type, c.Length = "DATE", 0
+	}
+	return c
+}
+
+// valueColumn returns result column of computed value.
+func valueColumn(name string, v interface{}) Column {
+	c := Column{Name: name}
+	switch x := v.(type) {
+	case int64, float64:
+		c.Type = "NUMERIC"
+	case dbf.Decimal:
+		c.Type, c.Decimals = "NUMERIC", x.Scale()
+	case string:
+		c.Type = "CHARACTER"
+	case bool:
+		c.Type = "LOGICAL"
+	case time.Time:
+		c.Type = "DATE"
+	}
+	return c
+}
+
+// visibleFields returns indexes of table fields, hidden _NullFlags is left out.
+func visibleFields(dt *dbf.DbfTable) []int {
+	fields := []int{}
+	for i, f := range dt.Fields() {
+		if f.Type != "0" {
+			fields = append(fields, i)
+		}
+	}
+	return fields
+}
+
+// matches reports whether condition of the clause is true for the current rows.
+func (e *env) matches(cond expr, clause string) (bool, error) {
+	if cond == nil {
+		return true, nil
+	}
+	v, err := e.eval(cond)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if v != nil && !ok {
+		return false, fmt.Errorf("query: %s condition is not logical", clause)
+	}
+	return b, nil
+}
+
+// conjuncts splits condition into parts joined by AND.
+func conjuncts(x expr, parts []expr) []expr {
+	if b, ok := x.(*binary); ok && b.op == "AND" {
+		return conjuncts(b.y, conjuncts(b.x, parts))
+	}
+	if x != nil {
+		parts = append(parts, x)
+	}
+	return parts
+}
+
+// candidates returns rows of source k that may match condition. Part of the
+// condition comparing field of the source for equality with value known from
+// earlier sources is looked up in index of the table, otherwise all not
+// deleted rows are returned. Condition must still be checked for every row.
+func (e *env) candidates(k int, cond expr) ([]int, error) {
+	src := e.sources[k]
+	for _, x := range conjuncts(cond, nil) {
+		b, ok := x.(*binary)
+		if !ok || b.op != "=" {
+			continue
+		}
+		for _, pair := range [][2]expr{{b.x, b.y}, {b.y, b.x}} {
+			c, ok := pair[0].(*column)
+			if !ok {
+				continue
+			}
+			ref, err := e.resolve(c)
+			if err != nil || ref.src != k || !e.bound(pair[1], k) {
+				continue
+			}
+			v, err := e.eval(pair[1])
+			if err != nil {
+				return nil, err
+			}
+			if v == nil {
+				return nil, nil // nothing equals null
+			}
+			f := src.dt.Fields()[ref.field]
+			value, ok := storedValue(f, v)
+			if !ok {
+				continue
+			}
+			if rows, ok := src.dt.LookupCollated(f.Name, value, e.coll); ok {
+				return rows, nil
+			}
+		}
+	}
+	if src.all == nil {
+		src.all = []int{}
+		it := src.dt.NewIterator()
+		for it.Next() {
+			src.all = append(src.all, it.Index())
+		}
+	}
+	return src.all, nil
+}
+
+// bound reports whether expression uses columns of sources before k only and
+// no aggregates.
+func (e *env) bound(x expr, k int) bool {
+	ok := true
+	walk(x, func(x expr) {
+		switch x := x.(type) {
+		case *column:
+			if ref, err := e.resolve(x); err != nil || ref.src >= k {
+				ok = false
+			}
+		case *call:
+			if aggregates[x.name] {
+				ok = false
+			}
+		}
+	})
+	return ok
+}
+
+// storedValue formats value the way it is stored in the field, ok is false
+// when index of the field can not be used for the value.
+func storedValue(f dbf.DbfField, v interface{}) (string, bool) {
+	switch f.Type {
+	case "C":
+		s, ok := v.(string)
+		return s, ok
+	case "D":
+		t, ok := v.(time.Time)
+		if s, isText := v.(string); isText {
+			t, ok = parseDate(s)
+		}
+		return t.Format("20060102"), ok
+	case "N":
+		switch x := v.(type) {
+		case int64:
+			return strconv.FormatInt(x, 10), true
+		case float64:
+			return strconv.FormatFloat(x, 'f', -1, 64), true
+		case dbf.Decimal:
+			return x.String(), true
+		}
+	}
+	return "", false
+}
+
+// join calls fn for every combination of source rows from k on that matches
+// join conditions. Missing row of LEFT JOIN is -1.
+func (e *env) join(s *selectStmt, k int, fn func() error) error {
+	if k == len(e.sources) {
+		return fn()
+	}
+	cond := s.from[k].on
+	if k == 0 {
+		cond = s.where
+	}
+	rows, err := e.candidates(k, cond)
+	if err != nil {
+		return err
+	}
+	matched := false
+	for _, row := range rows {
+		e.rows[k] = row
+		if k > 0 {
+			ok, err := e.matches(cond, "ON")
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+		}
+		matched = true
+		if err := e.join(s, k+1, fn); err != nil {
+			return err
+		}
+	}
+	if !matched && s.from[k].left {
+		e.rows[k] = -1
+		if err := e.join(s, k+1, fn); err != nil {
+			return err
+		}
+	}
+	e.rows[k] = -1
+	return nil
+}
+
+// findAggregates returns aggregate calls of the expression.
+func findAggregates(x expr, aggs []*call) []*call {
+	walk(x, func(x expr) {
+		if c, ok := x.(*call); ok && aggregates[c.name] {
+			aggs = append(aggs, c)
+		}
+	})
+	return aggs
+}
+
+// group is set of joined rows with equal GROUP BY values.
+type group struct {
+	rows   []int // first rows of the group, their columns are the same for the group
+	states []aggState
+}
+
+// groupKey encodes GROUP BY values, text equal by collation is one group.
+func groupKey(values []interface{}, coll dbf.Collation) string {
+	var b strings.Builder
+	for _, v := range values {
+		if s, ok := v.(string); ok && coll != nil {
+			fmt.Fprintf(&b, "%T:%x\x00", v, coll.Key(nil, s))
+			continue
+		}
+		fmt.Fprintf(&b, "%T:%v\x00", v, v)
+	}
+	return b.String()
+}
+
+// runSelect executes SELECT on tables of the catalog.
+func runSelect(cat Catalog, s *selectStmt, args []interface{}) (*Result, error) {
+	sources := []*source{}
+	for _, f := range s.from {
+		dt, err := cat.Table(f.table)
+		if err != nil {
+			return nil, err
+		}
+		for _, src := range sources {
+			if src.alias == f.alias {
+				return nil, fmt.Errorf("query: table %s is used twice, give it an alias", f.alias)
+			}
+		}
+		sources = append(sources, newSource(f.alias, dt))
+	}
+	e := newEnv(sources, args, collation(cat))
+
+	items := s.items
+	if items == nil {
+		for _, src := range sources {
+			for _, i := range visibleFields(src.dt) {
+				name := src.dt.Fields()[i].Name
+				items = append(items, selectItem{x: &column{table: src.alias, name: name}, name: name})
+			}
+		}
+	}
+
+	// aggregates of select list, HAVING and ORDER BY
+	aggs := []*call{}
+	for _, item := range items {
+		aggs = findAggregates(item.x, aggs)
+	}
+	aggs = findAggregates(s.having, aggs)
+	for _, o := range s.orderBy {
+		aggs = findAggregates(o.x, aggs)
+	}
+	for _, c := range aggs {
+		for _, arg := range c.args {
+			if len(findAggregates(arg, nil)) > 0 {
+				return nil, fmt.Errorf("query: aggregate %s can not contain aggregate", c.name)
+			}
+		}
+	}
+	for _, f := range s.from {
+		if len(findAggregates(f.on, nil)) > 0 {
+			return nil, fmt.Errorf("query: aggregates can not be used in ON")
+		}
+	}
+	if len(findAggregates(s.where, nil)) > 0 {
+		return nil, fmt.Errorf("query: aggregates can not be used in WHERE")
+	}
+	for _, x := range s.groupBy {
+		if len(findAggregates(x, nil)) > 0 {
+			return nil, fmt.Errorf("query: aggregates can not be used in GROUP BY")
+		}
+	}
+	grouped := len(aggs) > 0 || len(s.groupBy) > 0 || s.having != nil
+	if grouped {
+		if err := e.checkGrouped(s, items); err != nil {
+			return nil, err
+		}
+	}
+
+	// joined rows matching WHERE
+	e.rows = make([]int, len(sources))
+	for k := range e.rows {
+		e.rows[k] = -1
+	}
+	tuples := [][]int{}
+	err := e.join(s, 0, func() error {
+		ok, err := e.matches(s.where, "WHERE")
+		if ok {
+			tuples = append(tuples, append([]int(nil), e.rows...))
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// output rows with their ORDER BY keys
+	type outRow struct {
+		values []interface{}
+		keys   []interface{}
+	}
+	out := []outRow{}
+	emit := func() error {
+		r := outRow{values: make([]interface{}, len(items))}
+		for j, item := range items {
+			v, err := e.eval(item.x)
+			if err != nil {
+				return err
+			}
+			r.values[j] = v
+		}
+		for _, o := range s.orderBy {
+			v, err := orderKey(e, o.x, items, r.values)
+			if err != nil {
+				return err
+			}
+			r.keys = append(r.keys, v)
+		}
+		out = append(out, r)
+		return nil
+	}
+
+	if grouped {
+		groups := []*group{}
+		byKey := map[string]*group{}
+		if len(s.groupBy) == 0 {
+			// without GROUP BY all rows are one group, even when there are none
+			g := &group{rows: e.rows, states: make([]aggState, len(aggs))}
+			groups = append(groups, g)
+			byKey[""] = g
+		}
+		values := make([]interface{}, len(s.groupBy))
+		for _, rows := range tuples {
+			e.rows = rows
+			for j, x := range s.groupBy {
+				if values[j], err = e.eval(x); err != nil {
+					return nil, err
+				}
+			}
+			key := groupKey(values, e.coll)
+			g := byKey[key]
+			if g == nil {
+				g = &group{rows: rows, states: make([]aggState, len(aggs))}
+				groups = append(groups, g)
+				byKey[key] = g
+			}
+			for k, c := range aggs {
+				var v interface{}
+				if !c.star {
+					if v, err = e.eval(c.args[0]); err != nil {
+						return nil, err
+					}
+				}
+				if err := g.states[k].add(c, v, e.coll); err != nil {
+					return nil, err
+				}
+			}
+		}
+		for _, g := range groups {
+			e.rows = g.rows
+			e.aggs = map[*call]interface{}{}
+			for k, c := range aggs {
+				e.aggs[c] = g.states[k].result(c)
+			}
+			ok, err := e.matches(s.having, "HAVING")
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			if err := emit(); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		for _, rows := range tuples {
+			e.rows = rows
+			if err := emit(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(s.orderBy) > 0 {
+		var sortErr error
+		sort.SliceStable(out, func(a, b int) bool {
+			for k, o := range s.orderBy {
+				c, err := compareNull(out[a].keys[k], out[b].keys[k], e.coll)
+				if err != nil && sortErr == nil {
+					sortErr = err
+				}
+				if c != 0 {
+					return c < 0 != o.desc
+				}
+			}
+			return false
+		})
+		if sortErr != nil {
+			return nil, sortErr
+		}
+	}
+
+	// OFFSET and LIMIT
+	offset, limit := int64(0), int64(-1)
+	if s.offset != nil {
+		if offset, err = e.count(s.offset, "OFFSET"); err != nil {
+			return nil, err
+		}
+	}
+	if s.limit != nil {
+		if limit, err = e.count(s.limit, "LIMIT"); err != nil {
+			return nil, err
+		}
+	}
+	if offset > int64(len(out)) {
+		offset = int64(len(out))
+	}
+	out = out[offset:]
+	if limit >= 0 && limit < int64(len(out)) {
+		out = out[:limit]
+	}
+
+	res := &Result{}
+	for j, item := range items {
+		var col Column
+		if c, ok := item.x.(*column); ok {
+			ref, _ := e.resolve(c)
+			col = fieldColumn(item.name, sources[ref.src].dt.Fields()[ref.field])
+		} else {
+			col = Column{Name: item.name}
+			for _, r := range out {
+				if r.values[j] != nil {
+					col = valueColumn(item.name, r.values[j])
+					break
+				}
+			}
+		}
+		res.Columns = append(res.Columns, col)
+	}
+	for _, r := range out {
+		res.Rows = append(res.Rows, r.values)
+	}
+	return res, nil
+}
+
+// checkGrouped checks that columns outside of aggregates in select list,
+// HAVING and ORDER BY are GROUP BY columns.
+func (e *env) checkGrouped(s *selectStmt, items []selectItem) error {
+	grouping := map[colRef]bool{}
+	for _, x := range s.groupBy {
+		if c, ok := x.(*column); ok {
+			ref, err := e.resolve(c)
+			if err != nil {
+				return err
+			}
+			grouping[ref] = true
+		}
+	}
+	check := func(x expr) error {
+		for _, c := range bareColumns(x, nil) {
+			ref, err := e.resolve(c)
+			if err != nil {
+				return err
+			}
+			if !grouping[ref] {
+				return fmt.Errorf("query: column %s must be in GROUP BY or used in aggregate", c.name)
+			}
+		}
+		return nil
+	}
+	for _, item := range items {
+		if err := check(item.x); err != nil {
+			return err
+		}
+	}
+	if err := check(s.having); err != nil {
+		return err
+	}
+	for _, o := range s.orderBy {
+		if c, ok := o.x.(*column); ok && c.table == "" && itemIndex(items, c.name) >= 0 {
+			continue // select list item
+		}
+		if err := check(o.x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bareColumns returns columns used outside of aggregates.
+func bareColumns(x expr, cols []*column) []*column {
+	switch x := x.(type) {
+	case *column:
+		return append(cols, x)
+	case *call:
+		if aggregates[x.name] {
+			return cols
+		}
+	}
+	children(x, func(y expr) { cols = bareColumns(y, cols) })
+	return cols
+}
+
+// itemIndex returns position of select list item of the name or -1.
+func itemIndex(items []selectItem, name string) int {
+	for j, item := range items {
+		if item.name == name {
+			return j
+		}
+	}
+	return -1
+}
+
+// orderKey returns ORDER BY value: select list item given by name or one
+// based position, or expression evaluated for the current rows.
+func orderKey(e *env, x expr, items []selectItem, values []interface{}) (interface{}, error) {
+	switch x := x.(type) {
+	case *column:
+		if j := itemIndex(items, x.name); x.table == "" && j >= 0 {
+			return values[j], nil
+		}
+	case *literal:
+		if n, ok := x.v.(int64); ok {
+			if n < 1 || n > int64(len(items)) {
+				return nil, fmt.Errorf("query: ORDER BY position %d is out of range", n)
+			}
+			return values[n-1], nil
+		}
+	}
+	return e.eval(x)
+}
+
+// compareNull compares values, nulls are placed first.
+func compareNull(a, b interface{}, coll dbf.Collation) (int, error) {
+	switch {
+	case a == nil && b == nil:
+		return 0, nil
+	case a == nil:
+		return -1, nil
+	case b == nil:
+		return 1, nil
+	}
+	return compare(a, b, coll)
+}
+
+// count evaluates LIMIT or OFFSET.
+func (e *env) count(x expr, clause string) (int64, error) {
+	v, err := e.eval(x)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := v.(int64)
+	if !ok || n < 0 {
+		return 0, fmt.Errorf("query: %s must be non negative integer", clause)
+	}
+	return n, nil
+}
+
+// tableEnv returns environment of single table statement.
+func tableEnv(dt *dbf.DbfTable, name string, args []interface{}, coll dbf.Collation) *env {
+	return newEnv([]*source{newSource(name, dt)}, args, coll)
+}
+
+// matchingRows returns not deleted rows matching WHERE condition.
+func (e *env) matchingRows(where expr) ([]int, error) {
+	candidates, err := e.candidates(0, where)
+	if err != nil {
+		return nil, err
+	}
+	rows := []int{}
+	e.rows = []int{-1}
+	for _, row := range candidates {
+		e.rows[0] = row
+		ok, err := e.matches(where, "WHERE")
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			rows = append(rows, row)
+		}
+	}
+	e.rows = nil
+	return rows, nil
+}
+
+// runInsert appends rows and returns the last of them.
+func runInsert(dt *dbf.DbfTable, s *insertStmt, args []interface{}) (last, n int, err error) {
+	e := tableEnv(dt, s.table, args, nil)
+	last = -1
+	cols := s.cols
+	if cols == nil {
+		for _, i := range visibleFields(dt) {
+			cols = append(cols, dt.Fields()[i].Name)
+		}
+	}
+	for _, values := range s.rows {
+		if len(values) != len(cols) {
+			return last, n, fmt.Errorf("query: %d values given for %d columns", len(values), len(cols))
+		}
+		m := map[string]interface{}{}
+		for j, x := range values {
+			v, err := e.eval(x)
+			if err != nil {
+				return last, n, err
+			}
+			m[cols[j]] = v
+		}
+		row, err := dt.AppendMap(m)
+		if err != nil {
+			return last, n, err
+		}
+		last, n = row, n+1
+	}
+	return last, n, nil
+}
+
+// runUpdate sets fields of matching rows and returns their number.
+func runUpdate(dt *dbf.DbfTable, s *updateStmt, args []interface{}, coll dbf.Collation) (int, error) {
+	e := tableEnv(dt, s.table, args, coll)
+	for _, name := range s.cols {
+		if _, err := e.resolve(&column{name: name}); err != nil {
+			return 0, err
+		}
+	}
+	rows, err := e.matchingRows(s.where)
+	if err != nil {
+		return 0, err
+	}
+	e.rows = []int{-1}
+	for _, row := range rows {
+		// all values are computed from the row before it changes
+		e.rows[0] = row
+		m := map[string]interface{}{}
+		for j, x := range s.set {
+			v, err := e.eval(x)
+			if err != nil {
+				return 0, err
+			}
+			m[s.cols[j]] = v
+		}
+		if err := dt.WriteMap(row, m); err != nil {
+			return 0, err
+		}
+	}
+	return len(rows), nil
+}
+
+// runDelete marks matching rows deleted and returns their number.
+func runDelete(dt *dbf.DbfTable, s *deleteStmt, args []interface{}, coll dbf.Collation) (int, error) {
+	e := tableEnv(dt, s.table, args, coll)
+	rows, err := e.matchingRows(s.where)
+	if err != nil {
+		return 0, err
+	}
+	for _, row := range rows {
+		dt.Delete(row)
+	}
+	return len(rows), nil
+}
@@ -0,0 +1,828 @@
+package query
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// token kinds
+const (
+	tokEOF = iota
+	tokIdent
+	tokNum
+	tokStr
+	tokParam
+	tokOp
+)
+
+type token struct {
+	kind int
+	text string // unquoted identifiers and operators are upper case
+	pos  int
+}
+
+// ops are symbol operators, longer ones first.
+var ops = []string{"<=", ">=", "<>", "!=", "||",
+	"=", "<", ">", "+", "-", "*", "/", "(", ")", ",", ".", ";"}
+
+// statements
+type (
+	selectStmt struct {
+		items   []selectItem // nil for SELECT *
+		from    []fromItem
+		where   expr
+		groupBy []expr
+		having  expr
+		orderBy []orderItem
+		limit   expr // nil without LIMIT
+		offset  expr
+	}
+	selectItem struct {
+		x    expr
+		name string
+	}
+	// fromItem is table of FROM clause, tables after the first are joined
+	fromItem struct {
+		table string
+		alias string
+		left  bool // LEFT JOIN, otherwise INNER JOIN
+		on    expr
+	}
+	orderItem struct {
+		x    expr
+		desc bool
+	}
+	insertStmt struct {
+		table string
+		cols  []string // nil for all fields
+		rows  [][]expr
+	}
+	updateStmt struct {
+		table string
+		cols  []string
+		set   []expr
+		where expr
+	}
+	deleteStmt struct {
+		table string
+		where expr
+	}
+)
+
+// expressions
+type (
+	expr    interface{}
+	literal struct{ v interface{} }
+	param   struct{ n int }              // zero based
+	column  struct{ table, name string } // table is alias or table name, empty when not qualified
+	unary   struct {
+		op string
+		x  expr
+	}
+	binary struct {
+		op   string
+		x, y expr
+	}
+	isNull struct {
+		x   expr
+		not bool
+	}
+	inList struct {
+		x    expr
+		list []expr
+		not  bool
+	}
+	between struct {
+		x, lo, hi expr
+		not       bool
+	}
+	like struct {
+		x, pattern expr
+		not        bool
+	}
+	call struct {
+		name string
+		args []expr
+		star bool // COUNT(*)
+	}
+)
+
+// aggregates are functions computed over rows of a group.
+var aggregates = map[string]bool{"COUNT": true, "SUM": true, "AVG": true, "MIN": true, "MAX": true}
+
+type parser struct {
+	src    string
+	toks   []token
+	pos    int
+	params int // parameters seen, ? are numbered in order
+}
+
+// parse returns statement of SQL source and number of its parameters.
+func parse(src string) (interface{}, int, error) {
+	p := &parser{src: src}
+	if err := p.lex(); err != nil {
+		return nil, 0, err
+	}
+	var stmt interface{}
+	var err error
+	switch t := p.next(); {
+	case p.is(t, "SELECT"):
+		stmt, err = p.selectStmt()
+	case p.is(t, "INSERT"):
+		stmt, err = p.insertStmt()
+	case p.is(t, "UPDATE"):
+		stmt, err = p.updateStmt()
+	case p.is(t, "DELETE"):
+		stmt, err = p.deleteStmt()
+	default:
+		err = p.errorAt(t.pos, "expected SELECT, INSERT, UPDATE or DELETE")
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	p.accept(";")
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, 0, p.errorAt(t.pos, "unexpected '"+t.text+"'")
+	}
+	return stmt, p.params, nil
+}
+
+// lex splits source into tokens.
+func (p *parser) lex() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+
+		case c == '-' && strings.HasPrefix(s[i:], "--"):
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+
+		case c == '\'':
+			// quotes are escaped by doubling them
+			b := []byte{}
+			j := i + 1
+			for ; j < len(s); j++ {
+				if s[j] == '\'' {
+					if j+1 < len(s) && s[j+1] == '\'' {
+						j++
+					} else {
+						break
+					}
+				}
+				b = append(b, s[j])
+			}
+			if j >= len(s) {
+				return p.errorAt(i, "unterminated string")
+			}
+			p.toks = append(p.toks, token{kind: tokStr, text: string(b), pos: i})
+			i = j + 1
+
+		case c == '"' || c == '`':
+			j := strings.IndexByte(s[i+1:], c)
+			if j < 0 {
+				return p.errorAt(i, "unterminated identifier")
+			}
+			p.toks = append(p.toks, token{kind: tokIdent, text: strings.ToUpper(s[i+1 : i+1+j]), pos: i})
+			i += j + 2
+
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			if j < len(s) && (s[j] == 'e' || s[j] == 'E') {
+				k := j + 1
+				if k < len(s) && (s[k] == '+' || s[k] == '-') {
+					k++
+				}
+				if k < len(s) && s[k] >= '0' && s[k] <= '9' {
+					for j = k; j < len(s) && s[j] >= '0' && s[j] <= '9'; j++ {
+					}
+				}
+			}
+			p.toks = append(p.toks, token{kind: tokNum, text: s[i:j], pos: i})
+			i = j
+
+		case c == '?':
+			p.toks = append(p.toks, token{kind: tokParam, pos: i})
+			i++
+
+		case c == '$' || c == ':':
+			// $1 and :1 parameters
+			j := i + 1
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			if j == i+1 {
+				return p.errorAt(i, "expected parameter number")
+			}
+			p.toks = append(p.toks, token{kind: tokParam, text: s[i+1 : j], pos: i})
+			i = j
+
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i
+			for j < len(s) && (s[j] == '_' || unicode.IsLetter(rune(s[j])) || s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			p.toks = append(p.toks, token{kind: tokIdent, text: strings.ToUpper(s[i:j]), pos: i})
+			i = j
+
+		default:
+			op := ""
+			for _, o := range ops {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return p.errorAt(i, "unexpected character "+strconv.QuoteRune(rune(c)))
+			}
+			p.toks = append(p.toks, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	p.toks = append(p.toks, token{kind: tokEOF, pos: len(s)})
+	return nil
+}
+
+func (p *parser) errorAt(pos int, msg string) error {
+	return errors.New("query: " + msg + " at position " + strconv.Itoa(pos+1) + " in '" + p.src + "'")
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// is reports whether token is keyword.
+func (p *parser) is(t token, keyword string) bool {
+	return t.kind == tokIdent && t.text == keyword
+}
+
+// keyword consumes keyword if it is next.
+func (p *parser) keyword(keyword string) bool {
+	if p.is(p.peek(), keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(keyword string) error {
+	if !p.keyword(keyword) {
+		return p.errorAt(p.peek().pos, "expected "+keyword)
+	}
+	return nil
+}
+
+// accept consumes operator if it is next.
+func (p *parser) accept(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		return p.errorAt(p.peek().pos, "expected '"+op+"'")
+	}
+	return nil
+}
+
+// reserved words can not be used as aliases without AS.
+var reserved = map[string]bool{
+	"FROM": true, "WHERE": true, "GROUP": true, "HAVING": true, "ORDER": true, "LIMIT": true,
+	"OFFSET": true, "AND": true, "OR": true, "NOT": true, "AS": true, "BY": true, "ON": true,
+	"JOIN": true, "INNER": true, "LEFT": true, "OUTER": true,
+}
+
+func (p *parser) ident() (string, error) {
+	t := p.peek()
+	if t.kind != tokIdent {
+		return "", p.errorAt(t.pos, "expected name")
+	}
+	p.pos++
+	return t.text, nil
+}
+
+// columnName reads column name, optionally qualified by table name.
+func (p *parser) columnName() (string, error) {
+	name, err := p.ident()
+	if err != nil {
+		return "", err
+	}
+	if _, ok := p.accept("."); ok {
+		return p.ident()
+	}
+	return name, nil
+}
+
+func (p *parser) selectStmt() (*selectStmt, error) {
+	s := &selectStmt{}
+	if _, ok := p.accept("*"); !ok {
+		for {
+			start := p.peek().pos
+			x, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			item := selectItem{x: x, name: strings.TrimSpace(p.src[start:p.peek().pos])}
+			if c, ok := x.(*column); ok {
+				item.name = c.name
+			}
+			if p.keyword("AS") {
+				if item.name, err = p.ident(); err != nil {
+					return nil, err
+				}
+			} else if t := p.peek(); t.kind == tokIdent && !reserved[t.text] {
+				item.name = p.next().text
+			}
+			s.items = append(s.items, item)
+			if _, ok := p.accept(","); !ok {
+				break
+			}
+		}
+	}
+
+	var err error
+	if err = p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	from, err := p.fromItem()
+	if err != nil {
+		return nil, err
+	}
+	s.from = append(s.from, from)
+	for {
+		left := false
+		if p.keyword("LEFT") {
+			left = true
+			p.keyword("OUTER")
+		} else {
+			p.keyword("INNER")
+		}
+		if !p.keyword("JOIN") {
+			if left {
+				return nil, p.errorAt(p.peek().pos, "expected JOIN")
+			}
+			break
+		}
+		join, err := p.fromItem()
+		if err != nil {
+			return nil, err
+		}
+		join.left = left
+		if err = p.expectKeyword("ON"); err != nil {
+			return nil, err
+		}
+		if join.on, err = p.expr(); err != nil {
+			return nil, err
+		}
+		s.from = append(s.from, join)
+	}
+	if p.keyword("WHERE") {
+		if s.where, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.keyword("GROUP") {
+		if err = p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			x, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			s.groupBy = append(s.groupBy, x)
+			if _, ok := p.accept(","); !ok {
+				break
+			}
+		}
+	}
+	if p.keyword("HAVING") {
+		if s.having, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.keyword("ORDER") {
+		if err = p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			item := orderItem{}
+			if item.x, err = p.expr(); err != nil {
+				return nil, err
+			}
+			if p.keyword("DESC") {
+				item.desc = true
+			} else {
+				p.keyword("ASC")
+			}
+			s.orderBy = append(s.orderBy, item)
+			if _, ok := p.accept(","); !ok {
+				break
+			}
+		}
+	}
+	if p.keyword("LIMIT") {
+		if s.limit, err = p.primary(); err != nil {
+			return nil, err
+		}
+		if _, ok := p.accept(","); ok {
+			// LIMIT offset, count
+			s.offset = s.limit
+			if s.limit, err = p.primary(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if p.keyword("OFFSET") {
+		if s.offset, err = p.primary(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// fromItem reads table name with optional alias.
+func (p *parser) fromItem() (fromItem, error) {
+	f := fromItem{}
+	var err error
+	if f.table, err = p.ident(); err != nil {
+		return f, err
+	}
+	f.alias = f.table
+	if p.keyword("AS") {
+		f.alias, err = p.ident()
+	} else if t := p.peek(); t.kind == tokIdent && !reserved[t.text] {
+		f.alias = p.next().text
+	}
+	return f, err
+}
+
+func (p *parser) insertStmt() (*insertStmt, error) {
+	s := &insertStmt{}
+	var err error
+	if err = p.expectKeyword("INTO"); err != nil {
+		return nil, err
+	}
+	if s.table, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if _, ok := p.accept("("); ok {
+		if s.cols, err = p.names(); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.expectKeyword("VALUES"); err != nil {
+		return nil, err
+	}
+	for {
+		if err = p.expect("("); err != nil {
+			return nil, err
+		}
+		row, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		if s.cols != nil && len(row) != len(s.cols) {
+			return nil, p.errorAt(p.peek().pos, "number of values does not match number of columns")
+		}
+		s.rows = append(s.rows, row)
+		if _, ok := p.accept(","); !ok {
+			break
+		}
+	}
+	return s, nil
+}
+
+// names reads column names up to closing parenthesis.
+func (p *parser) names() ([]string, error) {
+	names := []string{}
+	for {
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if _, ok := p.accept(","); !ok {
+			return names, p.expect(")")
+		}
+	}
+}
+
+// exprList reads expressions up to closing parenthesis.
+func (p *parser) exprList() ([]expr, error) {
+	list := []expr{}
+	for {
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, x)
+		if _, ok := p.accept(","); !ok {
+			return list, p.expect(")")
+		}
+	}
+}
+
+func (p *parser) updateStmt() (*updateStmt, error) {
+	s := &updateStmt{}
+	var err error
+	if s.table, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if err = p.expectKeyword("SET"); err != nil {
+		return nil, err
+	}
+	for {
+		name, err := p.columnName()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect("="); err != nil {
+			return nil, err
+		}
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		s.cols = append(s.cols, name)
+		s.set = append(s.set, x)
+		if _, ok := p.accept(","); !ok {
+			break
+		}
+	}
+	if p.keyword("WHERE") {
+		if s.where, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (p *parser) deleteStmt() (*deleteStmt, error) {
+	s := &deleteStmt{}
+	var err error
+	if err = p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	if s.table, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if p.keyword("WHERE") {
+		if s.where, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (p *parser) expr() (expr, error) {
+	return p.or()
+}
+
+func (p *parser) or() (expr, error) {
+	x, err := p.and()
+	for err == nil && p.keyword("OR") {
+		var y expr
+		if y, err = p.and(); err == nil {
+			x = &binary{op: "OR", x: x, y: y}
+		}
+	}
+	return x, err
+}
+
+func (p *parser) and() (expr, error) {
+	x, err := p.not()
+	for err == nil && p.keyword("AND") {
+		var y expr
+		if y, err = p.not(); err == nil {
+			x = &binary{op: "AND", x: x, y: y}
+		}
+	}
+	return x, err
+}
+
+func (p *parser) not() (expr, error) {
+	if p.keyword("NOT") {
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &unary{op: "NOT", x: x}, nil
+	}
+	return p.compare()
+}
+
+func (p *parser) compare() (expr, error) {
+	x, err := p.add()
+	if err != nil {
+		return nil, err
+	}
+	if op, ok := p.accept("=", "<>", "!=", "<=", ">=", "<", ">"); ok {
+		y, err := p.add()
+		if err != nil {
+			return nil, err
+		}
+		if op == "!=" {
+			op = "<>"
+		}
+		return &binary{op: op, x: x, y: y}, nil
+	}
+
+	if p.keyword("IS") {
+		not := p.keyword("NOT")
+		if err := p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return &isNull{x: x, not: not}, nil
+	}
+	not := p.keyword("NOT")
+	switch {
+	case p.keyword("IN"):
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		list, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		return &inList{x: x, list: list, not: not}, nil
+	case p.keyword("BETWEEN"):
+		lo, err := p.add()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		hi, err := p.add()
+		if err != nil {
+			return nil, err
+		}
+		return &between{x: x, lo: lo, hi: hi, not: not}, nil
+	case p.keyword("LIKE"):
+		pattern, err := p.add()
+		if err != nil {
+			return nil, err
+		}
+		return &like{x: x, pattern: pattern, not: not}, nil
+	}
+	if not {
+		return nil, p.errorAt(p.peek().pos, "expected IN, BETWEEN or LIKE")
+	}
+	return x, nil
+}
+
+func (p *parser) add() (expr, error) {
+	x, err := p.mul()
+	for err == nil {
+		op, ok := p.accept("+", "-", "||")
+		if !ok {
+			break
+		}
+		var y expr
+		if y, err = p.mul(); err == nil {
+			x = &binary{op: op, x: x, y: y}
+		}
+	}
+	return x, err
+}
+
+func (p *parser) mul() (expr, error) {
+	x, err := p.unary()
+	for err == nil {
+		op, ok := p.accept("*", "/")
+		if !ok {
+			break
+		}
+		var y expr
+		if y, err = p.unary(); err == nil {
+			x = &binary{op: op, x: x, y: y}
+		}
+	}
+	return x, err
+}
+
+func (p *parser) unary() (expr, error) {
+	if op, ok := p.accept("-", "+"); ok {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &unary{op: op, x: x}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNum:
+		if n, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return &literal{v: n}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorAt(t.pos, "invalid number "+t.text)
+		}
+		return &literal{v: f}, nil
+
+	case tokStr:
+		return &literal{v: t.text}, nil
+
+	case tokParam:
+		n := p.params
+		if t.text != "" {
+			n, _ = strconv.Atoi(t.text)
+			if n < 1 {
+				return nil, p.errorAt(t.pos, "parameters are numbered from 1")
+			}
+			n--
+		}
+		if n >= p.params {
+			p.params = n + 1
+		}
+		return &param{n: n}, nil
+
+	case tokIdent:
+		switch t.text {
+		case "NULL":
+			return &literal{v: nil}, nil
+		case "TRUE":
+			return &literal{v: true}, nil
+		case "FALSE":
+			return &literal{v: false}, nil
+		}
+		if _, ok := p.accept("("); ok {
+			return p.call(t)
+		}
+		if _, ok := p.accept("."); ok {
+			name, err := p.ident()
+			return &column{table: t.text, name: name}, err
+		}
+		return &column{name: t.text}, nil
+
+	case tokOp:
+		if t.text == "(" {
+			x, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		}
+	}
+	if t.kind == tokEOF {
+		return nil, p.errorAt(t.pos, "unexpected end of statement")
+	}
+	return nil, p.errorAt(t.pos, "unexpected '"+t.text+"'")
+}
+
+// call reads function call after opening parenthesis.
+func (p *parser) call(name token) (expr, error) {
+	c := &call{name: name.text}
+	if _, ok := p.accept("*"); ok {
+		if c.name != "COUNT" {
+			return nil, p.errorAt(name.pos, "only COUNT accepts *")
+		}
+		c.star = true
+		return c, p.expect(")")
+	}
+	if _, ok := p.accept(")"); !ok {
+		var err error
+		if c.args, err = p.exprList(); err != nil {
+			return nil, err
+		}
+	}
+	if aggregates[c.name] && len(c.args) != 1 {
+		return nil, p.errorAt(name.pos, c.name+" takes one argument")
+	}
+	if _, ok := functions[c.name]; !ok && !aggregates[c.name] {
+		return nil, p.errorAt(name.pos, "unknown function "+c.name)
+	}
+	return c, nil
+}
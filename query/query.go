@@ -0,0 +1,250 @@
+/*
+Package query executes SQL statements against dbf tables.
+
+	tables := query.Tables{"customer": customers, "orders": orders}
+	res, err := query.Select(tables, `
+		SELECT c.name, COUNT(*) AS n, SUM(o.amount) AS total
+		FROM customer c LEFT JOIN orders o ON o.custid = c.id
+		WHERE c.active
+		GROUP BY c.name HAVING COUNT(*) > ?
+		ORDER BY total DESC LIMIT 10`, 1)
+
+SELECT supports projections with aliases, WHERE, inner and LEFT JOIN ...
+ON, GROUP BY with HAVING and aggregates COUNT, SUM, AVG, MIN and MAX,
+ORDER BY, LIMIT and OFFSET. INSERT, UPDATE and DELETE change single table.
+Parameters are given as ? or $1.
+
+Expressions have operators = <> != < <= > >= + - * / || AND OR NOT, IS
+[NOT] NULL, [NOT] IN, [NOT] BETWEEN, [NOT] LIKE and functions UPPER, LOWER,
+TRIM, LENGTH, ABS, ROUND, COALESCE and SUBSTR. Values are typed by field
+type as by DbfTable.Value: C as string, N as int64 or float64, L as bool and D
+as time.Time, blank cells are NULL. Text compared with numbers or dates is
+converted, dates as YYYY-MM-DD. Fields compared with dbf.Decimal parameters
+are read as decimals, so the comparison is exact.
+
+Comparisons of a field for equality with a constant, a parameter or, in ON
+conditions, a column of an earlier table use DbfTable.Lookup, so in-memory
+indexes and attached .NTX, .CDX and .MDX indexes keyed by the field speed up
+filters and joins. Other rows are scanned.
+
+Text compares byte by byte. Catalog given by Collate compares, sorts and
+groups text by collation instead, as dbf.UnicodeCollation("lt").
+*/
+package query
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/tadvi/dbf"
+)
+
+// Catalog finds tables by name used in statements.
+type Catalog interface {
+	Table(name string) (*dbf.DbfTable, error)
+}
+
+// Tables is catalog of tables by name, names are not case sensitive.
+type Tables map[string]*dbf.DbfTable
+
+// Table returns table of the name.
+func (t Tables) Table(name string) (*dbf.DbfTable, error) {
+	if dt, ok := t[name]; ok {
+		return dt, nil
+	}
+	for n, dt := range t {
+		if strings.EqualFold(n, name) {
+			return dt, nil
+		}
+	}
+	return nil, errors.New("query: table " + name + " does not exist")
+}
+
+// Collate returns catalog of the same tables whose statements compare, sort
+// and group text by collation c. Equality on C fields uses indexes created
+// with CreateCollatedIndex and the same collation only, .NTX, .CDX and .MDX
+// indexes have binary keys and are not used.
+//
+//	res, err := query.Select(query.Collate(tables, dbf.UnicodeCollation("de")),
+//		"SELECT name FROM customer ORDER BY name")
+func Collate(cat Catalog, c dbf.Collation) Catalog {
+	return collated{Catalog: cat, c: c}
+}
+
+type collated struct {
+	Catalog
+	c dbf.Collation
+}
+
+// collation returns collation of text in statements run on the catalog, nil
+// when text compares byte by byte.
+func collation(cat Catalog) dbf.Collation {
+	if c, ok := cat.(collated); ok {
+		return c.c
+	}
+	return nil
+}
+
+// Statement is parsed statement, *Query or *Command.
+type Statement interface {
+	// NumParams returns number of statement parameters.
+	NumParams() int
+}
+
+// Parse parses SQL statement, SELECT gives *Query and INSERT, UPDATE and
+// DELETE give *Command.
+func Parse(src string) (Statement, error) {
+	s, n, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	switch s := s.(type) {
+	case *selectStmt:
+		return &Query{s: s, n: n}, nil
+	case *insertStmt:
+		return &Command{s: s, table: s.table, n: n}, nil
+	case *updateStmt:
+		return &Command{s: s, table: s.table, n: n}, nil
+	case *deleteStmt:
+		return &Command{s: s, table: s.table, n: n}, nil
+	}
+	return nil, fmt.Errorf("query: unknown statement %T", s)
+}
+
+// Query is parsed SELECT statement.
+type Query struct {
+	s *selectStmt
+	n int
+}
+
+func (q *Query) NumParams() int {
+	return q.n
+}
+
+// Run executes query on tables of the catalog.
+func (q *Query) Run(c Catalog, args ...interface{}) (*Result, error) {
+	values, err := params(args, q.n)
+	if err != nil {
+		return nil, err
+	}
+	return runSelect(c, q.s, values)
+}
+
+// Command is parsed INSERT, UPDATE or DELETE statement.
+type Command struct {
+	s     interface{}
+	table string
+	n     int
+}
+
+func (c *Command) NumParams() int {
+	return c.n
+}
+
+// Table returns name of the table changed by command.
+func (c *Command) Table() string {
+	return c.table
+}
+
+// Run executes command and returns the last inserted row, -1 when none, and
+// number of inserted, updated or deleted rows. Rows changed before error stay
+// changed.
+func (c *Command) Run(cat Catalog, args ...interface{}) (lastRow, affected int, err error) {
+	values, err := params(args, c.n)
+	if err != nil {
+		return -1, 0, err
+	}
+	dt, err := cat.Table(c.table)
+	if err != nil {
+		return -1, 0, err
+	}
+	switch s := c.s.(type) {
+	case *insertStmt:
+		return runInsert(dt, s, values)
+	case *updateStmt:
+		affected, err = runUpdate(dt, s, values, collation(cat))
+	case *deleteStmt:
+		affected, err = runDelete(dt, s, values, collation(cat))
+	}
+	return -1, affected, err
+}
+
+// Select parses and runs SELECT statement.
+func Select(c Catalog, src string, args ...interface{}) (*Result, error) {
+	st, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	q, ok := st.(*Query)
+	if !ok {
+		return nil, errors.New("query: Select needs SELECT statement")
+	}
+	return q.Run(c, args...)
+}
+
+// Exec parses and runs INSERT, UPDATE or DELETE statement.
+func Exec(c Catalog, src string, args ...interface{}) (lastRow, affected int, err error) {
+	st, err := Parse(src)
+	if err != nil {
+		return -1, 0, err
+	}
+	cmd, ok := st.(*Command)
+	if !ok {
+		return -1, 0, errors.New("query: Exec needs INSERT, UPDATE or DELETE statement")
+	}
+	return cmd.Run(c, args...)
+}
+
+// Result is materialized result of SELECT.
+type Result struct {
+	Columns []Column
+	Rows    [][]interface{}
+}
+
+// Column describes result column. Type is CHARACTER, NUMERIC, FLOAT, LOGICAL
+// or DATE, type letter of other table fields or empty when unknown. Length
+// and Decimals are given for columns of table fields.
+type Column struct {
+	Name     string
+	Type     string
+	Length   int
+	Decimals int
+}
+
+// params converts parameters to values of expressions. Decimals are kept, so
+// they compare exactly with N, F and Y fields.
+func params(args []interface{}, n int) ([]interface{}, error) {
+	if len(args) < n {
+		return nil, fmt.Errorf("query: %d parameters given for %d", len(args), n)
+	}
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch x := arg.(type) {
+		case nil, int64, float64, string, bool, time.Time, dbf.Decimal:
+			values[i] = x
+			continue
+		case []byte:
+			values[i] = string(x)
+			continue
+		}
+		v := reflect.ValueOf(arg)
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			values[i] = v.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			values[i] = int64(v.Uint())
+		case reflect.Float32, reflect.Float64:
+			values[i] = v.Float()
+		case reflect.String:
+			values[i] = v.String()
+		case reflect.Bool:
+			values[i] = v.Bool()
+		default:
+			return nil, fmt.Errorf("query: unsupported parameter %d of type %T", i+1, arg)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,251 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tadvi/dbf"
+)
+
+func testTables(t *testing.T) Tables {
+	customer := dbf.New()
+	customer.AddIntField("id")
+	customer.AddTextField("name", 10)
+	customer.AddTextField("city", 10)
+	for _, m := range []map[string]interface{}{
+		{"id": 1, "name": "smith", "city": "Boston"},
+		{"id": 2, "name": "jones", "city": "Denver"},
+		{"id": 3, "name": "brown", "city": "Boston"},
+		{"id": 4, "name": "white", "city": nil},
+	} {
+		if _, err := customer.AppendMap(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	orders := dbf.New()
+	orders.AddIntField("custid")
+	orders.AddNumberField("amount", 10, 2)
+	orders.AddDateField("day")
+	for _, m := range []map[string]interface{}{
+		{"custid": 1, "amount": 10.5, "day": "2020-01-05"},
+		{"custid": 1, "amount": 20, "day": "2020-02-01"},
+		{"custid": 2, "amount": 5, "day": "2020-01-05"},
+		{"custid": 3, "amount": 100, "day": "2020-03-10"},
+		{"custid": 3, "amount": 1, "day": "2020-03-11"},
+		{"custid": 3, "amount": 2, "day": "2020-03-12"},
+		{"custid": 9, "amount": 7, "day": "2020-04-01"},
+	} {
+		if _, err := orders.AppendMap(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	orders.Delete(4) // deleted rows are left out
+	return Tables{"customer": customer, "Orders": orders}
+}
+
+// rowsOf formats result rows for comparison.
+func rowsOf(t *testing.T, res *Result, err error) []string {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := []string{}
+	for _, r := range res.Rows {
+		rows = append(rows, strings.TrimSuffix(fmt.Sprintln(r...), "\n"))
+	}
+	return rows
+}
+
+func expectRows(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected %q found %q", want, got)
+	}
+}
+
+func TestJoin(t *testing.T) {
+	tables := testTables(t)
+
+	res, err := Select(tables, "SELECT c.name, o.amount FROM customer c JOIN orders o ON o.custid = c.id ORDER BY c.name, amount DESC")
+	expectRows(t, rowsOf(t, res, err), "brown 100", "brown 2", "jones 5", "smith 20", "smith 10.5")
+	if res.Columns[0].Type != "CHARACTER" || res.Columns[1].Type != "NUMERIC" || res.Columns[1].Decimals != 2 {
+		t.Fatal("unexpected columns:", res.Columns)
+	}
+
+	res, err = Select(tables, "SELECT name, amount FROM customer LEFT JOIN orders ON custid = id AND amount > ? WHERE city = '' OR name = 'smith' ORDER BY 1, 2", 15)
+	expectRows(t, rowsOf(t, res, err), "smith 20", "white <nil>")
+
+	// the same with in-memory indexes on both tables
+	if err := tables["customer"].CreateIndex("name", "name"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tables["Orders"].CreateIndex("custid", "custid", "day"); err != nil {
+		t.Fatal(err)
+	}
+	res, err = Select(tables, "SELECT name, amount FROM customer LEFT JOIN orders ON custid = id AND amount > ? WHERE city = '' OR name = 'smith' ORDER BY 1, 2", 15)
+	expectRows(t, rowsOf(t, res, err), "smith 20", "white <nil>")
+	res, err = Select(tables, "SELECT o.day, c.city FROM orders o JOIN customer c ON c.id = o.custid WHERE c.name = ? AND o.day >= '2020-02-01'", "smith")
+	expectRows(t, rowsOf(t, res, err), fmt.Sprint(time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC), " Boston"))
+	res, err = Select(tables, "SELECT amount FROM orders WHERE custid = 3 AND day = ?", time.Date(2020, 3, 12, 0, 0, 0, 0, time.UTC))
+	expectRows(t, rowsOf(t, res, err), "2")
+
+	// index follows changes of the table
+	if _, _, err := Exec(tables, "UPDATE customer SET id = 5 WHERE name = 'jones'"); err != nil {
+		t.Fatal(err)
+	}
+	res, err = Select(tables, "SELECT name FROM customer WHERE id = 2 OR id = 5")
+	expectRows(t, rowsOf(t, res, err), "jones")
+	res, err = Select(tables, "SELECT COUNT(*) FROM orders JOIN customer ON id = custid WHERE name = 'jones'")
+	expectRows(t, rowsOf(t, res, err), "0")
+
+	for _, q := range []string{
+		"SELECT id FROM customer JOIN customer ON id = id",
+		"SELECT id FROM customer a JOIN customer b ON a.id = b.id",
+		"SELECT x.name FROM customer c",
+		"SELECT name FROM customer JOIN orders ON amount",
+		"SELECT name FROM customer LEFT orders ON custid = id",
+	} {
+		if _, err := Select(tables, q); err == nil {
+			t.Fatal("expected error for:", q)
+		}
+	}
+}
+
+func TestGroupBy(t *testing.T) {
+	tables := testTables(t)
+
+	res, err := Select(tables, `SELECT c.city, COUNT(*) AS n, SUM(o.amount) AS total, MAX(o.day) last
+		FROM customer c JOIN orders o ON o.custid = c.id
+		GROUP BY c.city HAVING SUM(o.amount) > ? ORDER BY total DESC`, 1)
+	expectRows(t, rowsOf(t, res, err),
+		fmt.Sprint("Boston 4 132.5 ", time.Date(2020, 3, 12, 0, 0, 0, 0, time.UTC)),
+		fmt.Sprint("Denver 1 5 ", time.Date(2020, 1, 5, 0, 0, 0, 0, time.UTC)))
+	if res.Columns[1].Name != "N" || res.Columns[3].Type != "DATE" {
+		t.Fatal("unexpected columns:", res.Columns)
+	}
+
+	// groups of LEFT JOIN count matching rows only
+	res, err = Select(tables, "SELECT name, COUNT(amount), AVG(amount) FROM customer LEFT JOIN orders ON custid = id GROUP BY name ORDER BY 2 DESC, name LIMIT 3 OFFSET 1")
+	expectRows(t, rowsOf(t, res, err), "smith 2 15.25", "jones 1 5", "white 0 <nil>")
+
+	res, err = Select(tables, "SELECT COUNT(*), SUM(amount) FROM orders WHERE amount > 1000")
+	expectRows(t, rowsOf(t, res, err), "0 <nil>")
+	res, err = Select(tables, "SELECT city FROM customer GROUP BY city HAVING COUNT(*) = 2")
+	expectRows(t, rowsOf(t, res, err), "Boston")
+
+	for _, q := range []string{
+		"SELECT name, COUNT(*) FROM customer GROUP BY city",
+		"SELECT city FROM customer GROUP BY city ORDER BY name",
+		"SELECT city FROM customer WHERE COUNT(*) > 1 GROUP BY city",
+		"SELECT city FROM customer GROUP BY COUNT(*)",
+		"SELECT SUM(COUNT(*)) FROM customer",
+	} {
+		if _, err := Select(tables, q); err == nil {
+			t.Fatal("expected error for:", q)
+		}
+	}
+}
+
+func TestCommand(t *testing.T) {
+	tables := testTables(t)
+	if err := tables["customer"].CreateIndex("id", "id"); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := Parse("INSERT INTO customer (id, name) VALUES ($1, $2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := st.(*Command)
+	if cmd.Table() != "CUSTOMER" || cmd.NumParams() != 2 {
+		t.Fatal("unexpected command:", cmd.Table(), cmd.NumParams())
+	}
+	last, n, err := cmd.Run(tables, 7, []byte("green"))
+	if err != nil || last != 4 || n != 1 {
+		t.Fatal("unexpected insert:", last, n, err)
+	}
+	if _, _, err := cmd.Run(tables, 8); err == nil {
+		t.Fatal("expected missing parameter error")
+	}
+
+	if _, n, err := Exec(tables, "DELETE FROM customer WHERE id = ?", uint8(7)); err != nil || n != 1 {
+		t.Fatal("unexpected delete:", n, err)
+	}
+	res, err := Select(tables, "SELECT COUNT(*) FROM customer WHERE id = 7")
+	expectRows(t, rowsOf(t, res, err), "0")
+
+	if _, _, err := Exec(tables, "SELECT * FROM customer"); err == nil {
+		t.Fatal("expected error for SELECT in Exec")
+	}
+	if _, err := Select(tables, "SELECT * FROM customer WHERE id = ?", struct{}{}); err == nil {
+		t.Fatal("expected unsupported parameter error")
+	}
+}
+
+func TestCollate(t *testing.T) {
+	people := dbf.New()
+	people.AddTextField("name", 10)
+	for _, name := range []string{"Šarūnas", "saulius", "Zuikis", "žemaitis", "Ygis", "ilgas", "ygis"} {
+		if _, err := people.AppendMap(map[string]interface{}{"name": name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := people.CreateIndex("name", "name"); err != nil {
+		t.Fatal(err)
+	}
+	tables := Tables{"people": people}
+
+	res, err := Select(tables, "SELECT name FROM people ORDER BY name")
+	expectRows(t, rowsOf(t, res, err), "Ygis", "Zuikis", "ilgas", "saulius", "ygis", "Šarūnas", "žemaitis")
+	lt := Collate(tables, dbf.UnicodeCollation("lt"))
+	res, err = Select(lt, "SELECT name FROM people ORDER BY name")
+	expectRows(t, rowsOf(t, res, err), "ygis", "Ygis", "ilgas", "saulius", "Šarūnas", "Zuikis", "žemaitis")
+	res, err = Select(lt, "SELECT MIN(name), MAX(name) FROM people WHERE name < 'š'")
+	expectRows(t, rowsOf(t, res, err), "ygis saulius")
+
+	// binary index is not used for case insensitive equality
+	nocase := Collate(tables, dbf.CaseInsensitive)
+	res, err = Select(nocase, "SELECT COUNT(*) FROM people WHERE name = ?", "YGIS")
+	expectRows(t, rowsOf(t, res, err), "2")
+	if err := people.CreateCollatedIndex("nocase", dbf.CaseInsensitive, "name"); err != nil {
+		t.Fatal(err)
+	}
+	res, err = Select(nocase, "SELECT COUNT(*) FROM people WHERE name = ?", "YGIS")
+	expectRows(t, rowsOf(t, res, err), "2")
+	res, err = Select(nocase, "SELECT COUNT(*) FROM people GROUP BY name HAVING COUNT(*) > 1")
+	expectRows(t, rowsOf(t, res, err), "2")
+
+	if _, n, err := Exec(nocase, "DELETE FROM people WHERE name = 'YGIS'"); err != nil || n != 2 {
+		t.Fatal("unexpected delete:", n, err)
+	}
+}
+
+func TestDecimalParams(t *testing.T) {
+	db := dbf.New()
+	db.AddTextField("name", 4)
+	db.AddNumberField("big", 20, 0)
+	db.AddCurrencyField("price")
+	for _, m := range []map[string]interface{}{
+		{"name": "a", "big": "9007199254740992", "price": "922337203685477.5806"},
+		{"name": "b", "big": "9007199254740993", "price": "922337203685477.5807"},
+	} {
+		if _, err := db.AppendMap(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tables := Tables{"t": db}
+	big, _ := dbf.ParseDecimal("9007199254740993")
+	price, _ := dbf.ParseDecimal("922337203685477.5807")
+
+	res, err := Select(tables, "SELECT name FROM t WHERE big = ?", big)
+	expectRows(t, rowsOf(t, res, err), "b")
+	res, err = Select(tables, "SELECT name FROM t WHERE ? > big", big)
+	expectRows(t, rowsOf(t, res, err), "a")
+	res, err = Select(tables, "SELECT name FROM t WHERE price IN (?)", price)
+	expectRows(t, rowsOf(t, res, err), "b")
+	res, err = Select(tables, "SELECT name FROM t WHERE price BETWEEN 0 AND ?", price.Sub(dbf.NewDecimal(1, 4)))
+	expectRows(t, rowsOf(t, res, err), "a")
+}
@@ -0,0 +1,255 @@
+package dbf
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RowMap returns row as map of field names to values typed by field type:
+// string for C, int64 for N without decimals, float64 for other N and F,
+// bool for L and time.Time for D. Blank numbers, dates and logicals, '?'
+// logicals and VFP null values are nil. Values of other types are strings.
+func (dt *DbfTable) RowMap(row int) map[string]interface{} {
+	m := make(map[string]interface{}, len(dt.fields))
+	for i := range dt.fields {
+		field := &dt.fields[i]
+		if field.Type == nullFlagsType {
+			continue
+		}
+		m[field.Name] = dt.Value(row, i)
+	}
+	return m
+}
+
+// Value returns typed value of the field as RowMap does.
+func (dt *DbfTable) Value(row, fieldIndex int) interface{} {
+	if dt.IsNull(row, fieldIndex) {
+		return nil
+	}
+	return typedValue(&dt.fields[fieldIndex], dt.FieldValue(row, fieldIndex))
+}
+
+// typedValue converts table value to Go value of the field type.
+func typedValue(field *DbfField, value string) interface{} {
+	switch field.Type {
+	case "N", "F", "Y":
+		if value == "" {
+			return nil
+		}
+		if field.Type == "N" && field.Decimals == 0 {
+			if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+				return n
+			}
+		}
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	case "L":
+		switch value {
+		case "T", "t", "Y", "y":
+			return true
+		case "F", "f", "N", "n":
+			return false
+		}
+		return nil
+	case "D":
+		if t, err := time.Parse("20060102", value); err == nil {
+			return t
+		}
+		return nil
+	}
+	return value
+}
+
+// WriteMap sets fields of the row from map of field names, matched ignoring
+// case, to values. Values are converted to field type: numbers and numeric
+// text for N and F, bool and T, F, Y, N text for L, time.Time and YYYYMMDD,
+// YYYY-MM-DD or RFC 3339 text for D. Nil values store null. Nothing is written when a
+// field does not exist, a value can not be converted or does not fit.
+func (dt *DbfTable) WriteMap(row int, m map[string]interface{}) error {
+	values, err := dt.mapValues(m)
+	if err != nil {
+		return err
+	}
+	dt.writeValues(row, values)
+	return nil
+}
+
+// AppendMap adds record with fields set from the map as WriteMap does. Record
+// is not added when map can not be written.
+func (dt *DbfTable) AppendMap(m map[string]interface{}) (int, error) {
+	values, err := dt.mapValues(m)
+	if err != nil {
+		return -1, err
+	}
+	row := dt.AddRecord()
+	dt.writeValues(row, values)
+	return row, nil
+}
+
+// mapValue is converted map value of a field.
+type mapValue struct {
+	field int
+	value string
+	null  bool
+}
+
+// mapValues converts map values ordered by field.
+func (dt *DbfTable) mapValues(m map[string]interface{}) ([]mapValue, error) {
+	values := make([]mapValue, 0, len(m))
+	for name, v := range m {
+		i := dt.fieldIndex(name)
+		if i < 0 {
+			return nil, fmt.Errorf("dbf: field '%s' does not exist", name)
+		}
+		if v == nil {
+			values = append(values, mapValue{field: i, null: true})
+			continue
+		}
+		s, err := dt.convertValue(&dt.fields[i], v)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, mapValue{field: i, value: s})
+	}
+	sort.Slice(values, func(a, b int) bool { return values[a].field < values[b].field })
+	return values, nil
+}
+
+// writeValues stores converted values, nulls are set as Write does for nil
+// struct fields.
+func (dt *DbfTable) writeValues(row int, values []mapValue) {
+	for _, v := range values {
+		if !v.null {
+			dt.SetFieldValue(row, v.field, v.value)
+			continue
+		}
+		if dt.nullBit(v.field) >= 0 {
+			dt.SetNull(row, v.field)
+		} else if dt.fields[v.field].Type == "L" {
+			dt.SetFieldValue(row, v.field, "?")
+		} else {
+			dt.SetFieldValue(row, v.field, "")
+		}
+	}
+}
+
+// decimalText returns table value of decimal rounded to decimals of the field,
+// error when it does not fit the field.
+func decimalText(field *DbfField, d Decimal) (string, error) {
+	if field.Type == "Y" {
+		d = d.Round(currencyScale)
+		if !d.int().IsInt64() {
+			return "", fmt.Errorf("dbf: value %s does not fit currency field '%s'", d, field.Name)
+		}
+		return d.String(), nil
+	}
+	if field.Type == "N" || field.Type == "F" {
+		d = d.Round(int(field.Decimals))
+	}
+	s := d.String()
+	if len(s) > int(field.Length) {
+		return "", fmt.Errorf("dbf: value %s does not fit field '%s' of length %d", s, field.Name, field.Length)
+	}
+	return s, nil
+}
+
+// convertValue converts Go value to table value of the field.
+func (dt *DbfTable) convertValue(field *DbfField, v interface{}) (string, error) {
+	fail := func() (string, error) {
+		return "", fmt.Errorf("dbf: field '%s' of type %s can not store %T value %v", field.Name, field.Type, v, v)
+	}
+	if n, ok := v.(json.Number); ok {
+		v = string(n) // decoded with UseNumber
+	}
+	rv := reflect.ValueOf(v)
+	var s string
+	switch field.Type {
+	case "N", "F", "Y":
+		var d Decimal
+		switch x := v.(type) {
+		case Decimal:
+			d = x
+		case string:
+			// numeric text
+			var err error
+			if d, err = ParseDecimal(x); err != nil {
+				return fail()
+			}
+		default:
+			switch rv.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				d = NewDecimal(rv.Int(), 0)
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				d = newDecimal(new(big.Int).SetUint64(rv.Uint()), 0)
+			case reflect.Float32, reflect.Float64:
+				if math.IsNaN(rv.Float()) || math.IsInf(rv.Float(), 0) {
+					return fail()
+				}
+				d = DecimalFromFloat(rv.Float())
+			default:
+				return fail()
+			}
+		}
+		return decimalText(field, d)
+	case "L":
+		switch rv.Kind() {
+		case reflect.Bool:
+			s = "F"
+			if rv.Bool() {
+				s = "T"
+			}
+		case reflect.String:
+			s = strings.ToUpper(strings.TrimSpace(rv.String()))
+			if s != "" && !strings.Contains("TFYN?", s) || len(s) > 1 {
+				return fail()
+			}
+		default:
+			return fail()
+		}
+	case "D":
+		switch t := v.(type) {
+		case time.Time:
+			if !t.IsZero() {
+				s = t.Format("20060102")
+			}
+		case string:
+			s = strings.TrimSpace(t)
+			if tt, err := time.Parse(time.RFC3339, s); err == nil {
+				s = tt.Format("20060102") // time.Time encoded by encoding/json
+			} else if len(s) == 10 {
+				s = strings.ReplaceAll(s, "-", "")
+			}
+			if _, err := time.Parse("20060102", s); s != "" && err != nil {
+				return fail()
+			}
+		default:
+			return fail()
+		}
+	default:
+		switch t := v.(type) {
+		case string:
+			s = t
+		case []byte:
+			s = string(t)
+		case fmt.Stringer:
+			s = t.String()
+		default:
+			if rv.Kind() < reflect.Int || rv.Kind() > reflect.Float64 {
+				return fail()
+			}
+			s = fmt.Sprint(v)
+		}
+	}
+	if len(s) > int(field.Length) {
+		return "", fmt.Errorf("dbf: value %s does not fit field '%s' of length %d", s, field.Name, field.Length)
+	}
+	return s, nil
+}
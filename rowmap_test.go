@@ -0,0 +1,88 @@
+package dbf
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRowMap(t *testing.T) {
+	db := New()
+	db.AddTextField("name", 10)
+	db.AddIntField("count")
+	db.AddNumberField("amount", 10, 2)
+	db.AddBoolField("active")
+	db.AddDateField("born")
+
+	row, err := db.AppendMap(map[string]interface{}{
+		"name": "acme", "COUNT": 42, "amount": 12.345, "active": true, "born": "1980-02-15",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := db.FieldValue(row, 2); v != "12.35" {
+		t.Fatal("expected 12.35 found:", v)
+	}
+
+	m := db.RowMap(row)
+	born := time.Date(1980, 2, 15, 0, 0, 0, 0, time.UTC)
+	if m["NAME"] != "acme" || m["COUNT"] != int64(42) || m["AMOUNT"] != 12.35 || m["ACTIVE"] != true || m["BORN"] != born {
+		t.Fatal("unexpected row map:", m)
+	}
+
+	// values decoded from JSON write back unchanged
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = map[string]interface{}{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.WriteMap(row, m); err != nil {
+		t.Fatal(err)
+	}
+	if got := db.Row(row); got[1] != "42" || got[2] != "12.35" || got[4] != "19800215" {
+		t.Fatal("unexpected row after JSON round trip:", got)
+	}
+
+	// json.Number keeps exact numbers
+	d := json.NewDecoder(strings.NewReader(`{"count": 9007199254740993, "amount": 12.5}`))
+	d.UseNumber()
+	m = map[string]interface{}{}
+	if err := d.Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.WriteMap(row, m); err != nil {
+		t.Fatal(err)
+	}
+	if got := db.Row(row); got[1] != "9007199254740993" || got[2] != "12.50" {
+		t.Fatal("unexpected row after json.Number values:", got)
+	}
+
+	if err := db.WriteMap(row, map[string]interface{}{"active": nil, "count": nil}); err != nil {
+		t.Fatal(err)
+	}
+	if m := db.RowMap(row); m["ACTIVE"] != nil || m["COUNT"] != nil {
+		t.Fatal("expected nil values found:", m)
+	}
+
+	bad := []map[string]interface{}{
+		{"missing": 1},
+		{"count": "abc"},
+		{"active": 1},
+		{"born": "15/02/1980"},
+		{"name": "longer than ten"},
+		{"amount": 123456789.5},
+		{"name": "ok", "count": true},
+	}
+	for _, m := range bad {
+		if _, err := db.AppendMap(m); err == nil {
+			t.Fatal("expected error for:", m)
+		}
+	}
+	if db.NumRecords() != 1 || db.FieldValue(0, 0) != "acme" {
+		t.Fatal("failed maps should not change the table")
+	}
+}
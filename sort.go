@@ -0,0 +1,372 @@
+package dbf
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// SortKey is field of sort order used by SortTo and SortFile. C fields are
+// ordered by collation, N, F, Y, D and L fields by value. Blank cells come
+// first in ascending order.
+type SortKey struct {
+	Field string
+	Desc  bool
+	// Collation of C field, nil is Binary
+	Collation Collation
+}
+
+// defaultSortMemory is memory used by SortFile for records sorted at once.
+const defaultSortMemory = 64 << 20
+
+// sortFanIn is the most runs SortFile merges at once, more runs are merged in
+// several passes so that few files are open.
+var sortFanIn = 64
+
+// sorter builds sort keys of records.
+type sorter struct {
+	keys    []SortKey
+	fields  []int
+	offsets []int // offset of the field from the start of the record
+}
+
+func (dt *DbfTable) sorter(keys []SortKey) (*sorter, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("dbf: sort needs at least one key")
+	}
+	s := &sorter{keys: keys}
+	for _, key := range keys {
+		i, ok := dt.fieldMap[strings.ToUpper(key.Field)]
+		if !ok {
+			return nil, errors.New("dbf: sort field '" + key.Field + "' does not exist")
+		}
+		s.fields = append(s.fields, i)
+		s.offsets = append(s.offsets, dt.fieldOffset(i))
+	}
+	return s, nil
+}
+
+// key appends sort key of record given as stored, with deleted flag first.
+// Keys of records compare byte by byte in sort order.
+func (s *sorter) key(dt *DbfTable, dst, record []byte) []byte {
+	for k, i := range s.fields {
+		start := len(dst)
+		field := &dt.fields[i]
+		value := cellText(field, record[s.offsets[k]:s.offsets[k]+int(field.Length)])
+		if field.Type == "C" {
+			c := s.keys[k].Collation
+			if c == nil {
+				c = Binary
+			}
+			dst = appendCollated(dst, c, value, false)
+		} else {
+			dst = dt.appendTypedKey(dst, i, value, false)
+		}
+		if s.keys[k].Desc {
+			for j := start; j < len(dst); j++ {
+				dst[j] ^= 0xFF
+			}
+		}
+	}
+	return dst
+}
+
+// sortEntry is record with its sort key.
+type sortEntry struct {
+	key    []byte
+	record []byte
+}
+
+func sortEntries(entries []sortEntry) {
+	sort.SliceStable(entries, func(a, b int) bool { return bytes.Compare(entries[a].key, entries[b].key) < 0 })
+}
+
+// createSorted creates file for sorted records with header of the table,
+// without production index flag.
+func createSorted(dst string, header []byte) (*os.File, *Writer, error) {
+	header = append([]byte(nil), header...)
+	header[mdxProductionFlag] = 0
+	schema, err := parseHeader(header)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return nil, nil, err
+	}
+	w, err := NewWriter(f, schema)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, w, nil
+}
+
+// SortTo writes not deleted rows sorted by keys into new table file dst, as
+// xBase SORT TO does. Rows with equal keys keep their order. Memo files and
+// indexes are not copied. SortFile sorts files too large to be loaded.
+//
+//	err := dt.SortTo("sorted.dbf", dbf.SortKey{Field: "NAME", Collation: dbf.CaseInsensitive},
+//		dbf.SortKey{Field: "AMOUNT", Desc: true})
+func (dt *DbfTable) SortTo(dst string, keys ...SortKey) error {
+	s, err := dt.sorter(keys)
+	if err != nil {
+		return err
+	}
+	entries := []sortEntry{}
+	for row := 0; row < dt.NumRecords(); row++ {
+		if dt.IsDeleted(row) {
+			continue
+		}
+		offset := dt.getRowOffset(row)
+		record := dt.dataStore[offset : offset+int(dt.recordLength)]
+		entries = append(entries, sortEntry{key: s.key(dt, nil, record), record: record})
+	}
+	sortEntries(entries)
+
+	f, w, err := createSorted(dst, dt.dataStore[:dt.headerSize])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, e := range entries {
+		if err := w.writeRecord(e.record); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// SortFile sorts not deleted records of table file src into new file dst as
+// SortTo does, without loading src into memory. Records are sorted in runs
+// taking about memory bytes, 64 MB when memory is not positive. Runs are
+// written to temporary files and merged, at most 64 at once.
+func SortFile(src, dst string, memory int, keys ...SortKey) error {
+	if memory <= 0 {
+		memory = defaultSortMemory
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r := bufio.NewReader(in)
+	schema, err := readHeader(r)
+	if err != nil {
+		return err
+	}
+	s, err := schema.sorter(keys)
+	if err != nil {
+		return err
+	}
+
+	temps := []string{} // every run file, removed at the end
+	defer func() {
+		for _, name := range temps {
+			os.Remove(name)
+		}
+	}()
+	runs := []string{}
+	chunk, size := []sortEntry{}, 0
+	for i := 0; i < int(schema.numberOfRecords); i++ {
+		record := make([]byte, schema.recordLength)
+		if _, err := io.ReadFull(r, record); err != nil {
+			return err
+		}
+		if record[0] == '*' {
+			continue // deleted
+		}
+		e := sortEntry{key: s.key(schema, nil, record), record: record}
+		chunk = append(chunk, e)
+		size += len(e.key) + len(e.record) + 64
+		if size >= memory {
+			sortEntries(chunk)
+			run, err := writeRun(emitEntries(chunk))
+			if run != "" {
+				temps, runs = append(temps, run), append(runs, run)
+			}
+			if err != nil {
+				return err
+			}
+			chunk, size = chunk[:0:0], 0
+		}
+	}
+	sortEntries(chunk)
+
+	f, w, err := createSorted(dst, schema.dataStore)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	write := func(e sortEntry) error { return w.writeRecord(e.record) }
+	if len(runs) == 0 {
+		for _, e := range chunk {
+			if err := write(e); err != nil {
+				return err
+			}
+		}
+	} else {
+		if len(chunk) > 0 {
+			run, err := writeRun(emitEntries(chunk))
+			if run != "" {
+				temps, runs = append(temps, run), append(runs, run)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		reclen := int(schema.recordLength)
+		for len(runs) > sortFanIn {
+			merged := []string{}
+			for i := 0; i < len(runs); i += sortFanIn {
+				group := runs[i:]
+				if len(group) > sortFanIn {
+					group = group[:sortFanIn]
+				}
+				run, err := writeRun(func(emit func(sortEntry) error) error {
+					return mergeRuns(group, reclen, emit)
+				})
+				if run != "" {
+					temps, merged = append(temps, run), append(merged, run)
+				}
+				if err != nil {
+					return err
+				}
+				for _, name := range group {
+					os.Remove(name)
+				}
+			}
+			runs = merged
+		}
+		if err := mergeRuns(runs, reclen, write); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// writeRun writes sorted entries given by fill into temporary file as key
+// length, key and record, and returns name of the file.
+func writeRun(fill func(emit func(sortEntry) error) error) (string, error) {
+	f, err := os.CreateTemp("", "dbfsort-*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	bw := bufio.NewWriter(f)
+	var n []byte
+	err = fill(func(e sortEntry) error {
+		n = binary.AppendUvarint(n[:0], uint64(len(e.key)))
+		bw.Write(n)
+		bw.Write(e.key)
+		_, err := bw.Write(e.record)
+		return err
+	})
+	if err != nil {
+		return f.Name(), err
+	}
+	if err := bw.Flush(); err != nil {
+		return f.Name(), err
+	}
+	return f.Name(), f.Close()
+}
+
+// emitEntries returns fill of writeRun emitting entries.
+func emitEntries(entries []sortEntry) func(emit func(sortEntry) error) error {
+	return func(emit func(sortEntry) error) error {
+		for _, e := range entries {
+			if err := emit(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// runReader reads entries of a run.
+type runReader struct {
+	r      *bufio.Reader
+	n      int // run number, earlier runs win ties
+	head   sortEntry
+	reclen int
+}
+
+// next reads the next entry, io.EOF at the end of the run.
+func (rr *runReader) next() error {
+	n, err := binary.ReadUvarint(rr.r)
+	if err != nil {
+		return err
+	}
+	rr.head.key = make([]byte, n)
+	if _, err := io.ReadFull(rr.r, rr.head.key); err != nil {
+		return err
+	}
+	rr.head.record = make([]byte, rr.reclen)
+	_, err = io.ReadFull(rr.r, rr.head.record)
+	return err
+}
+
+// runHeap orders runs by their head entries.
+type runHeap []*runReader
+
+func (h runHeap) Len() int { return len(h) }
+func (h runHeap) Less(a, b int) bool {
+	if c := bytes.Compare(h[a].head.key, h[b].head.key); c != 0 {
+		return c < 0
+	}
+	return h[a].n < h[b].n
+}
+func (h runHeap) Swap(a, b int)       { h[a], h[b] = h[b], h[a] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*runReader)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// mergeRuns emits entries of sorted run files in order.
+func mergeRuns(runs []string, reclen int, emit func(sortEntry) error) error {
+	h := runHeap{}
+	for n, name := range runs {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		rr := &runReader{r: bufio.NewReader(f), n: n, reclen: reclen}
+		if err := rr.next(); err == nil {
+			h = append(h, rr)
+		} else if err != io.EOF {
+			return err
+		}
+	}
+	heap.Init(&h)
+	for len(h) > 0 {
+		rr := h[0]
+		if err := emit(rr.head); err != nil {
+			return err
+		}
+		switch err := rr.next(); err {
+		case nil:
+			heap.Fix(&h, 0)
+		case io.EOF:
+			heap.Pop(&h)
+		default:
+			return err
+		}
+	}
+	return nil
+}
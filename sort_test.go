@@ -0,0 +1,117 @@
+package dbf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sortedRows returns rows of table file as fields joined with '|'.
+func sortedRows(t *testing.T, path string) []string {
+	t.Helper()
+	dt, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := []string{}
+	for row := 0; row < dt.NumRecords(); row++ {
+		values := []string{}
+		for i := range dt.Fields() {
+			values = append(values, dt.FieldValue(row, i))
+		}
+		rows = append(rows, strings.Join(values, "|"))
+	}
+	return rows
+}
+
+func TestSortTo(t *testing.T) {
+	db := New()
+	db.AddTextField("name", 8)
+	db.AddNumberField("amount", 8, 2)
+	db.AddDateField("day")
+	for _, m := range []map[string]interface{}{
+		{"name": "bob", "amount": 9, "day": "2020-03-01"},
+		{"name": "Alice", "amount": 10, "day": "2020-01-15"},
+		{"name": "alice", "amount": -2.5, "day": "2021-06-30"},
+		{"name": "Bob", "amount": 9, "day": "2019-12-31"},
+		{"name": "carl", "amount": 100, "day": "2022-01-01"},
+		{"name": "Al", "amount": nil, "day": nil},
+	} {
+		if _, err := db.AppendMap(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Delete(4)
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.dbf")
+	if err := db.SaveFile(src); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(name string, expected []string, keys ...SortKey) {
+		t.Helper()
+		dst := filepath.Join(dir, name+".dbf")
+		if err := db.SortTo(dst, keys...); err != nil {
+			t.Fatal(err)
+		}
+		if rows := sortedRows(t, dst); strings.Join(rows, "\n") != strings.Join(expected, "\n") {
+			t.Fatalf("%s: unexpected order:\n%s", name, strings.Join(rows, "\n"))
+		}
+		// one record per run forces merge of many runs, in several passes
+		// when two runs are merged at once
+		defer func(fanIn int) { sortFanIn = fanIn }(sortFanIn)
+		for _, memory := range []int{1, 0} {
+			for _, sortFanIn = range []int{64, 2} {
+				ext := filepath.Join(dir, name+"-ext.dbf")
+				if err := SortFile(src, ext, memory, keys...); err != nil {
+					t.Fatal(err)
+				}
+				sorted, _ := os.ReadFile(dst)
+				merged, _ := os.ReadFile(ext)
+				if string(sorted) != string(merged) {
+					t.Fatalf("%s: SortFile with memory %d and fan-in %d differs from SortTo", name, memory, sortFanIn)
+				}
+			}
+		}
+	}
+
+	check("binary", []string{
+		"Al||",
+		"Alice|10.00|20200115",
+		"Bob|9.00|20191231",
+		"alice|-2.50|20210630",
+		"bob|9.00|20200301",
+	}, SortKey{Field: "name"})
+
+	check("nocase", []string{
+		"Al||",
+		"Alice|10.00|20200115",
+		"alice|-2.50|20210630",
+		"bob|9.00|20200301",
+		"Bob|9.00|20191231",
+	}, SortKey{Field: "name", Collation: CaseInsensitive})
+
+	check("amount", []string{
+		"Alice|10.00|20200115",
+		"Bob|9.00|20191231",
+		"bob|9.00|20200301",
+		"alice|-2.50|20210630",
+		"Al||",
+	}, SortKey{Field: "amount", Desc: true}, SortKey{Field: "day"})
+
+	check("namedesc", []string{
+		"Bob|9.00|20191231",
+		"bob|9.00|20200301",
+		"Alice|10.00|20200115",
+		"alice|-2.50|20210630",
+		"Al||",
+	}, SortKey{Field: "NAME", Desc: true, Collation: CaseInsensitive}, SortKey{Field: "day"})
+
+	if err := db.SortTo(filepath.Join(dir, "x.dbf")); err == nil {
+		t.Fatal("expected error without keys")
+	}
+	if err := SortFile(src, filepath.Join(dir, "x.dbf"), 0, SortKey{Field: "missing"}); err == nil {
+		t.Fatal("expected error for missing field")
+	}
+}
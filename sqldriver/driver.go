@@ -0,0 +1,421 @@
+// Package sqldriver registers database/sql driver "dbf" for directories of
+// .dbf files. DSN is the directory, every file in it is a table named after
+// the file without extension:
+//
+//	db, err := sql.Open("dbf", "/data/accounts")
+//	rows, err := db.Query("SELECT NAME, AMOUNT FROM customer WHERE AMOUNT > ? ORDER BY NAME", 100)
+//
+// Statements are executed by package dbf/query: SELECT with JOIN, WHERE,
+// GROUP BY, HAVING, ORDER BY, LIMIT and OFFSET, INSERT, UPDATE and DELETE.
+// Parameters are given as ? or $1. Columns are typed by field type: C as
+// string, N as int64 or float64, L as bool and D as time.Time, blank cells are
+// NULL.
+//
+// Tables are loaded once per connection and reloaded when their file changes.
+// Outside of transactions every changed table is saved after the statement,
+// statement that fails leaves the file unchanged. Transactions save changed
+// tables on commit and drop them on rollback. Transaction with failed
+// statement can only be rolled back, its commit drops the changes too.
+package sqldriver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/tadvi/dbf"
+	"github.com/tadvi/dbf/query"
+)
+
+func init() {
+	sql.Register("dbf", &Driver{})
+}
+
+// Driver opens connections to directories of .dbf files.
+type Driver struct{}
+
+// Open returns connection to directory given by DSN.
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	fi, err := os.Stat(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, errors.New("sqldriver: " + dsn + " is not a directory")
+	}
+	return &conn{dir: dsn, tables: map[string]*table{}}, nil
+}
+
+// table is loaded .dbf file.
+type table struct {
+	dt    *dbf.DbfTable
+	path  string
+	mod   time.Time
+	size  int64
+	dirty bool // changed and not saved yet
+}
+
+type conn struct {
+	dir    string
+	tables map[string]*table // by upper case name
+	inTx   bool
+	// txErr is error of statement failed in transaction, rows it changed
+	// before the error can not be committed
+	txErr error
+}
+
+// table returns loaded table, it is loaded again when file has changed since.
+func (c *conn) table(name string) (*table, error) {
+	if t := c.tables[name]; t != nil {
+		if t.dirty {
+			return t, nil
+		}
+		fi, err := os.Stat(t.path)
+		if err == nil && fi.ModTime().Equal(t.mod) && fi.Size() == t.size {
+			return t, nil
+		}
+	}
+
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, err
+	}
+	path := ""
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if !entry.IsDir() && strings.EqualFold(ext, ".dbf") && strings.EqualFold(strings.TrimSuffix(entry.Name(), ext), name) {
+			path = filepath.Join(c.dir, entry.Name())
+			break
+		}
+	}
+	if path == "" {
+		return nil, errors.New("sqldriver: table " + name + " does not exist")
+	}
+	dt, err := dbf.LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	t := &table{dt: dt, path: path}
+	if err := t.stat(); err != nil {
+		return nil, err
+	}
+	c.tables[name] = t
+	return t, nil
+}
+
+// Table returns loaded table, so that connection is catalog of queries.
+func (c *conn) Table(name string) (*dbf.DbfTable, error) {
+	t, err := c.table(strings.ToUpper(name))
+	if err != nil {
+		return nil, err
+	}
+	return t.dt, nil
+}
+
+// stat remembers file time and size.
+func (t *table) stat() error {
+	fi, err := os.Stat(t.path)
+	if err != nil {
+		return err
+	}
+	t.mod, t.size = fi.ModTime(), fi.Size()
+	return nil
+}
+
+// changed saves table changed by statement, outside of transaction. Table is
+// dropped when statement failed, so it is loaded again unchanged. Failed
+// statement fails its transaction.
+func (c *conn) changed(name string, t *table, err error) error {
+	if c.inTx {
+		t.dirty = true
+		if err != nil && c.txErr == nil {
+			c.txErr = err
+		}
+		return err
+	}
+	if err != nil {
+		delete(c.tables, name)
+		return err
+	}
+	return c.save(t)
+}
+
+func (c *conn) save(t *table) error {
+	if err := t.dt.SaveFile(t.path); err != nil {
+		return err
+	}
+	t.dirty = false
+	return t.stat()
+}
+
+func (c *conn) Prepare(src string) (driver.Stmt, error) {
+	s, err := query.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{c: c, s: s}, nil
+}
+
+func (c *conn) Close() error {
+	c.tables = nil
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx starts transaction, changed tables are saved on commit.
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if c.inTx {
+		return nil, errors.New("sqldriver: transaction already started")
+	}
+	c.inTx, c.txErr = true, nil
+	return &tx{c: c}, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	st, err := c.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return st.(*stmt).ExecContext(ctx, args)
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	st, err := c.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return st.(*stmt).QueryContext(ctx, args)
+}
+
+type tx struct {
+	c *conn
+}
+
+// Commit saves tables changed in transaction. Transaction with failed
+// statement is rolled back and its error returned.
+func (t *tx) Commit() error {
+	if err := t.c.txErr; err != nil {
+		t.Rollback()
+		return errors.New("sqldriver: transaction rolled back after failed statement: " + err.Error())
+	}
+	t.c.inTx = false
+	var err error
+	for _, table := range t.c.tables {
+		if table.dirty {
+			if e := t.c.save(table); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// Rollback drops tables changed in transaction.
+func (t *tx) Rollback() error {
+	t.c.inTx, t.c.txErr = false, nil
+	for name, table := range t.c.tables {
+		if table.dirty {
+			delete(t.c.tables, name)
+		}
+	}
+	return nil
+}
+
+type stmt struct {
+	c *conn
+	s query.Statement
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return s.s.NumParams()
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.exec(args)
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.query(args)
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	values, err := ordinal(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.exec(values)
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	values, err := ordinal(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.query(values)
+}
+
+// ordinal returns values of positional arguments.
+func ordinal(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for _, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("sqldriver: named parameters are not supported")
+		}
+		if arg.Ordinal < 1 || arg.Ordinal > len(args) {
+			return nil, errors.New("sqldriver: invalid parameter position")
+		}
+		values[arg.Ordinal-1] = arg.Value
+	}
+	return values, nil
+}
+
+// interfaces returns arguments of query package.
+func interfaces(args []driver.Value) []interface{} {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg
+	}
+	return values
+}
+
+func (s *stmt) exec(args []driver.Value) (driver.Result, error) {
+	cmd, ok := s.s.(*query.Command)
+	if !ok {
+		return nil, errors.New("sqldriver: Exec needs INSERT, UPDATE or DELETE")
+	}
+	if s.c.inTx && s.c.txErr != nil {
+		return nil, errors.New("sqldriver: transaction has failed statement, it must be rolled back")
+	}
+	name := strings.ToUpper(cmd.Table())
+	t, err := s.c.table(name)
+	if err != nil {
+		return nil, err
+	}
+	last, affected, err := cmd.Run(s.c, interfaces(args)...)
+	r := &result{lastID: int64(last) + 1, affected: int64(affected)}
+	if affected == 0 && err == nil {
+		return r, nil
+	}
+	if err := s.c.changed(name, t, err); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *stmt) query(args []driver.Value) (driver.Rows, error) {
+	q, ok := s.s.(*query.Query)
+	if !ok {
+		return nil, errors.New("sqldriver: Query needs SELECT")
+	}
+	res, err := q.Run(s.c, interfaces(args)...)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{res: res}, nil
+}
+
+// result of INSERT, UPDATE and DELETE. Last insert id is one based record
+// number, as xBase RECNO(), zero when nothing was inserted.
+type result struct {
+	lastID   int64
+	affected int64
+}
+
+func (r *result) LastInsertId() (int64, error) {
+	return r.lastID, nil
+}
+
+func (r *result) RowsAffected() (int64, error) {
+	return r.affected, nil
+}
+
+type rows struct {
+	res *query.Result
+	pos int
+}
+
+func (r *rows) Columns() []string {
+	cols := make([]string, len(r.res.Columns))
+	for i, c := range r.res.Columns {
+		cols[i] = c.Name
+	}
+	return cols
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.res.Rows) {
+		return io.EOF
+	}
+	for i, v := range r.res.Rows[r.pos] {
+		dest[i] = v
+	}
+	r.pos++
+	return nil
+}
+
+// ColumnTypeDatabaseTypeName returns CHARACTER, NUMERIC, FLOAT, LOGICAL or
+// DATE, type letter of other table fields or empty string when unknown.
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	return r.res.Columns[index].Type
+}
+
+func (r *rows) ColumnTypeLength(index int) (int64, bool) {
+	c := r.res.Columns[index]
+	if c.Type == "CHARACTER" && c.Length > 0 {
+		return int64(c.Length), true
+	}
+	return 0, false
+}
+
+func (r *rows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	c := r.res.Columns[index]
+	if (c.Type == "NUMERIC" || c.Type == "FLOAT") && c.Length > 0 {
+		return int64(c.Length), int64(c.Decimals), true
+	}
+	return 0, 0, false
+}
+
+// ColumnTypeScanType returns Go type of column values.
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	c := r.res.Columns[index]
+	switch c.Type {
+	case "CHARACTER":
+		return reflect.TypeOf("")
+	case "NUMERIC":
+		if c.Length > 0 && c.Decimals == 0 {
+			return reflect.TypeOf(int64(0))
+		}
+		return reflect.TypeOf(float64(0))
+	case "FLOAT":
+		return reflect.TypeOf(float64(0))
+	case "LOGICAL":
+		return reflect.TypeOf(false)
+	case "DATE":
+		return reflect.TypeOf(time.Time{})
+	}
+	return reflect.TypeOf((*interface{})(nil)).Elem()
+}
@@ -0,0 +1,177 @@
+package sqldriver
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tadvi/dbf"
+)
+
+func testDB(t *testing.T) *sql.DB {
+	dir := t.TempDir()
+	dt := dbf.New()
+	dt.AddTextField("name", 10)
+	dt.AddNumberField("amount", 10, 2)
+	dt.AddIntField("qty")
+	dt.AddDateField("born")
+	dt.AddBoolField("active")
+	rows := []map[string]interface{}{
+		{"name": "smith", "amount": 150.5, "qty": 3, "born": "1980-02-15", "active": true},
+		{"name": "jones", "amount": 99, "qty": 1, "born": "1999-12-31", "active": false},
+		{"name": "brown", "amount": 100, "qty": nil, "born": nil, "active": true},
+	}
+	for _, m := range rows {
+		if _, err := dt.AppendMap(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dt.SaveFile(filepath.Join(dir, "Customer.DBF")); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("dbf", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestSelect(t *testing.T) {
+	db := testDB(t)
+
+	rows, err := db.Query("SELECT name, amount * 2 AS twice, born FROM customer WHERE amount >= ? AND active ORDER BY name DESC", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cols, _ := rows.Columns(); cols[0] != "NAME" || cols[1] != "TWICE" {
+		t.Fatal("unexpected columns:", cols)
+	}
+	types, _ := rows.ColumnTypes()
+	if types[0].DatabaseTypeName() != "CHARACTER" || types[2].DatabaseTypeName() != "DATE" {
+		t.Fatal("unexpected column types:", types[0].DatabaseTypeName(), types[2].DatabaseTypeName())
+	}
+	if n, ok := types[0].Length(); !ok || n != 10 {
+		t.Fatal("expected NAME length 10 found:", n)
+	}
+	got := []string{}
+	for rows.Next() {
+		var name string
+		var twice float64
+		var born sql.NullTime
+		if err := rows.Scan(&name, &twice, &born); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, name)
+		if name == "smith" && (twice != 301 || !born.Time.Equal(time.Date(1980, 2, 15, 0, 0, 0, 0, time.UTC))) {
+			t.Fatal("unexpected smith row:", twice, born)
+		}
+		if name == "brown" && born.Valid {
+			t.Fatal("blank date should be NULL")
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != "smith" || got[1] != "brown" {
+		t.Fatal("expected smith and brown found:", got)
+	}
+
+	var count, qty int64
+	var total, avg float64
+	err = db.QueryRow("SELECT COUNT(*), SUM(qty), SUM(amount), AVG(amount) FROM customer").Scan(&count, &qty, &total, &avg)
+	if err != nil || count != 3 || qty != 4 || total != 349.5 || avg != 116.5 {
+		t.Fatal("unexpected aggregates:", err, count, qty, total, avg)
+	}
+
+	var name string
+	if err := db.QueryRow("SELECT name FROM customer WHERE name LIKE 'j%' OR born > '2000-01-01'").Scan(&name); err != nil || name != "jones" {
+		t.Fatal("expected jones found:", name, err)
+	}
+	if err := db.QueryRow("SELECT name FROM customer WHERE qty IS NULL").Scan(&name); err != nil || name != "brown" {
+		t.Fatal("expected brown found:", name, err)
+	}
+	if err := db.QueryRow("SELECT name FROM customer ORDER BY 1 LIMIT 1 OFFSET 1").Scan(&name); err != nil || name != "jones" {
+		t.Fatal("expected jones found:", name, err)
+	}
+
+	for _, q := range []string{
+		"SELECT nope FROM customer",
+		"SELECT name, COUNT(*) FROM customer",
+		"SELECT * FROM missing",
+		"SELECT * FROM customer WHERE",
+		"SELECT * FROM customer WHERE name > 1",
+	} {
+		if rows, err := db.Query(q); err == nil {
+			rows.Close()
+			t.Fatal("expected error for:", q)
+		}
+	}
+}
+
+func TestExec(t *testing.T) {
+	db := testDB(t)
+
+	res, err := db.Exec("INSERT INTO customer (name, amount, born) VALUES ($1, $2, $3), ('adams', 5, NULL)",
+		"white", 12.5, time.Date(2001, 1, 2, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := res.LastInsertId(); id != 5 {
+		t.Fatal("expected last record 5 found:", id)
+	}
+
+	res, err = db.Exec("UPDATE customer SET amount = amount + 1, active = TRUE WHERE name IN ('white', 'adams')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Fatal("expected 2 updated rows found:", n)
+	}
+	if _, err := db.Exec("DELETE FROM customer WHERE amount < 100"); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int64
+	var total float64
+	if err := db.QueryRow("SELECT COUNT(*), SUM(amount) FROM customer").Scan(&count, &total); err != nil || count != 2 || total != 250.5 {
+		t.Fatal("unexpected table after changes:", err, count, total)
+	}
+
+	// failed statement and rolled back transaction leave table unchanged
+	if _, err := db.Exec("INSERT INTO customer (name, qty) VALUES ('ok', 1), ('bad', 'x')"); err == nil {
+		t.Fatal("expected conversion error")
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("DELETE FROM customer"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM customer").Scan(&count); err != nil || count != 2 {
+		t.Fatal("expected 2 rows found:", count, err)
+	}
+
+	// statement failing half way fails the transaction
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("INSERT INTO customer (name, qty) VALUES ('ok', 1), ('bad', 'x')"); err == nil {
+		t.Fatal("expected conversion error")
+	}
+	if _, err := tx.Exec("DELETE FROM customer"); err == nil {
+		t.Fatal("expected error in failed transaction")
+	}
+	if err := tx.Commit(); err == nil {
+		t.Fatal("expected commit error")
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM customer").Scan(&count); err != nil || count != 2 {
+		t.Fatal("expected 2 rows after failed commit found:", count, err)
+	}
+}
@@ -0,0 +1,538 @@
+package dbf
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	decimalType = reflect.TypeOf(Decimal{})
+)
+
+// struct fields holding nullable values
+const (
+	wrapPointer = 1 // *int, *time.Time and other pointers
+	wrapNull    = 2 // sql.NullString and other sql.Null types
+)
+
+// structField maps exported struct field to table field the way Create does.
+type structField struct {
+	index   []int  // struct field index, path through nested structs
+	name    string // table field name, upper case and at most 10 characters
+	goName  string
+	depth   int // nesting level, shallower fields hide deeper ones of the same names
+	kind    reflect.Kind
+	time    bool // time.Time field
+	decimal bool // Decimal field
+	wrap    int  // pointer or sql.Null type, their null values are blank cells
+	conv    *converter
+	typ     byte // table field type: C, N, Y, L or D
+	length  uint8
+	dec     uint8
+}
+
+// structFields returns mapping of struct fields, unexported fields and fields
+// tagged with dash are left out. Tags are either text field length, as
+// `dbf:"40"`, or field name followed by options, as `dbf:"AMOUNT,type=N,len=12,dec=2"`.
+// Types with registered converter or TextMarshaler are stored as text.
+// Decimal fields are N fields, or currency with type=Y.
+// Embedded and nested structs are flattened, nested struct tag may give prefix
+// of its table field names, as `dbf:"prefix=ADDR_"`. As with Go selectors
+// shallower fields hide deeper fields of the same Go name mapped to the same
+// table field. Panics on unsupported types, invalid tags and other fields
+// mapped to the same name.
+func structFields(t reflect.Type) []structField {
+	all := []structField{}
+	walkStruct(t, nil, "", "", 0, map[reflect.Type]bool{t: true}, &all)
+
+	type names struct{ table, goName string }
+	depth := map[names]int{}
+	for _, f := range all {
+		k := names{f.name, f.baseName()}
+		if d, ok := depth[k]; !ok || f.depth < d {
+			depth[k] = f.depth
+		}
+	}
+	fields := []structField{}
+	mapped := map[string]string{}
+	for _, f := range all {
+		if f.depth != depth[names{f.name, f.baseName()}] {
+			continue
+		}
+		if prev, ok := mapped[f.name]; ok {
+			panic("dbf: struct fields " + prev + " and " + f.goName + " map to the same table field " + f.name)
+		}
+		mapped[f.name] = f.goName
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// baseName returns Go name of the field without path of nested structs.
+func (f *structField) baseName() string {
+	return f.goName[strings.LastIndex(f.goName, ".")+1:]
+}
+
+// walkStruct appends fields of struct type t, nested under index and path, to
+// fields. Seen types guard against recursive structs.
+func walkStruct(t reflect.Type, index []int, path, prefix string, depth int, seen map[reflect.Type]bool, fields *[]structField) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		alt := sf.Tag.Get("dbf")
+		// ignore '-' tags
+		if alt == "-" {
+			continue
+		}
+
+		typ, wrap := sf.Type, 0
+		if typ.Kind() == reflect.Ptr {
+			typ, wrap = typ.Elem(), wrapPointer
+		} else if isSQLNull(typ) {
+			typ, wrap = typ.Field(0).Type, wrapNull
+		}
+		conv := converterFor(typ)
+		goName := path + sf.Name
+		fieldIndex := append(append([]int{}, index...), i)
+
+		if typ.Kind() == reflect.Struct && wrap != wrapNull && typ != timeType && typ != decimalType && conv == nil {
+			// embedded structs of unexported types are walked for their
+			// exported fields, unless they need to be allocated
+			if sf.PkgPath != "" && (!sf.Anonymous || wrap == wrapPointer) {
+				continue
+			}
+			if seen[typ] {
+				panic("dbf: struct field " + goName + " is recursive, use dash to omit")
+			}
+			seen[typ] = true
+			walkStruct(typ, fieldIndex, goName+".", prefix+nestedPrefix(alt, goName), depth+1, seen, fields)
+			delete(seen, typ)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue // ignore unexported fields
+		}
+
+		f := structField{index: fieldIndex, name: sf.Name, goName: goName, depth: depth, kind: typ.Kind(),
+			time: typ == timeType, decimal: typ == decimalType, wrap: wrap, conv: conv}
+		f.parseTag(alt)
+		f.name = strings.ToUpper(prefix + f.name)
+		if len(f.name) > 10 {
+			f.name = f.name[:10]
+		}
+		*fields = append(*fields, f)
+	}
+}
+
+// nestedPrefix returns table field name prefix from struct tag of nested struct.
+func nestedPrefix(tag, goName string) string {
+	if tag == "" {
+		return ""
+	}
+	key, value, ok := strings.Cut(tag, "=")
+	if !ok || key != "prefix" || strings.Contains(value, ",") {
+		panic("dbf: invalid struct tag " + tag + " of nested struct " + goName)
+	}
+	return value
+}
+
+// fieldByIndex returns nested struct field. Nil pointers to nested structs are
+// allocated when alloc is set, otherwise invalid value is returned for them.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) reflect.Value {
+	for k, i := range index {
+		if k > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v
+}
+
+// isSQLNull reports whether type is one of sql.Null types: struct with value
+// and Valid fields.
+func isSQLNull(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t.PkgPath() == reflect.TypeOf(sql.NullString{}).PkgPath() &&
+		t.NumField() == 2 && t.Field(1).Name == "Valid" && t.Field(1).Type.Kind() == reflect.Bool
+}
+
+// parseTag reads struct tag and picks table field type, length and decimals.
+func (f *structField) parseTag(tag string) {
+	var length, dec int = -1, -1
+	legacy := false // plain number is length of text fields only
+	parts := strings.Split(tag, ",")
+	if strings.Contains(parts[0], "=") {
+		parts = append([]string{""}, parts...) // options without name
+	}
+	if n, err := strconv.ParseUint(parts[0], 0, 8); err == nil {
+		length, legacy = int(n), true
+	} else if name := strings.TrimSpace(parts[0]); name != "" {
+		if len(name) > 10 {
+			panic("dbf: field name " + name + " in struct tag is longer than 10 characters")
+		}
+		f.name = name
+	}
+	for _, opt := range parts[1:] {
+		key, value, _ := strings.Cut(strings.TrimSpace(opt), "=")
+		switch key {
+		case "type":
+			if len(value) != 1 || !strings.Contains("CNYLD", strings.ToUpper(value)) {
+				panic("dbf: invalid type in struct tag " + tag)
+			}
+			f.typ = strings.ToUpper(value)[0]
+		case "len", "dec":
+			n, err := strconv.ParseUint(value, 10, 8)
+			if err != nil {
+				panic("dbf: invalid struct tag " + tag)
+			}
+			if key == "len" {
+				length = int(n)
+			} else {
+				dec = int(n)
+			}
+		default:
+			panic("dbf: invalid struct tag " + tag)
+		}
+	}
+
+	// type by the kind of the field
+	numeric, float := false, false
+	if f.conv == nil {
+		switch f.kind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			numeric = true
+		case reflect.Float32, reflect.Float64:
+			numeric, float = true, true
+		case reflect.String, reflect.Bool:
+		default:
+			numeric, float = f.decimal, f.decimal
+			if !f.time && !f.decimal {
+				panic("dbf: unsupported type for database table schema, use dash to omit")
+			}
+		}
+	}
+	if f.typ == 0 {
+		switch {
+		case f.conv != nil:
+			f.typ = 'C'
+		case numeric:
+			f.typ = 'N'
+		case f.kind == reflect.Bool:
+			f.typ = 'L'
+		case f.time:
+			f.typ = 'D'
+		default:
+			f.typ = 'C'
+		}
+	}
+	ok := f.typ == 'C' || f.conv != nil || f.kind == reflect.String ||
+		f.typ == 'N' && numeric || f.typ == 'Y' && float || f.typ == 'L' && f.kind == reflect.Bool || f.typ == 'D' && f.time
+	if !ok {
+		panic("dbf: struct field " + f.goName + " can not be stored as type " + string(f.typ))
+	}
+
+	switch f.typ {
+	case 'C':
+		f.length = 50 // text fields default to 50 unless specified
+	case 'N':
+		// ints, floats and decimals default to AddIntField and AddFloatField sizes
+		f.length = 17
+		if float && length < 0 {
+			f.dec = 8
+		}
+	case 'Y':
+		f.length, f.dec = 8, currencyScale
+	case 'L':
+		f.length = 1
+	case 'D':
+		f.length = 8
+	}
+	if length >= 0 && (f.typ == 'C' || f.typ == 'N' && !legacy) {
+		f.length = uint8(length)
+	}
+	if dec >= 0 && f.typ != 'Y' {
+		f.dec = uint8(dec)
+	}
+	if f.length == 0 || f.typ == 'N' && f.dec > 0 && (f.dec >= f.length || f.dec > 15) {
+		panic("dbf: invalid length or decimals in struct tag " + tag)
+	}
+}
+
+// addTo adds table field for the struct field.
+func (sf structField) addTo(dt *DbfTable) error {
+	return dt.addField(sf.name, sf.typ, sf.length, sf.dec)
+}
+
+// encode returns table value of the struct field, null is set for nil
+// pointers and invalid sql.Null values.
+func (sf structField) encode(f reflect.Value, field *DbfField) (value string, null bool, err error) {
+	switch sf.wrap {
+	case wrapPointer:
+		if f.IsNil() {
+			return "", true, nil
+		}
+		f = f.Elem()
+	case wrapNull:
+		if !f.Field(1).Bool() {
+			return "", true, nil
+		}
+		f = f.Field(0)
+	}
+	if sf.conv != nil {
+		value, err = sf.encodeConv(f)
+		return value, false, err
+	}
+	value, err = sf.encodeValue(f, field)
+	return value, false, err
+}
+
+// encodeValue returns table value of string, number, bool or time.Time.
+// Decimal values that do not fit the field are errors.
+func (sf structField) encodeValue(f reflect.Value, field *DbfField) (string, error) {
+	if sf.time {
+		t := f.Interface().(time.Time)
+		if t.IsZero() {
+			return "", nil
+		}
+		return t.Format("20060102"), nil
+	}
+	if sf.decimal {
+		return decimalText(field, f.Interface().(Decimal))
+	}
+	switch sf.kind {
+	case reflect.String:
+		return f.String(), nil
+	case reflect.Bool:
+		if f.Bool() {
+			return "t", nil
+		}
+		return "f", nil
+	case reflect.Float32, reflect.Float64:
+		if field.Type == "N" {
+			return strconv.FormatFloat(f.Float(), 'f', int(field.Decimals), 64), nil
+		}
+		return strconv.FormatFloat(f.Float(), 'f', -1, 64), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(f.Uint(), 10), nil
+	}
+	return strconv.FormatInt(f.Int(), 10), nil
+}
+
+// decode sets struct field from table value, pointers and sql.Null types are
+// set to nil or invalid when null is set.
+func (sf structField) decode(f reflect.Value, value string, null bool) error {
+	if sf.wrap != 0 {
+		if null {
+			f.SetZero()
+			return nil
+		}
+		if sf.wrap == wrapPointer {
+			p := reflect.New(f.Type().Elem())
+			f.Set(p)
+			f = p.Elem()
+		} else {
+			f.Field(1).SetBool(true)
+			f = f.Field(0)
+		}
+	}
+	if sf.conv != nil {
+		return sf.decodeConv(f, value)
+	}
+	return sf.decodeValue(f, value)
+}
+
+// decodeValue sets string, number, bool or time.Time, blank numbers are zero.
+func (sf structField) decodeValue(f reflect.Value, value string) error {
+	var err error
+	if sf.time {
+		var t time.Time
+		if value != "" {
+			t, err = time.Parse("20060102", value)
+		}
+		f.Set(reflect.ValueOf(t))
+	} else if sf.decimal {
+		var d Decimal
+		if value != "" {
+			d, err = ParseDecimal(value)
+		}
+		f.Set(reflect.ValueOf(d))
+	} else {
+		switch sf.kind {
+		case reflect.String:
+			f.SetString(value)
+		case reflect.Bool:
+			f.SetBool(value == "T" || value == "t" || value == "Y" || value == "y")
+		case reflect.Float32, reflect.Float64:
+			var v float64
+			if value != "" {
+				v, err = strconv.ParseFloat(value, f.Type().Bits())
+			}
+			f.SetFloat(v)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			var v uint64
+			if value != "" {
+				v, err = strconv.ParseUint(value, 10, f.Type().Bits())
+			}
+			f.SetUint(v)
+		default:
+			var v int64
+			if value != "" {
+				v, err = strconv.ParseInt(value, 10, f.Type().Bits())
+			}
+			f.SetInt(v)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("fail to parse field '%s' type: %s value: %s",
+			sf.name, f.Type().String(), value)
+	}
+	return nil
+}
+
+// codec reads and writes one struct type from and to the table. It is built
+// once per struct type and kept by the table until its schema changes.
+type codec struct {
+	fields  []structField
+	cols    []int // table field index of every struct field, -1 when missing
+	offsets []int // offset of the field from the start of the record
+	// mismatch lists struct fields without table fields and the other way
+	// around, nil when struct and table match
+	mismatch *MappingError
+}
+
+// codec returns cached codec of the struct type. Cache is locked, rows can
+// be read by several goroutines at once.
+func (dt *DbfTable) codec(t reflect.Type) *codec {
+	dt.codecMu.RLock()
+	c, ok := dt.codecs[t]
+	dt.codecMu.RUnlock()
+	if ok {
+		return c
+	}
+	c = &codec{fields: structFields(t)}
+	for _, sf := range c.fields {
+		i := dt.fieldIndex(sf.name)
+		offset := 0
+		if i >= 0 {
+			offset = dt.fieldOffset(i)
+		}
+		c.cols = append(c.cols, i)
+		c.offsets = append(c.offsets, offset)
+	}
+	c.mismatch = c.match(dt, t)
+	dt.codecMu.Lock()
+	defer dt.codecMu.Unlock()
+	if dt.codecs == nil {
+		dt.codecs = map[reflect.Type]*codec{}
+	}
+	dt.codecs[t] = c
+	return c
+}
+
+// read row into struct value s.
+func (c *codec) read(dt *DbfTable, row int, s reflect.Value) error {
+	if err := c.check(dt); err != nil {
+		return err
+	}
+	for j, sf := range c.fields {
+		if c.skip(dt, j) {
+			if f := fieldByIndex(s, sf.index, false); f.IsValid() {
+				f.SetZero()
+			}
+			continue
+		}
+		col := c.cols[j]
+		value := dt.fieldValueAt(row, col, c.offsets[j])
+		// blank cells and '?' logicals are null unless table keeps null flags
+		null := value == "" || dt.fields[col].Type == "L" && value == "?"
+		if dt.nullBit(col) >= 0 {
+			null = dt.IsNull(row, col)
+		}
+		if err := sf.decode(fieldByIndex(s, sf.index, true), value, null); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write struct value s into the row, null values are stored as blanks and
+// marked in _NullFlags of nullable VFP fields. Null logicals are stored as '?'.
+// Nothing is written when converter fails to encode a value.
+func (c *codec) write(dt *DbfTable, row int, s reflect.Value) error {
+	values, err := c.encode(dt, s)
+	if err != nil {
+		return err
+	}
+	c.put(dt, row, values)
+	return nil
+}
+
+// encode returns table values of struct fields in order of c.fields, values
+// of skipped fields are left empty.
+func (c *codec) encode(dt *DbfTable, s reflect.Value) ([]mapValue, error) {
+	if err := c.check(dt); err != nil {
+		return nil, err
+	}
+	values := make([]mapValue, len(c.fields))
+	for j, sf := range c.fields {
+		if c.skip(dt, j) {
+			continue
+		}
+		col := c.cols[j]
+		value, null := "", true // fields of nil nested struct are null
+		if f := fieldByIndex(s, sf.index, false); f.IsValid() {
+			var err error
+			if value, null, err = sf.encode(f, &dt.fields[col]); err != nil {
+				return nil, err
+			}
+		}
+		if null && dt.fields[col].Type == "L" {
+			value = "?"
+		}
+		values[j] = mapValue{field: col, value: value, null: null}
+	}
+	return values, nil
+}
+
+// put stores encoded values into the row.
+func (c *codec) put(dt *DbfTable, row int, values []mapValue) {
+	for j, v := range values {
+		if c.cols[j] < 0 {
+			continue
+		}
+		dt.setFieldValueAt(row, v.field, c.offsets[j], v.value)
+		if v.null && dt.nullBit(v.field) >= 0 {
+			dt.SetNull(row, v.field)
+		}
+	}
+}
+
+// check returns mismatch of struct and table fields in strict mapping.
+func (c *codec) check(dt *DbfTable) error {
+	if dt.mapping == MapStrict && c.mismatch != nil {
+		return c.mismatch
+	}
+	return nil
+}
+
+// skip reports whether struct field has no table field, it panics the way
+// FieldValueByName does unless mapping is lenient.
+func (c *codec) skip(dt *DbfTable, j int) bool {
+	if c.cols[j] >= 0 {
+		return false
+	}
+	if dt.mapping == MapDefault {
+		panic("Field name '" + c.fields[j].name + "' does not exist")
+	}
+	return true
+}
@@ -0,0 +1,189 @@
+package dbf
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type Customer struct {
+	CustomerName string    `dbf:"CUSTNAME,type=C,len=40"`
+	Amount       float64   `dbf:"AMOUNT,type=N,len=12,dec=2"`
+	Born         time.Time `dbf:"BORN,type=D"`
+	Zip          string    `dbf:"ZIP,len=5"`
+	Count        int       `dbf:",len=5"`
+	Note         string    `dbf:"10"`
+	Skipped      string    `dbf:"-"`
+}
+
+func TestStructTags(t *testing.T) {
+	db := New()
+	if err := db.Create(Customer{}); err != nil {
+		t.Fatal(err)
+	}
+	want := []DbfField{
+		{Name: "CUSTNAME", Type: "C", Length: 40},
+		{Name: "AMOUNT", Type: "N", Length: 12, Decimals: 2},
+		{Name: "BORN", Type: "D", Length: 8},
+		{Name: "ZIP", Type: "C", Length: 5},
+		{Name: "COUNT", Type: "N", Length: 5},
+		{Name: "NOTE", Type: "C", Length: 10},
+	}
+	fields := db.Fields()
+	if len(fields) != len(want) {
+		t.Fatal("expected", len(want), "fields found:", len(fields))
+	}
+	for i, f := range want {
+		g := fields[i]
+		if g.Name != f.Name || g.Type != f.Type || g.Length != f.Length || g.Decimals != f.Decimals {
+			t.Fatalf("expected field %+v found: %s %s %d %d", f, g.Name, g.Type, g.Length, g.Decimals)
+		}
+	}
+
+	born := time.Date(1980, 2, 15, 0, 0, 0, 0, time.UTC)
+	row := db.Append(Customer{CustomerName: "ACME", Amount: 1234.567, Born: born, Zip: "02134", Count: 7, Note: "n"})
+	if v := db.FieldValue(row, 1); v != "1234.57" {
+		t.Fatal("expected amount 1234.57 found:", v)
+	}
+	if v := db.FieldValue(row, 2); v != "19800215" {
+		t.Fatal("expected date 19800215 found:", v)
+	}
+
+	var c Customer
+	if err := db.Read(row, &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.CustomerName != "ACME" || c.Amount != 1234.57 || !c.Born.Equal(born) || c.Zip != "02134" || c.Count != 7 {
+		t.Fatal("unexpected value read:", c)
+	}
+}
+
+type AuditFields struct {
+	CreatedBy string `dbf:"10"`
+	Created   time.Time
+}
+
+type Address struct {
+	City string `dbf:"10"`
+	Zip  string `dbf:"5"`
+}
+
+type Order struct {
+	AuditFields
+	*Extra
+	No      int
+	Ship    Address  `dbf:"prefix=SHIP_"`
+	Bill    *Address `dbf:"prefix=BILL_"`
+	Created time.Time
+}
+
+type Extra struct {
+	Note string `dbf:"20"`
+}
+
+func TestNestedStructs(t *testing.T) {
+	db := New()
+	if err := db.Create(Order{}); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, f := range db.Fields() {
+		names = append(names, f.Name)
+	}
+	want := "CREATEDBY NOTE NO SHIP_CITY SHIP_ZIP BILL_CITY BILL_ZIP CREATED"
+	if got := strings.Join(names, " "); got != want {
+		t.Fatal("expected fields", want, "found:", got)
+	}
+
+	created := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	row := db.Append(Order{AuditFields: AuditFields{CreatedBy: "tad", Created: time.Now()}, No: 1,
+		Ship: Address{City: "Boston", Zip: "02134"}, Created: created})
+	if v := db.FieldValueByName(row, "BILL_CITY"); v != "" {
+		t.Fatal("nil nested struct should be blank found:", v)
+	}
+
+	var o Order
+	if err := db.Read(row, &o); err != nil {
+		t.Fatal(err)
+	}
+	if o.CreatedBy != "tad" || o.Ship.City != "Boston" || o.Ship.Zip != "02134" || !o.Created.Equal(created) {
+		t.Fatal("unexpected order read:", o)
+	}
+	if o.Extra == nil || o.Bill == nil || o.Bill.City != "" {
+		t.Fatal("nested pointers should be allocated on read:", o)
+	}
+}
+
+func TestStructTagErrors(t *testing.T) {
+	type collision struct {
+		CustomerNameFirst string
+		CustomerNameLast  string
+	}
+	type lastName struct {
+		CustomerNameLast string
+	}
+	type nestedCollision struct {
+		CustomerNameFirst string
+		lastName
+	}
+	type badType struct {
+		Flag bool `dbf:"FLAG,type=N"`
+	}
+	type badOption struct {
+		Name string `dbf:"NAME,size=4"`
+	}
+	type badPrefix struct {
+		Addr Address `dbf:"ADDR"`
+	}
+	type recursive struct {
+		Next *recursive
+	}
+	type zeroLength struct {
+		Name string `dbf:"NAME,len=0"`
+	}
+	type wideDecimals struct {
+		Amount float64 `dbf:"AMOUNT,len=5,dec=5"`
+	}
+	type manyDecimals struct {
+		Amount float64 `dbf:"AMOUNT,len=20,dec=16"`
+	}
+	for _, spec := range []interface{}{collision{}, nestedCollision{}, badType{}, badOption{}, badPrefix{}, recursive{},
+		zeroLength{}, wideDecimals{}, manyDecimals{}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected panic for %T", spec)
+				}
+			}()
+			New().Create(spec)
+		}()
+	}
+}
+
+func TestConcurrentRead(t *testing.T) {
+	db := New()
+	if err := db.Create(Customer{}); err != nil {
+		t.Fatal(err)
+	}
+	row := db.Append(Customer{CustomerName: "Smith", Amount: 10})
+	type name struct {
+		Name string `dbf:"CUSTNAME"`
+	}
+	done := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func() {
+			var c name
+			err := db.Read(row, &c)
+			if err == nil && (c.Name != "Smith" || db.IsNull(row, 0) || db.RowMap(row)["AMOUNT"] == nil) {
+				err = errors.New("unexpected row read")
+			}
+			done <- err
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
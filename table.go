@@ -0,0 +1,111 @@
+package dbf
+
+import (
+	"errors"
+	"iter"
+	"reflect"
+)
+
+// Rows returns sequence of not deleted rows and their values.
+func Rows(dt *DbfTable) iter.Seq2[int, []string] {
+	return func(yield func(int, []string) bool) {
+		for it := dt.NewIterator(); it.Next(); {
+			if !yield(it.Index(), it.Row()) {
+				return
+			}
+		}
+	}
+}
+
+// Table gives typed access to table rows as values of struct T. Struct fields
+// are mapped to table fields once, the same way Read and Write map them.
+type Table[T any] struct {
+	dt    *DbfTable
+	codec *codec
+	err   error
+}
+
+// NewTable maps struct T to the table. Table without fields gets its schema
+// created from T, otherwise every struct field must have table field unless
+// mapping of the table is lenient. Strict mapping needs exact match.
+func NewTable[T any](dt *DbfTable) (*Table[T], error) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if typ.Kind() != reflect.Struct {
+		return nil, errors.New("dbf: table type " + typ.String() + " must be a struct")
+	}
+	if len(dt.fields) == 0 {
+		if err := dt.Create(reflect.New(typ).Interface()); err != nil {
+			return nil, err
+		}
+	}
+
+	t := &Table[T]{dt: dt, codec: dt.codec(typ)}
+	switch dt.mapping {
+	case MapStrict:
+		if err := t.codec.check(dt); err != nil {
+			return nil, err
+		}
+	case MapDefault:
+		for j, sf := range t.codec.fields {
+			if t.codec.cols[j] < 0 {
+				return nil, errors.New("dbf: field '" + sf.name + "' of " + typ.String() + " does not exist in the table")
+			}
+		}
+	}
+	return t, nil
+}
+
+// DbfTable returns underlying table.
+func (t *Table[T]) DbfTable() *DbfTable {
+	return t.dt
+}
+
+// Get reads row into new value of T.
+func (t *Table[T]) Get(row int) (T, error) {
+	var v T
+	err := t.codec.read(t.dt, row, reflect.ValueOf(&v).Elem())
+	return v, err
+}
+
+// Put writes v into the row.
+func (t *Table[T]) Put(row int, v T) error {
+	return t.codec.write(t.dt, row, reflect.ValueOf(&v).Elem())
+}
+
+// Append adds new record with v and returns its row. No record is added when
+// v can not be encoded.
+func (t *Table[T]) Append(v T) (int, error) {
+	values, err := t.codec.encode(t.dt, reflect.ValueOf(&v).Elem())
+	if err != nil {
+		return -1, err
+	}
+	row := t.dt.AddRecord()
+	t.codec.put(t.dt, row, values)
+	return row, nil
+}
+
+// All returns sequence of not deleted rows read into T. Iteration stops at
+// the first row that can not be read, Err reports the error. The error is kept
+// by the Table, so loops over All of one Table must not overlap: nested and
+// concurrent loops need their own Table from NewTable.
+func (t *Table[T]) All() iter.Seq2[int, T] {
+	return func(yield func(int, T) bool) {
+		t.err = nil
+		for it := t.dt.NewIterator(); it.Next(); {
+			v, err := t.Get(it.Index())
+			if err != nil {
+				t.err = err
+				return
+			}
+			if !yield(it.Index(), v) {
+				return
+			}
+		}
+	}
+}
+
+// Err returns error that stopped the last All iteration, nil when it read all
+// rows or was stopped by the loop. It is reset when the next iteration starts.
+func (t *Table[T]) Err() error {
+	return t.err
+}
@@ -0,0 +1,78 @@
+package dbf
+
+import "testing"
+
+func TestRows(t *testing.T) {
+	db := New()
+	db.AddTextField("name", 10)
+	for _, name := range []string{"one", "two", "three"} {
+		db.SetFieldValue(db.AddRecord(), 0, name)
+	}
+	db.Delete(1)
+
+	names := []string{}
+	for row, values := range Rows(db) {
+		if row == 1 {
+			t.Fatal("deleted row returned")
+		}
+		names = append(names, values[0])
+	}
+	if len(names) != 2 || names[0] != "one" || names[1] != "three" {
+		t.Fatal("expected one and three found:", names)
+	}
+}
+
+func TestTable(t *testing.T) {
+	tbl, err := NewTable[TTable](New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := tbl.Append(TTable{Boolean: i%2 == 0, Text: "text", Int: i, Float: float64(i) / 2}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tbl.DbfTable().Delete(1)
+
+	count := 0
+	for row, v := range tbl.All() {
+		if v.Int != row || v.Float != float64(row)/2 || v.Boolean != (row%2 == 0) || v.Text != "text" {
+			t.Fatal("unexpected value", v, "in row", row)
+		}
+		count++
+	}
+	if count != 2 || tbl.Err() != nil {
+		t.Fatal("expected 2 rows found:", count, tbl.Err())
+	}
+
+	if err := tbl.Put(2, TTable{Text: "changed", Int: 42}); err != nil {
+		t.Fatal(err)
+	}
+	v, err := tbl.Get(2)
+	if err != nil || v.Text != "changed" || v.Int != 42 {
+		t.Fatal("expected changed row found:", v, err)
+	}
+
+	type other struct{ Missing string }
+	if _, err := NewTable[other](tbl.DbfTable()); err == nil {
+		t.Fatal("struct field without table field should fail")
+	}
+}
+
+func TestTableAppendError(t *testing.T) {
+	db := New()
+	if err := db.Create(Invoice{}); err != nil {
+		t.Fatal(err)
+	}
+	tbl, err := NewTable[Invoice](db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tax, _ := ParseDecimal("1234567.89")
+	if _, err := tbl.Append(Invoice{Number: "A1", Tax: &tax}); err == nil {
+		t.Fatal("expected error for tax wider than field")
+	}
+	if db.NumRecords() != 0 {
+		t.Fatal("failed append should not add record, found:", db.NumRecords())
+	}
+}
@@ -0,0 +1,159 @@
+package dbf
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// Writer streams records directly into a file without keeping the table in memory.
+// Table schema is taken from DbfTable created with New() and AddxxxField calls.
+type Writer struct {
+	dt     *DbfTable
+	w      io.WriteSeeker
+	record []byte
+	count  uint32
+	closed bool
+}
+
+// NewWriter writes dbase header of the schema table into w and returns Writer
+// ready to accept records. Records already in the schema table are not written.
+func NewWriter(w io.WriteSeeker, schema *DbfTable) (*Writer, error) {
+	if len(schema.fields) == 0 {
+		return nil, errors.New("dbf: schema table has no fields")
+	}
+	header := make([]byte, schema.headerSize)
+	copy(header, schema.dataStore)
+	// number of records is set on Close
+	copy(header[4:8], uint32ToBytes(0))
+
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	schema.frozenStruct = true
+	return &Writer{dt: schema, w: w, record: make([]byte, schema.recordLength)}, nil
+}
+
+// AppendWriter returns Writer that adds records to the end of existing dbase file.
+// Only the file header is read into memory. File must be opened for reading and writing.
+// Production .MDX index is not updated, its flag is cleared in the file header.
+func AppendWriter(f *os.File) (*Writer, error) {
+	schema, err := readHeader(f)
+	if err != nil {
+		return nil, err
+	}
+	if schema.HasMdx() {
+		if _, err := f.WriteAt([]byte{0}, mdxProductionFlag); err != nil {
+			return nil, err
+		}
+	}
+	count := schema.numberOfRecords
+	// schema table holds no records, Writer counts them
+	schema.numberOfRecords = 0
+	schema.frozenStruct = true
+
+	// new records overwrite end of file marker
+	if _, err := f.Seek(int64(schema.getRowOffset(int(count))), io.SeekStart); err != nil {
+		return nil, err
+	}
+	return &Writer{dt: schema, w: f, record: make([]byte, schema.recordLength), count: count}, nil
+}
+
+// readHeader reads dbase file header and returns table without records,
+// number of records in the file is kept in the header.
+func readHeader(r io.Reader) (*DbfTable, error) {
+	head := make([]byte, 32)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	headerSize := int(head[8]) | int(head[9])<<8
+	if headerSize < 33 {
+		return nil, errors.New("dbf: invalid dbase header size")
+	}
+	header := make([]byte, headerSize)
+	copy(header, head)
+	if _, err := io.ReadFull(r, header[32:]); err != nil {
+		return nil, err
+	}
+	return parseHeader(header)
+}
+
+// Fields of the table being written.
+func (w *Writer) Fields() []DbfField {
+	return w.dt.Fields()
+}
+
+// Write adds one record. Values are given in the order of table fields,
+// nullable fields of Visual FoxPro tables are written not null and value of
+// _NullFlags field is ignored. Invalid currency values are returned as errors.
+func (w *Writer) Write(record []string) error {
+	if w.closed {
+		return errors.New("dbf: write to closed Writer")
+	}
+	if len(record) > len(w.dt.fields) {
+		return errors.New("dbf: record has more values than table fields")
+	}
+
+	w.record[0] = 0x20 // not deleted
+	offset := 1
+	for i, field := range w.dt.fields {
+		cell := w.record[offset : offset+int(field.Length)]
+		if field.Type == nullFlagsType {
+			// written values clear null flags as SetFieldValue does
+			for j := range cell {
+				cell[j] = 0
+			}
+			offset += int(field.Length)
+			continue
+		}
+		value := ""
+		if i < len(record) {
+			value = record[i]
+		}
+		if err := w.dt.putField(cell, i, value); err != nil {
+			return err
+		}
+		offset += int(field.Length)
+	}
+	return w.writeRecord(w.record)
+}
+
+// writeRecord adds record given as stored, with deleted flag.
+func (w *Writer) writeRecord(record []byte) error {
+	if w.closed {
+		return errors.New("dbf: write to closed Writer")
+	}
+	if _, err := w.w.Write(record); err != nil {
+		return err
+	}
+	w.count++
+	return nil
+}
+
+// Count returns number of records in the file, including records that
+// were there before AppendWriter.
+func (w *Writer) Count() int {
+	return int(w.count)
+}
+
+// Close writes end of file marker and updates number of records in the header.
+// Close does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	// dbase end of file marker which is 1Ah
+	if _, err := w.w.Write([]byte{0x1A}); err != nil {
+		return err
+	}
+	if _, err := w.w.Seek(4, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(uint32ToBytes(w.count)); err != nil {
+		return err
+	}
+	_, err := w.w.Seek(0, io.SeekEnd)
+	return err
+}
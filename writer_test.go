@@ -0,0 +1,174 @@
+package dbf
+
+import (
+	"os"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	schema := New()
+	schema.AddTextField("text", 10)
+	schema.AddNumberField("num", 8, 2)
+	schema.AddBoolField("bool")
+
+	f, err := os.Create(tempdbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tempdbf)
+
+	w, err := NewWriter(f, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := [][]string{{"one", "1.25", "t"}, {"two", "-3", "f"}, {"three"}}
+	for _, rec := range records {
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := LoadFile(tempdbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.NumRecords() != len(records) {
+		t.Fatal("expected", len(records), "records found:", db.NumRecords())
+	}
+	for row, rec := range records {
+		arr := db.Row(row)
+		for i, v := range rec {
+			if arr[i] != v {
+				t.Fatal("row", row, "expected", v, "found:", arr[i])
+			}
+		}
+	}
+	if v := db.FieldValue(2, 1); v != "" {
+		t.Fatal("missing value should be blank, found:", v)
+	}
+}
+
+func TestWriterCurrency(t *testing.T) {
+	schema := New()
+	schema.AddCurrencyField("price")
+	f, err := os.Create(tempdbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tempdbf)
+	defer f.Close()
+	w, err := NewWriter(f, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write([]string{"bad"}); err == nil {
+		t.Fatal("expected error for invalid currency")
+	}
+	if err := w.Write([]string{"2.5"}); err != nil {
+		t.Fatal(err)
+	}
+	if w.Count() != 1 {
+		t.Fatal("expected 1 record written found:", w.Count())
+	}
+}
+
+func TestAppendWriter(t *testing.T) {
+	db := New()
+	db.AddTextField("text", 10)
+	db.AddNumberField("num", 8, 2)
+	db.SetFieldValue(db.AddRecord(), 0, "first")
+	defer os.Remove("temp.mdx")
+	m, err := db.CreateMdx("temp.mdx", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.AddTag("TEXT", "TEXT"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveFile(tempdbf); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tempdbf)
+
+	f, err := os.OpenFile(tempdbf, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := AppendWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(w.Fields()) != 2 || w.Fields()[1].Decimals != 2 {
+		t.Fatal("unexpected fields:", w.Fields())
+	}
+	if err := w.Write([]string{"second", "2.50"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err = LoadFile(tempdbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.NumRecords() != 2 {
+		t.Fatal("expected 2 records found:", db.NumRecords())
+	}
+	if db.HasMdx() {
+		t.Fatal("production index flag should be cleared by append")
+	}
+	if v := db.FieldValue(0, 0); v != "first" {
+		t.Fatal("expected 'first' found:", v)
+	}
+	if v := db.FieldValue(1, 1); v != "2.50" {
+		t.Fatal("expected '2.50' found:", v)
+	}
+}
+
+func TestWriterNullFlags(t *testing.T) {
+	schema := New()
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		schema.AddTextField(name, 4)
+	}
+	schema.addField("_NullFlags", '0', 1, 0)
+	for i := 0; i < 6; i++ {
+		schema.fields[i].fieldStore[18] = fieldNullable
+	}
+	schema.updateHeader()
+
+	f, err := os.Create(tempdbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tempdbf)
+	w, err := NewWriter(f, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write([]string{"1", "2", "3", "4", "5", "x", "ignored"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := LoadFile(tempdbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 6; i++ {
+		if db.IsNull(0, i) {
+			t.Fatal("written field should not be null:", i)
+		}
+	}
+	if v := db.FieldValue(0, 5); v != "x" {
+		t.Fatal("expected 'x' found:", v)
+	}
+}